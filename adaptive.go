@@ -0,0 +1,371 @@
+package exp
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats holds evaluation statistics for the elements of the conjunctions and
+// disjunctions of an expression, keyed by the path of each element. A path
+// lists the position of an element and of each of its ancestors within their
+// parent, as constructed, separated by dots. For example "1.0" is the first
+// element of the second element of the root. The element of a Not is at
+// position 0.
+//
+// Stats are recorded by an Adaptive and may be applied ahead of time using
+// Optimize.
+type Stats map[string]NodeStats
+
+// NodeStats holds the evaluation statistics of a single expression.
+type NodeStats struct {
+	// Evals is the number of sampled evaluations.
+	Evals uint64 `json:"evals"`
+	// Passes is the number of sampled evaluations which returned true.
+	Passes uint64 `json:"passes"`
+	// Nanos is the total time spent in sampled evaluations, in nanoseconds.
+	Nanos uint64 `json:"nanos"`
+}
+
+// rank scores an element of an And, or of an Or if and is false. Elements with
+// lower ranks should be evaluated first. The rank is the expected cost of
+// evaluating the element divided by the likelihood it decides the result of its
+// parent, so that cheap elements which often short-circuit come first. If the
+// element was never evaluated, cost is assumed.
+func (s NodeStats) rank(and bool, cost float64) float64 {
+	p := (float64(s.Passes) + 1) / (float64(s.Evals) + 2)
+	if and {
+		p = 1 - p
+	}
+	if s.Evals > 0 {
+		cost = float64(s.Nanos) / float64(s.Evals)
+	}
+	return (cost + 1) / p
+}
+
+// reorder returns the order in which elements with the given stats should be
+// evaluated. Elements with equal ranks keep their relative order.
+func reorder(stats []NodeStats, and bool) []int {
+	var sum float64
+	var n int
+	for _, s := range stats {
+		if s.Evals > 0 {
+			sum += float64(s.Nanos) / float64(s.Evals)
+			n++
+		}
+	}
+	cost := 0.0
+	if n > 0 {
+		cost = sum / float64(n)
+	}
+	ranks := make([]float64, len(stats))
+	order := make([]int, len(stats))
+	for i, s := range stats {
+		ranks[i] = s.rank(and, cost)
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return ranks[order[i]] < ranks[order[j]] })
+	return order
+}
+
+func childPath(path string, i int) string {
+	if path == "" {
+		return strconv.Itoa(i)
+	}
+	return path + "." + strconv.Itoa(i)
+}
+
+// Optimize returns a copy of e with the elements of every And and Or reordered
+// according to stats, so that the cheapest and most decisive elements are
+// evaluated first. Elements missing from stats are assumed to cost as much as
+// the average of their siblings and to be equally likely to pass or fail.
+//
+// Reordering does not change the result of an expression, as long as its
+// elements have no side effects. Ors built by GreaterOrEqual and LessOrEqual
+// are left as is.
+//
+//	a := exp.NewAdaptive(e)
+//	// evaluate a for a while, then
+//	e = exp.Optimize(e, a.Stats())
+func Optimize(e Exp, stats Stats) Exp {
+	return optimize(e, "", stats)
+}
+
+func optimize(e Exp, path string, stats Stats) Exp {
+	switch e := e.(type) {
+	case expNot:
+		return expNot{optimize(e.elem, childPath(path, 0), stats)}
+	case expAnd:
+		return expAnd{optimizeAll(e.elems, path, stats, true)}
+	case expOr:
+		if _, _, _, ok := inspectOrEqual(e); ok {
+			return e
+		}
+		return expOr{optimizeAll(e.elems, path, stats, false)}
+	}
+	return e
+}
+
+func optimizeAll(elems []Exp, path string, stats Stats, and bool) []Exp {
+	s := make([]NodeStats, len(elems))
+	optimized := make([]Exp, len(elems))
+	for i, elem := range elems {
+		p := childPath(path, i)
+		s[i] = stats[p]
+		optimized[i] = optimize(elem, p, stats)
+	}
+	reordered := make([]Exp, len(elems))
+	for i, j := range reorder(s, and) {
+		reordered[i] = optimized[j]
+	}
+	return reordered
+}
+
+// AdaptiveOption configures an Adaptive.
+type AdaptiveOption func(*Adaptive)
+
+// SampleRate sets how often an Adaptive records statistics. One in every n
+// evaluations is sampled. The default is 16.
+func SampleRate(n int) AdaptiveOption {
+	return func(a *Adaptive) {
+		if n > 0 {
+			a.rate = uint64(n)
+		}
+	}
+}
+
+// SampleWindow sets how many sampled evaluations an Adaptive waits for before
+// reordering. The default is 1024.
+func SampleWindow(n int) AdaptiveOption {
+	return func(a *Adaptive) {
+		if n > 0 {
+			a.window = uint64(n)
+		}
+	}
+}
+
+// withClock sets the clock an Adaptive times sampled evaluations with. Tests
+// use it so that the recorded times are deterministic.
+func withClock(now func() time.Time) AdaptiveOption {
+	return func(a *Adaptive) {
+		a.now = now
+	}
+}
+
+// Adaptive is an expression which reorders the elements of its conjunctions
+// and disjunctions while it is being evaluated. It samples the pass rate and
+// evaluation time of each element and, at the end of each sampling window,
+// moves the cheapest and most decisive elements first, as Optimize does.
+// Statistics are halved after each window so that the order follows changes in
+// the evaluated params.
+//
+// An Adaptive evaluates to the same result as the expression it wraps, as long
+// as its elements have no side effects, and is safe for concurrent use.
+type Adaptive struct {
+	// Accessed atomically, kept first for alignment on 32-bit platforms.
+	calls   uint64
+	samples uint64
+
+	rate   uint64
+	window uint64
+	now    func() time.Time
+	root   *adaptiveNode
+	mu     sync.Mutex // serializes reordering.
+}
+
+// NewAdaptive returns an Adaptive evaluating e.
+func NewAdaptive(e Exp, opts ...AdaptiveOption) *Adaptive {
+	a := &Adaptive{rate: 16, window: 1024, now: time.Now}
+	for _, opt := range opts {
+		opt(a)
+	}
+	a.root = newAdaptiveNode(e, "")
+	return a
+}
+
+// Eval evaluates the expression against p.
+func (a *Adaptive) Eval(p Params) bool {
+	if atomic.AddUint64(&a.calls, 1)%a.rate != 0 {
+		return a.root.eval(p, nil)
+	}
+	r := a.root.eval(p, a.now)
+	if atomic.AddUint64(&a.samples, 1)%a.window == 0 {
+		a.adapt()
+	}
+	return r
+}
+
+func (a *Adaptive) evalContext(ev *evaluator, p Params) (bool, error) {
+	return ev.eval(a.Exp(), p)
+}
+
+func (a *Adaptive) String() string {
+	return sprintf("%s", a.Exp())
+}
+
+// Exp returns the wrapped expression with its elements in their current order.
+func (a *Adaptive) Exp() Exp {
+	return a.root.current()
+}
+
+// Stats returns the statistics recorded so far, keyed by the paths of elements
+// in the wrapped expression as constructed.
+func (a *Adaptive) Stats() Stats {
+	stats := Stats{}
+	a.root.walk(func(n *adaptiveNode) {
+		for i := range n.stats {
+			stats[childPath(n.path, i)] = n.stats[i].load()
+		}
+	})
+	return stats
+}
+
+func (a *Adaptive) adapt() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.root.walk(func(n *adaptiveNode) {
+		if n.stats == nil {
+			return
+		}
+		stats := make([]NodeStats, len(n.stats))
+		for i := range n.stats {
+			stats[i] = n.stats[i].load()
+			n.stats[i].halve()
+		}
+		n.order.Store(reorder(stats, n.and))
+	})
+}
+
+type adaptiveKind int
+
+const (
+	adaptiveLeaf adaptiveKind = iota
+	adaptiveNot
+	adaptiveGroup
+)
+
+type adaptiveNode struct {
+	kind  adaptiveKind
+	exp   Exp
+	path  string
+	and   bool
+	elems []*adaptiveNode
+	stats []adaptiveStats // one per element of a group.
+	order atomic.Value    // []int, the order of the elements of a group.
+}
+
+func newAdaptiveNode(e Exp, path string) *adaptiveNode {
+	n := &adaptiveNode{exp: e, path: path}
+	var elems []Exp
+	switch e := e.(type) {
+	case expNot:
+		n.kind = adaptiveNot
+		elems = []Exp{e.elem}
+	case expAnd:
+		n.kind, n.and = adaptiveGroup, true
+		elems = e.elems
+	case expOr:
+		if _, _, _, ok := inspectOrEqual(e); !ok {
+			n.kind = adaptiveGroup
+			elems = e.elems
+		}
+	}
+	for i, elem := range elems {
+		n.elems = append(n.elems, newAdaptiveNode(elem, childPath(path, i)))
+	}
+	if n.kind == adaptiveGroup {
+		n.stats = make([]adaptiveStats, len(elems))
+		order := make([]int, len(elems))
+		for i := range order {
+			order[i] = i
+		}
+		n.order.Store(order)
+	}
+	return n
+}
+
+// eval evaluates n against p. If now is not nil, the evaluation is sampled and
+// the elements of groups are timed with it.
+func (n *adaptiveNode) eval(p Params, now func() time.Time) bool {
+	switch n.kind {
+	case adaptiveLeaf:
+		return n.exp.Eval(p)
+	case adaptiveNot:
+		return !n.elems[0].eval(p, now)
+	}
+	for _, i := range n.order.Load().([]int) {
+		var r bool
+		if now != nil {
+			start := now()
+			r = n.elems[i].eval(p, now)
+			n.stats[i].record(r, now().Sub(start))
+		} else {
+			r = n.elems[i].eval(p, nil)
+		}
+		if r != n.and {
+			return r
+		}
+	}
+	return n.and
+}
+
+func (n *adaptiveNode) walk(fn func(*adaptiveNode)) {
+	fn(n)
+	for _, elem := range n.elems {
+		elem.walk(fn)
+	}
+}
+
+func (n *adaptiveNode) current() Exp {
+	switch n.kind {
+	case adaptiveNot:
+		return expNot{n.elems[0].current()}
+	case adaptiveGroup:
+		order := n.order.Load().([]int)
+		elems := make([]Exp, len(order))
+		for i, j := range order {
+			elems[i] = n.elems[j].current()
+		}
+		if n.and {
+			return expAnd{elems}
+		}
+		return expOr{elems}
+	}
+	return n.exp
+}
+
+// adaptiveStats is the concurrent counterpart of NodeStats.
+type adaptiveStats struct {
+	evals, passes, nanos uint64
+}
+
+func (s *adaptiveStats) record(pass bool, d time.Duration) {
+	atomic.AddUint64(&s.evals, 1)
+	if pass {
+		atomic.AddUint64(&s.passes, 1)
+	}
+	if d > 0 {
+		atomic.AddUint64(&s.nanos, uint64(d))
+	}
+}
+
+func (s *adaptiveStats) load() NodeStats {
+	return NodeStats{
+		Evals:  atomic.LoadUint64(&s.evals),
+		Passes: atomic.LoadUint64(&s.passes),
+		Nanos:  atomic.LoadUint64(&s.nanos),
+	}
+}
+
+func (s *adaptiveStats) halve() {
+	for _, v := range []*uint64{&s.evals, &s.passes, &s.nanos} {
+		for {
+			old := atomic.LoadUint64(v)
+			if atomic.CompareAndSwapUint64(v, old, old/2) {
+				break
+			}
+		}
+	}
+}
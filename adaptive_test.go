@@ -0,0 +1,127 @@
+package exp
+
+import (
+	"math/rand"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// tick returns an option giving an Adaptive a clock which advances by a
+// nanosecond whenever it is read, so that the order elements end up in does not
+// depend on how long they actually took.
+func tick() AdaptiveOption {
+	var ns int64
+	return withClock(func() time.Time {
+		ns++
+		return time.Unix(0, ns)
+	})
+}
+
+func TestAdaptive(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, r := range randomRules(100, rnd) {
+		e := Or(r.Exp, Not(And(r.Exp, Match("status", "active"))))
+		a := NewAdaptive(e, SampleRate(1), SampleWindow(4))
+		for i := 0; i < 50; i++ {
+			p := randomParams(rnd)
+			if want, have := e.Eval(p), a.Eval(p); want != have {
+				t.Fatalf("%s: Eval(%v) = %t, want %t", a, p, have, want)
+			}
+		}
+	}
+}
+
+func TestAdaptiveReorder(t *testing.T) {
+	for _, test := range []struct {
+		exp  Exp
+		want string
+	}{
+		{And(Match("a", "x"), Match("b", "x")), "([b==x]∧[a==x])"},
+		{Or(Match("b", "x"), Match("a", "x")), "([a==x]∨[b==x])"},
+		{Not(And(True, Or(False, Match("a", "x")))), "¬(T∧([a==x]∨F))"},
+		{And(Match("b", "x"), Gte("c", 1)), "([b==x]∧([c>1.00]∨[c==1.00]))"},
+	} {
+		a := NewAdaptive(test.exp, SampleRate(1), SampleWindow(10), tick())
+		if have := sprintf("%s", a); have != sprintf("%s", test.exp) {
+			t.Errorf("unexpected initial order %s", have)
+		}
+		for i := 0; i < 10; i++ {
+			a.Eval(Map{"a": "x", "c": "1"})
+		}
+		if have := sprintf("%s", a); have != test.want {
+			t.Errorf("%s reordered to %s, want %s", test.exp, have, test.want)
+		}
+	}
+}
+
+func TestAdaptiveConcurrent(t *testing.T) {
+	e := And(Match("a", "x"), Or(Match("b", "x"), Gt("c", 1)), Not(Match("d", "x")))
+	a := NewAdaptive(e, SampleRate(2), SampleWindow(8))
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			p := Map{"a": "x", "b": []string{"x", "y"}[g%2], "c": "2"}
+			for i := 0; i < 1000; i++ {
+				if !a.Eval(p) {
+					t.Errorf("Eval(%v) = false", p)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	if n := a.Stats()["0"].Evals; n == 0 {
+		t.Error("expected sampled evaluations")
+	}
+}
+
+func TestOptimize(t *testing.T) {
+	e := And(Match("a", "x"), Or(Match("b", "x"), Match("c", "x")), Gte("d", 1))
+	for _, test := range []struct {
+		stats Stats
+		want  string
+	}{
+		{nil, "([a==x]∧([b==x]∨[c==x])∧([d>1.00]∨[d==1.00]))"},
+		{
+			Stats{
+				"0":   {Evals: 100, Passes: 90, Nanos: 1000},
+				"1":   {Evals: 90, Passes: 10, Nanos: 1000},
+				"1.0": {Evals: 90, Passes: 1, Nanos: 900},
+				"1.1": {Evals: 89, Passes: 9, Nanos: 890},
+				"2":   {Evals: 10, Passes: 5, Nanos: 10},
+			},
+			"(([d>1.00]∨[d==1.00])∧([c==x]∨[b==x])∧[a==x])",
+		},
+		{
+			// Cheap elements come first when equally decisive.
+			Stats{
+				"0": {Evals: 10, Passes: 5, Nanos: 10000},
+				"1": {Evals: 10, Passes: 5, Nanos: 100},
+			},
+			"(([b==x]∨[c==x])∧([d>1.00]∨[d==1.00])∧[a==x])",
+		},
+	} {
+		if have := sprintf("%s", Optimize(e, test.stats)); have != test.want {
+			t.Errorf("Optimize(%v) = %s, want %s", test.stats, have, test.want)
+		}
+	}
+}
+
+func TestOptimizeAdaptive(t *testing.T) {
+	e := And(Match("a", "x"), Match("b", "x"))
+	a := NewAdaptive(e, SampleRate(1), SampleWindow(1000), tick())
+	for i := 0; i < 100; i++ {
+		a.Eval(Map{"a": "x"})
+	}
+	want := Stats{"0": {Evals: 100, Passes: 100, Nanos: 100}, "1": {Evals: 100, Nanos: 100}}
+	if stats := a.Stats(); !reflect.DeepEqual(stats, want) {
+		t.Errorf("Stats() = %v, want %v", stats, want)
+	}
+	if have := sprintf("%s", Optimize(e, a.Stats())); have != "([b==x]∧[a==x])" {
+		t.Errorf("unexpected order %s", have)
+	}
+}
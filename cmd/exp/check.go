@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/alexkappa/exp"
+)
+
+var checkCommand = &command{
+	name:  "check",
+	args:  "file...",
+	short: "parse rules and check that each key is used with a single type",
+	run:   runCheck,
+}
+
+// runCheck parses the rules of files, which are rule files if their extension
+// is .rules and hold a single expression otherwise. Problems found are printed
+// and it reports whether there were none.
+func runCheck(c *cli, fs *flag.FlagSet, args []string) (bool, error) {
+	if err := parseArgs(fs, args, 1, -1); err != nil {
+		return false, err
+	}
+	ok := true
+	for _, file := range fs.Args() {
+		problems, err := check(file)
+		if err != nil {
+			return false, err
+		}
+		for _, p := range problems {
+			fmt.Fprintln(c.stdout, p)
+			ok = false
+		}
+	}
+	return ok, nil
+}
+
+// check returns the problems found in file. Errors reading file are returned
+// as such, while errors parsing its rules are problems.
+func check(file string) ([]string, error) {
+	if filepath.Ext(file) != ".rules" {
+		e, err := readExp(file)
+		var pe *os.PathError
+		if errors.As(err, &pe) {
+			return nil, err
+		}
+		if err != nil {
+			return []string{err.Error()}, nil
+		}
+		return checkTypes(file+": ", e), nil
+	}
+	rules, err := exp.ParseFile(file)
+	var fe *exp.FileError
+	if errors.As(err, &fe) {
+		return []string{err.Error()}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var problems []string
+	for _, r := range rules {
+		problems = append(problems, checkTypes(fmt.Sprintf("%s: rule %s: ", file, r.Name), r.Exp)...)
+	}
+	return problems, nil
+}
+
+// keyType is the type of value an expression compares a key with.
+type keyType string
+
+const (
+	typeString keyType = "string"
+	typeNumber keyType = "number"
+	typeDate   keyType = "date"
+	typeIP     keyType = "IP address"
+)
+
+// compatible reports whether a key may be used both as a and b. Dates and IP
+// addresses are matched as strings too.
+func compatible(a, b keyType) bool {
+	return a == b || (a == typeString && b != typeNumber) || (b == typeString && a != typeNumber)
+}
+
+// checkTypes returns a problem, prefixed by prefix, for every key of e which
+// is used with incompatible types.
+func checkTypes(prefix string, e exp.Exp) []string {
+	types := map[string][]keyType{}
+	keyTypes(e, types)
+	keys := make([]string, 0, len(types))
+	for key := range types {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var problems []string
+	for _, key := range keys {
+		ts := types[key]
+	pairs:
+		for i := range ts {
+			for j := i + 1; j < len(ts); j++ {
+				if !compatible(ts[i], ts[j]) {
+					names := make([]string, len(ts))
+					for k, t := range ts {
+						names[k] = string(t)
+					}
+					problems = append(problems, fmt.Sprintf("%skey %q is used as %s", prefix, key, strings.Join(names, " and ")))
+					break pairs
+				}
+			}
+		}
+	}
+	return problems
+}
+
+// keyTypes records the types each key is used with in e.
+func keyTypes(e exp.Exp, types map[string][]keyType) {
+	add := func(key string, t keyType) {
+		for _, have := range types[key] {
+			if have == t {
+				return
+			}
+		}
+		types[key] = append(types[key], t)
+	}
+	n := exp.Inspect(e)
+	switch n.Op {
+	case exp.OpMatch, exp.OpContains, exp.OpContainsAny, exp.OpContainsRune,
+		exp.OpLen, exp.OpCount, exp.OpEqualFold, exp.OpRegexp,
+		exp.OpHasElement, exp.OpIntersects, exp.OpSubsetOf:
+		add(n.Key, typeString)
+	case exp.OpEq, exp.OpGt, exp.OpLt:
+		add(n.Key, typeNumber)
+	case exp.OpOn, exp.OpBefore, exp.OpAfter, exp.OpWeekday, exp.OpDay, exp.OpMonth, exp.OpYear:
+		add(n.Key, typeDate)
+	case exp.OpContainsIP:
+		add(n.Key, typeIP)
+	}
+	for _, elem := range n.Elems {
+		keyTypes(elem, types)
+	}
+}
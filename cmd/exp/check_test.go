@@ -0,0 +1,44 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	dir := files(t, map[string]string{
+		"ok.rule":   `a == 1 && (b == "x" || b =~ "^y") && any tag == "z"`,
+		"bad.rule":  `a == 1 && a == "x" && b > 2`,
+		"syn.rule":  `a ==`,
+		"ok.rules":  "rule a := x == 1\nrule b := a && y == \"z\"",
+		"bad.rules": "rule a := x == 1\nrule b := a && x != \"z\" && size x > 1",
+		"syn.rules": "rule a := x == 1\n  && y ==",
+	})
+	path := func(name string) string { return filepath.Join(dir, name) }
+	for _, test := range []struct {
+		files []string
+		code  int
+		out   string
+	}{
+		{[]string{"ok.rule", "ok.rules"}, 0, ""},
+		{[]string{"bad.rule"}, 1, `bad.rule: key "a" is used as number and string` + "\n"},
+		{[]string{"syn.rule"}, 1, "syn.rule: 1:5 syntax error: unexpected end of input\n"},
+		{[]string{"bad.rules"}, 1, `bad.rules: rule b: key "x" is used as number and string` + "\n"},
+		{[]string{"syn.rules"}, 1, "syn.rules:2:10: syntax error: unexpected end of input\n"},
+	} {
+		args := []string{"check"}
+		for _, f := range test.files {
+			args = append(args, path(f))
+		}
+		code, out, stderr := run(t, "", args...)
+		out = strings.ReplaceAll(out, dir+string(filepath.Separator), "")
+		if code != test.code || out != test.out {
+			t.Errorf("exp check %v = %d, %q, want %d, %q\n%s", test.files, code, out, test.code, test.out, stderr)
+		}
+	}
+
+	if code, _, _ := run(t, "", "check", path("missing.rule")); code != 2 {
+		t.Errorf("exp check of a missing file = %d, want 2", code)
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/alexkappa/exp"
+)
+
+var diffCommand = &command{
+	name:  "diff",
+	args:  "old new",
+	short: "compare two versions of a rule and replay inputs through both",
+	run:   runDiff,
+}
+
+// runDiff compares the rules in the files old and new, which either hold a
+// single expression each or, with -rules, are rule files whose rules are
+// compared by name. It reports whether the rules are the same.
+func runDiff(c *cli, fs *flag.FlagSet, args []string) (bool, error) {
+	var (
+		rules  = fs.Bool("rules", false, "compare rule files, matching rules by name")
+		corpus = fs.String("corpus", "", "replay the JSON objects of `file`, one per line, through both versions")
+		show   = fs.Int("show", 10, "show at most `n` inputs whose outcome flipped")
+	)
+	if err := parseArgs(fs, args, 2, 2); err != nil {
+		return false, err
+	}
+	d := &differ{w: c.stdout, show: *show}
+	if *corpus != "" {
+		var err error
+		if d.corpus, d.records, err = readCorpus(c, *corpus); err != nil {
+			return false, err
+		}
+	}
+	if !*rules {
+		old, err := readExp(fs.Arg(0))
+		if err != nil {
+			return false, err
+		}
+		new, err := readExp(fs.Arg(1))
+		if err != nil {
+			return false, err
+		}
+		return d.diff(old, new, ""), nil
+	}
+	old, err := exp.ParseFile(fs.Arg(0))
+	if err != nil {
+		return false, err
+	}
+	new, err := exp.ParseFile(fs.Arg(1))
+	if err != nil {
+		return false, err
+	}
+	return d.diffRules(old, new), nil
+}
+
+// differ writes the differences between rules to w.
+type differ struct {
+	w       io.Writer
+	show    int
+	corpus  []exp.Params
+	records []string // the text of each input of corpus.
+}
+
+// diff writes the changes between old and new, each line starting with
+// indent, followed by their impact on the corpus. It reports whether there
+// were no changes.
+func (d *differ) diff(old, new exp.Exp, indent string) bool {
+	changes := exp.Diff(old, new)
+	for _, c := range changes {
+		fmt.Fprintf(d.w, "%s%s\n", indent, c)
+	}
+	if len(changes) > 0 && d.corpus != nil {
+		im := exp.Replay(old, new, d.corpus)
+		fmt.Fprintf(d.w, "%s%s\n", indent, im)
+		for i, f := range im.Flips {
+			if i == d.show {
+				fmt.Fprintf(d.w, "%s...\n", indent)
+				break
+			}
+			fmt.Fprintf(d.w, "%sline %d: %t → %t: %s\n", indent, f.Index+1, f.Old, f.New, d.records[f.Index])
+		}
+	}
+	return len(changes) == 0
+}
+
+// diffRules writes the rules added to or removed from old in new, along with
+// the changes of the rules in both. It reports whether there were no changes.
+func (d *differ) diffRules(old, new []exp.Rule) bool {
+	same := true
+	oldByName := make(map[string]exp.Rule, len(old))
+	for _, r := range old {
+		oldByName[r.Name] = r
+	}
+	newNames := make(map[string]bool, len(new))
+	for _, r := range new {
+		newNames[r.Name] = true
+		o, ok := oldByName[r.Name]
+		if !ok {
+			fmt.Fprintf(d.w, "rule %s: added\n", r.Name)
+			same = false
+			continue
+		}
+		if len(exp.Diff(o.Exp, r.Exp)) == 0 {
+			continue
+		}
+		fmt.Fprintf(d.w, "rule %s:\n", r.Name)
+		same = d.diff(o.Exp, r.Exp, "\t") && same
+	}
+	for _, r := range old {
+		if !newNames[r.Name] {
+			fmt.Fprintf(d.w, "rule %s: removed\n", r.Name)
+			same = false
+		}
+	}
+	return same
+}
+
+// readExp parses the expression held by file.
+func readExp(file string) (exp.Exp, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	e, err := exp.Parse(strings.TrimSpace(string(b)))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return e, nil
+}
+
+// readCorpus reads the JSON objects of file, one per line, skipping blank
+// lines. If file is "-", standard input is read. The text of each object is
+// returned along with it.
+func readCorpus(c *cli, file string) ([]exp.Params, []string, error) {
+	r := c.stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	var (
+		corpus  []exp.Params
+		records []string
+	)
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" {
+			continue
+		}
+		p, err := exp.JSON([]byte(line))
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s:%d: %w", file, n, err)
+		}
+		corpus = append(corpus, p)
+		records = append(records, line)
+	}
+	return corpus, records, s.Err()
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	dir := files(t, map[string]string{
+		"old.rule": `country == "GR" && amount > 100`,
+		"new.rule": `country == "GR" && amount > 1000`,
+		"corpus.jsonl": `{"country": "GR", "amount": 50}
+{"country": "GR", "amount": 500}
+
+{"country": "GR", "amount": 5000}
+{"country": "GR", "amount": 700}
+`,
+		"old.rules": "rule a := x == 1\nrule b := x == 2\nrule c := x == 3",
+		"new.rules": "rule a := x == 1\nrule b := x == 4\nrule d := x == 5",
+		"old.prec":  "rule a := x > 100.001",
+		"new.prec":  "rule a := x > 100.004",
+	})
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	for _, test := range []struct {
+		args []string
+		code int
+		out  string
+	}{
+		{[]string{"diff", path("old.rule"), path("old.rule")}, 0, ""},
+		{[]string{"diff", path("old.rule"), path("new.rule")}, 1, "~ 1: amount > 100 → amount > 1000\n"},
+		{
+			[]string{"diff", "-corpus", path("corpus.jsonl"), "-show", "1", path("old.rule"), path("new.rule")},
+			1,
+			`~ 1: amount > 100 → amount > 1000
+2 of 4 inputs flipped: 0 false → true, 2 true → false
+line 2: true → false: {"country": "GR", "amount": 500}
+...
+`,
+		},
+		{
+			[]string{"diff", "-rules", path("old.rules"), path("new.rules")},
+			1,
+			"rule b:\n\t~ root: x == 2 → x == 4\nrule d: added\nrule c: removed\n",
+		},
+		{
+			[]string{"diff", "-rules", path("old.prec"), path("new.prec")},
+			1,
+			"rule a:\n\t~ root: x > 100.001 → x > 100.004\n",
+		},
+	} {
+		code, out, stderr := run(t, "", test.args...)
+		if code != test.code || out != test.out {
+			t.Errorf("exp %s = %d\n%s\nwant %d\n%s\n%s", strings.Join(test.args, " "), code, out, test.code, test.out, stderr)
+		}
+	}
+}
+
+func TestDiffErrors(t *testing.T) {
+	dir := files(t, map[string]string{
+		"bad.rule": `x ==`,
+		"bad.jsonl": `{"x": 1}
+not json`,
+	})
+	for _, test := range []struct {
+		args   []string
+		stderr string
+	}{
+		{[]string{"diff", "one"}, "usage: exp diff [flags] old new"},
+		{[]string{"diff", filepath.Join(dir, "bad.rule"), filepath.Join(dir, "bad.rule")}, "bad.rule: 1:5 syntax error: unexpected end of input"},
+		{[]string{"diff", "-corpus", filepath.Join(dir, "bad.jsonl"), "a", "b"}, "bad.jsonl:2: "},
+	} {
+		code, _, stderr := run(t, "", test.args...)
+		if code != 2 || !strings.Contains(stderr, test.stderr) {
+			t.Errorf("exp %s = %d, %q, want 2, %q", strings.Join(test.args, " "), code, stderr, test.stderr)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/alexkappa/exp"
+	"github.com/alexkappa/exp/internal/shape"
+)
+
+var evalCommand = &command{
+	name:  "eval",
+	args:  "rule [key=value ...]",
+	short: "evaluate a rule against key=value pairs or a JSON object",
+	run:   runEval,
+}
+
+var explainCommand = &command{
+	name:  "explain",
+	args:  "rule [key=value ...]",
+	short: "show how a rule evaluates, element by element",
+	run:   runExplain,
+}
+
+// ruleFlags are the flags of the commands evaluating a rule.
+type ruleFlags struct {
+	file, rule, json *string
+}
+
+func newRuleFlags(fs *flag.FlagSet) ruleFlags {
+	return ruleFlags{
+		file: fs.String("f", "", "read the rule from `file` instead of the first argument"),
+		rule: fs.String("rule", "", "evaluate the rule `name` of the rule file read with -f"),
+		json: fs.String("json", "", "read values from the JSON object in `file`, or standard input if -"),
+	}
+}
+
+// load returns the rule and the params to evaluate it against, as given by
+// the flags and the remaining arguments. Values given as arguments take
+// precedence over those read from JSON.
+func (f ruleFlags) load(c *cli, args []string) (exp.Exp, exp.Params, error) {
+	e, args, err := readRule(*f.file, *f.rule, args)
+	if err != nil {
+		return nil, nil, err
+	}
+	m := make(exp.Map, len(args))
+	for _, arg := range args {
+		k, v, ok := strings.Cut(arg, "=")
+		if !ok {
+			return nil, nil, fmt.Errorf("invalid argument %q, expected key=value", arg)
+		}
+		m[k] = v
+	}
+	if *f.json == "" {
+		return e, m, nil
+	}
+	b, err := readInput(c, *f.json)
+	if err != nil {
+		return nil, nil, err
+	}
+	p, err := exp.JSON(b)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", *f.json, err)
+	}
+	return e, exp.Chain(m, p), nil
+}
+
+// runEval prints the result of evaluating a rule and reports it.
+func runEval(c *cli, fs *flag.FlagSet, args []string) (bool, error) {
+	f := newRuleFlags(fs)
+	quiet := fs.Bool("q", false, "do not print the result, only report it with the exit status")
+	if err := parseArgs(fs, args, 0, -1); err != nil {
+		return false, err
+	}
+	e, p, err := f.load(c, fs.Args())
+	if err == errUsage {
+		fs.Usage()
+	}
+	if err != nil {
+		return false, err
+	}
+	result := e.Eval(p)
+	if !*quiet {
+		fmt.Fprintln(c.stdout, result)
+	}
+	return result, nil
+}
+
+// runExplain prints a trace of the evaluation of a rule, or a graph of it, and
+// reports its result.
+func runExplain(c *cli, fs *flag.FlagSet, args []string) (bool, error) {
+	f := newRuleFlags(fs)
+	graph := fs.String("graph", "", "print a graph in `format` dot or mermaid instead of a trace")
+	if err := parseArgs(fs, args, 0, -1); err != nil {
+		return false, err
+	}
+	e, p, err := f.load(c, fs.Args())
+	if err == errUsage {
+		fs.Usage()
+	}
+	if err != nil {
+		return false, err
+	}
+	switch *graph {
+	case "":
+		result := explain(c.stdout, e, p, "", true)
+		fmt.Fprintln(c.stdout, result)
+		return result, nil
+	case "dot":
+		err = exp.WriteDOT(c.stdout, e, exp.Highlight(p))
+	case "mermaid":
+		err = exp.WriteMermaid(c.stdout, e, exp.Highlight(p))
+	default:
+		return false, fmt.Errorf("unknown graph format %q", *graph)
+	}
+	return e.Eval(p), err
+}
+
+// explain writes a line for e and each of its operands, marked with the
+// result of evaluating them against p, and returns the result of e. Operands
+// which were not evaluated because And or Or short-circuited are marked with
+// a dot. Lines are indented by indent, and reached reports whether the
+// evaluation reached e. Only the leaves are evaluated, the results of And, Or
+// and Not follow from those of their operands.
+func explain(w io.Writer, e exp.Exp, p exp.Params, indent string, reached bool) bool {
+	n := exp.Inspect(e)
+	if _, _, _, ok := shape.OrEqual(n); ok {
+		n = exp.Node{Op: exp.OpUnknown}
+	}
+	var (
+		name            string
+		stop, stoppable bool
+	)
+	switch n.Op {
+	case exp.OpAnd:
+		name, stop, stoppable = "and", false, true
+	case exp.OpOr:
+		name, stop, stoppable = "or", true, true
+	case exp.OpNot:
+		name = "not"
+	default:
+		result := reached && e.Eval(p)
+		fmt.Fprintf(w, "%s%s %s", indent, mark(reached, result), describe(e))
+		if keys := exp.Compile(e).Keys(); len(keys) > 0 {
+			values := make([]string, len(keys))
+			for i, key := range keys {
+				values[i] = fmt.Sprintf("%s = %q", key, p.Get(key))
+			}
+			fmt.Fprintf(w, "  # %s", strings.Join(values, ", "))
+		}
+		fmt.Fprintln(w)
+		return result
+	}
+
+	// The line of e is written once the results of its operands are known.
+	var b strings.Builder
+	result := stoppable && !stop
+	reachedElem := reached
+	for _, elem := range n.Elems {
+		r := explain(&b, elem, p, indent+"  ", reachedElem)
+		switch {
+		case !reachedElem:
+		case stoppable && r == stop:
+			result, reachedElem = stop, false
+		case !stoppable:
+			result = !r
+		}
+	}
+	result = reached && result
+	fmt.Fprintf(w, "%s%s %s\n%s", indent, mark(reached, result), name, b.String())
+	return result
+}
+
+// mark returns the mark of a line of explain.
+func mark(reached, result bool) string {
+	switch {
+	case reached && result:
+		return "✓"
+	case reached:
+		return "✗"
+	}
+	return "·"
+}
+
+// describe returns the text representation of e, or its String if it has
+// none.
+func describe(e exp.Exp) string {
+	if s, err := exp.Format(e); err == nil {
+		return s
+	}
+	return fmt.Sprintf("%s", e)
+}
+
+// ruleFromFile returns the rule name of the rule file file.
+func ruleFromFile(file, name string) (exp.Exp, error) {
+	rules, err := exp.ParseFile(file)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range rules {
+		if r.Name == name {
+			return r.Exp, nil
+		}
+	}
+	return nil, fmt.Errorf("%s: no rule %q", file, name)
+}
+
+// readRule returns the rule name of the rule file file if both are given, the
+// expression held by file if only file is given, or otherwise the expression
+// given by the first of args. The remaining arguments are returned along with
+// the rule.
+func readRule(file, name string, args []string) (exp.Exp, []string, error) {
+	var (
+		e   exp.Exp
+		err error
+	)
+	switch {
+	case file != "" && name != "":
+		e, err = ruleFromFile(file, name)
+	case file != "":
+		e, err = readExp(file)
+	case name != "":
+		return nil, nil, fmt.Errorf("-rule requires -f")
+	case len(args) == 0:
+		return nil, nil, errUsage
+	default:
+		e, err = exp.Parse(args[0])
+		args = args[1:]
+	}
+	return e, args, err
+}
+
+// readInput reads file, or standard input if file is "-".
+func readInput(c *cli, file string) ([]byte, error) {
+	if file == "-" {
+		return io.ReadAll(c.stdin)
+	}
+	return os.ReadFile(file)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alexkappa/exp"
+)
+
+func TestEval(t *testing.T) {
+	dir := files(t, map[string]string{
+		"gr.rule":   `country == "GR"`,
+		"a.rules":   "rule gr := country == \"GR\"\nrule big := gr && amount > 100",
+		"user.json": `{"user": {"country": "GR"}, "amount": 150}`,
+	})
+	for _, test := range []struct {
+		args  []string
+		stdin string
+		code  int
+		out   string
+	}{
+		{[]string{"eval", `country == "GR" && amount > 100`, "country=GR", "amount=150"}, "", 0, "true\n"},
+		{[]string{"eval", `country == "GR" && amount > 100`, "country=GR", "amount=50"}, "", 1, "false\n"},
+		{[]string{"eval", "-q", `country == "GR"`, "country=FR"}, "", 1, ""},
+		{[]string{"eval", "-f", filepath.Join(dir, "gr.rule"), "country=GR"}, "", 0, "true\n"},
+		{[]string{"eval", "-f", filepath.Join(dir, "a.rules"), "-rule", "big", "country=GR", "amount=500"}, "", 0, "true\n"},
+		{[]string{"eval", "-json", filepath.Join(dir, "user.json"), `user.country == "GR" && amount > 100`}, "", 0, "true\n"},
+		{[]string{"eval", "-json", "-", `user.country == "GR"`}, `{"user": {"country": "FR"}}`, 1, "false\n"},
+		{[]string{"eval", "-json", "-", `user.country == "GR"`, "user.country=GR"}, `{"user": {"country": "FR"}}`, 0, "true\n"},
+	} {
+		code, out, stderr := run(t, test.stdin, test.args...)
+		if code != test.code || out != test.out {
+			t.Errorf("exp %s = %d, %q, want %d, %q\n%s", strings.Join(test.args, " "), code, out, test.code, test.out, stderr)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	for _, test := range []struct {
+		args   []string
+		stderr string
+	}{
+		{[]string{"eval"}, "usage: exp eval"},
+		{[]string{"eval", "x =="}, "1:5 syntax error: unexpected end of input"},
+		{[]string{"eval", "x == 1", "x"}, `invalid argument "x", expected key=value`},
+		{[]string{"eval", "-rule", "a"}, "-rule requires -f"},
+		{[]string{"eval", "-json", "-", "x == 1"}, "-: EOF"},
+		{[]string{"explain", "-graph", "svg", "x == 1"}, `unknown graph format "svg"`},
+	} {
+		code, _, stderr := run(t, "", test.args...)
+		if code != 2 || !strings.Contains(stderr, test.stderr) {
+			t.Errorf("exp %s = %d, %q, want 2, %q", strings.Join(test.args, " "), code, stderr, test.stderr)
+		}
+	}
+}
+
+func TestExplain(t *testing.T) {
+	code, out, stderr := run(t, "", "explain",
+		`country == "GR" && (amount > 100 || plan == "pro") && !(x >= 3) && y == 1`,
+		"country=GR", "amount=50", "plan=pro", "x=5")
+	want := `✗ and
+  ✓ country == "GR"  # country = "GR"
+  ✓ or
+    ✗ amount > 100  # amount = "50"
+    ✓ plan == "pro"  # plan = "pro"
+  ✗ not
+    ✓ x >= 3  # x = "5"
+  · y == 1  # y = ""
+false
+`
+	if code != 1 || out != want {
+		t.Errorf("exp explain = %d\n%s\nwant 1\n%s\n%s", code, out, want, stderr)
+	}
+
+	code, out, _ = run(t, "", "explain", "-graph", "dot", "x == 1", "x=1")
+	if code != 0 || !strings.HasPrefix(out, "digraph exp {") {
+		t.Errorf("exp explain -graph dot = %d\n%s", code, out)
+	}
+}
+
+// countExp is true and counts how many times it is evaluated.
+type countExp struct{ n *int }
+
+func (e countExp) Eval(exp.Params) bool { *e.n++; return true }
+func (e countExp) String() string       { return "count" }
+
+func TestExplainEvaluatesLeavesOnce(t *testing.T) {
+	var n int
+	c := countExp{&n}
+	if !explain(io.Discard, exp.Not(exp.And(exp.Or(c, c), exp.Not(c))), exp.Map{}, "", true) {
+		t.Error("explain = false, want true")
+	}
+	if n != 2 {
+		t.Errorf("evaluated %d leaves, want 2", n)
+	}
+}
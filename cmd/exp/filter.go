@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/alexkappa/exp"
+)
+
+var filterCommand = &command{
+	name:  "filter",
+	args:  "rule",
+	short: "print the JSON lines or CSV records of standard input matching a rule",
+	run:   runFilter,
+}
+
+// runFilter writes the records read from standard input for which a rule
+// evaluates to true, and reports whether there were any.
+func runFilter(c *cli, fs *flag.FlagSet, args []string) (bool, error) {
+	var (
+		file    = fs.String("f", "", "read the rule from `file` instead of the first argument")
+		name    = fs.String("rule", "", "filter with the rule `name` of the rule file read with -f")
+		format  = fs.String("format", "json", "input `format`, json for JSON lines or csv for CSV with a header row")
+		count   = fs.Bool("count", false, "print the number of matching records instead of the records")
+		invert  = fs.Bool("invert", false, "select the records which do not match")
+		workers = fs.Int("workers", 1, "evaluate records with `n` goroutines, writing them in input order")
+	)
+	if err := parseArgs(fs, args, 0, 1); err != nil {
+		return false, err
+	}
+	e, rest, err := readRule(*file, *name, fs.Args())
+	if err == nil && len(rest) > 0 {
+		err = errUsage
+	}
+	if err == errUsage {
+		fs.Usage()
+	}
+	if err != nil {
+		return false, err
+	}
+	if *workers < 1 {
+		return false, fmt.Errorf("invalid number of workers %d", *workers)
+	}
+
+	out := c.stdout
+	if *count {
+		out = nil
+	}
+	var in records
+	switch *format {
+	case "json":
+		in = newJSONRecords(c.stdin, out)
+	case "csv":
+		if in, err = newCSVRecords(c.stdin, out); err != nil {
+			return false, err
+		}
+	default:
+		return false, fmt.Errorf("unknown format %q", *format)
+	}
+	f := &filter{exp: e, invert: *invert, workers: *workers}
+	n, err := f.run(in, !*count)
+	if flushErr := in.flush(); err == nil {
+		err = flushErr
+	}
+	if err != nil {
+		return false, err
+	}
+	if *count {
+		fmt.Fprintln(c.stdout, n)
+	}
+	return n > 0, nil
+}
+
+// record is a record of the input and its line number.
+type record struct {
+	line   int
+	data   []byte   // a JSON line.
+	fields []string // a CSV record.
+}
+
+// records reads records from the input and writes them to the output.
+type records interface {
+	// read returns the next record, or io.EOF at the end of the input.
+	read() (record, error)
+	// params returns the Params the rule is evaluated against for r. It may
+	// be called concurrently.
+	params(r record) (exp.Params, error)
+	write(r record) error
+	flush() error
+}
+
+// jsonRecords reads objects from lines of JSON, which are written unchanged.
+type jsonRecords struct {
+	r    *bufio.Reader
+	w    *bufio.Writer
+	line int
+}
+
+func newJSONRecords(r io.Reader, w io.Writer) *jsonRecords {
+	jr := &jsonRecords{r: bufio.NewReader(r)}
+	if w != nil {
+		jr.w = bufio.NewWriter(w)
+	}
+	return jr
+}
+
+// read returns the next line which is not blank.
+func (jr *jsonRecords) read() (record, error) {
+	for {
+		b, err := jr.r.ReadBytes('\n')
+		if len(b) == 0 && err != nil {
+			return record{}, err
+		}
+		jr.line++
+		if b = bytes.TrimSpace(b); len(b) > 0 {
+			return record{line: jr.line, data: b}, nil
+		}
+	}
+}
+
+func (jr *jsonRecords) params(r record) (exp.Params, error) {
+	p, err := exp.JSON(r.data)
+	if err != nil {
+		return nil, fmt.Errorf("line %d: %w", r.line, err)
+	}
+	return p, nil
+}
+
+func (jr *jsonRecords) write(r record) error {
+	jr.w.Write(r.data)
+	return jr.w.WriteByte('\n')
+}
+
+func (jr *jsonRecords) flush() error {
+	if jr.w == nil {
+		return nil
+	}
+	return jr.w.Flush()
+}
+
+// csvRecords reads CSV records, whose fields are named by the header row. The
+// header is written along with the records.
+type csvRecords struct {
+	r      *csv.Reader
+	w      *csv.Writer
+	header []string
+}
+
+func newCSVRecords(r io.Reader, w io.Writer) (*csvRecords, error) {
+	cr := &csvRecords{r: csv.NewReader(r)}
+	header, err := cr.r.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("missing CSV header")
+	}
+	if err != nil {
+		return nil, err
+	}
+	cr.header = header
+	if w != nil {
+		cr.w = csv.NewWriter(w)
+		cr.w.Write(header)
+	}
+	return cr, nil
+}
+
+func (cr *csvRecords) read() (record, error) {
+	fields, err := cr.r.Read()
+	if err != nil {
+		return record{}, err
+	}
+	line, _ := cr.r.FieldPos(0)
+	return record{line: line, fields: fields}, nil
+}
+
+func (cr *csvRecords) params(r record) (exp.Params, error) {
+	m := make(exp.Map, len(cr.header))
+	for i, key := range cr.header {
+		m[key] = r.fields[i]
+	}
+	return m, nil
+}
+
+func (cr *csvRecords) write(r record) error {
+	return cr.w.Write(r.fields)
+}
+
+func (cr *csvRecords) flush() error {
+	if cr.w == nil {
+		return nil
+	}
+	cr.w.Flush()
+	return cr.w.Error()
+}
+
+// batchSize is the number of records evaluated by a worker at a time.
+const batchSize = 256
+
+// readResult is a record read from the input, or the error which ended it.
+type readResult struct {
+	record
+	err error
+}
+
+// batch is a run of consecutive records, evaluated by a single worker.
+type batch struct {
+	records []record
+	match   []bool
+	// n is the number of records evaluated, which is less than the number of
+	// records if err is not nil.
+	n       int
+	err     error
+	readErr error // the error which ended the input after records, if any.
+	done    chan struct{}
+}
+
+// filter evaluates a rule against records using a pool of workers.
+type filter struct {
+	exp     exp.Exp
+	invert  bool
+	workers int
+}
+
+// run evaluates the rule against each record of in and returns the number of
+// records selected, writing them to in if write is true. Records are read and
+// written in order, while batches of them are evaluated concurrently. A batch
+// holds the records read so far, up to batchSize, so that records are written
+// as soon as they are read when the input is slow, such as a log being tailed.
+func (f *filter) run(in records, write bool) (int, error) {
+	var (
+		read    = make(chan readResult, batchSize)
+		work    = make(chan *batch, f.workers)
+		ordered = make(chan *batch, 2*f.workers)
+		stop    = make(chan struct{})
+	)
+	// Stopping early does not wait for the reader, which may be blocked
+	// reading the input.
+	defer close(stop)
+
+	go func() {
+		for {
+			r, err := in.read()
+			select {
+			case read <- readResult{r, err}:
+			case <-stop:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	go func() {
+		defer close(work)
+		defer close(ordered)
+		for eof := false; !eof; {
+			b := &batch{done: make(chan struct{})}
+			// Take the records read so far, waiting only for the first.
+		collect:
+			for len(b.records) < batchSize {
+				var rr readResult
+				select {
+				case rr = <-read:
+				case <-stop:
+					return
+				default:
+					if len(b.records) > 0 {
+						break collect
+					}
+					select {
+					case rr = <-read:
+					case <-stop:
+						return
+					}
+				}
+				if rr.err != nil {
+					if rr.err != io.EOF {
+						b.readErr = rr.err
+					}
+					eof = true
+					break
+				}
+				b.records = append(b.records, rr.record)
+			}
+			select {
+			case ordered <- b:
+			case <-stop:
+				return
+			}
+			select {
+			case work <- b:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	for i := 0; i < f.workers; i++ {
+		go func() {
+			for b := range work {
+				f.eval(b, in)
+				close(b.done)
+			}
+		}()
+	}
+
+	n := 0
+	for b := range ordered {
+		<-b.done
+		for i, r := range b.records[:b.n] {
+			if !b.match[i] {
+				continue
+			}
+			n++
+			if write {
+				if err := in.write(r); err != nil {
+					return n, err
+				}
+			}
+		}
+		if write {
+			if err := in.flush(); err != nil {
+				return n, err
+			}
+		}
+		if b.err != nil {
+			return n, b.err
+		}
+		if b.readErr != nil {
+			return n, b.readErr
+		}
+	}
+	return n, nil
+}
+
+// eval evaluates the rule against the records of b, stopping at the first
+// error.
+func (f *filter) eval(b *batch, in records) {
+	b.match = make([]bool, len(b.records))
+	for i, r := range b.records {
+		p, err := in.params(r)
+		if err != nil {
+			b.err = err
+			return
+		}
+		b.match[i] = f.exp.Eval(p) != f.invert
+		b.n++
+	}
+}
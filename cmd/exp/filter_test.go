@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFilter(t *testing.T) {
+	logs := `{"level": "error", "req": {"path": "/a", "ms": 120}}
+{"level": "info", "req": {"path": "/b", "ms": 20}}
+
+{"level": "error", "req": {"path": "/c", "ms": 5}}
+`
+	csv := `level,path,ms
+error,/a,120
+info,/b,20
+error,"/c,d",5
+`
+	for _, test := range []struct {
+		args  []string
+		stdin string
+		code  int
+		out   string
+	}{
+		{
+			[]string{"filter", `level == "error"`}, logs, 0,
+			`{"level": "error", "req": {"path": "/a", "ms": 120}}
+{"level": "error", "req": {"path": "/c", "ms": 5}}
+`,
+		},
+		{
+			[]string{"filter", "--invert", `level == "error"`}, logs, 0,
+			`{"level": "info", "req": {"path": "/b", "ms": 20}}
+`,
+		},
+		{[]string{"filter", "--count", `req.ms > 10`}, logs, 0, "2\n"},
+		{[]string{"filter", "--count", `req.ms > 1000`}, logs, 1, "0\n"},
+		{[]string{"filter", `level == "debug"`}, logs, 1, ""},
+		{
+			[]string{"filter", "-format", "csv", `level == "error"`}, csv, 0,
+			"level,path,ms\nerror,/a,120\nerror,\"/c,d\",5\n",
+		},
+		{[]string{"filter", "-format", "csv", "-count", "-invert", `ms > 10`}, csv, 0, "1\n"},
+	} {
+		code, out, stderr := run(t, test.stdin, test.args...)
+		if code != test.code || out != test.out {
+			t.Errorf("exp %s = %d\n%s\nwant %d\n%s\n%s", strings.Join(test.args, " "), code, out, test.code, test.out, stderr)
+		}
+	}
+}
+
+func TestFilterWorkers(t *testing.T) {
+	var in, want strings.Builder
+	for i := 0; i < 5000; i++ {
+		line := fmt.Sprintf(`{"n": %d, "tags": ["t%d", "x"]}`, i, i%7)
+		fmt.Fprintln(&in, line)
+		if i%7 != 2 && i > 100 {
+			fmt.Fprintln(&want, line)
+		}
+	}
+	for _, workers := range []string{"1", "4", "16"} {
+		code, out, stderr := run(t, in.String(), "filter", "-workers", workers, `!(tags has "t2") && n > 100`)
+		if code != 0 || out != want.String() {
+			t.Errorf("exp filter -workers %s = %d, %d bytes, want %d bytes\n%s", workers, code, len(out), want.Len(), stderr)
+		}
+	}
+}
+
+// chanWriter sends what is written to it on a channel.
+type chanWriter chan string
+
+func (w chanWriter) Write(p []byte) (int, error) {
+	w <- string(p)
+	return len(p), nil
+}
+
+func TestFilterStreams(t *testing.T) {
+	for _, workers := range []string{"1", "4"} {
+		r, w := io.Pipe()
+		out := make(chanWriter, 10)
+		c := &cli{r, out, io.Discard}
+		done := make(chan int)
+		go func() { done <- c.main([]string{"filter", "-workers", workers, `a == "x"`}) }()
+
+		// The match is written before the input ends.
+		fmt.Fprintln(w, `{"a": "x"}`)
+		select {
+		case s := <-out:
+			if s != "{\"a\": \"x\"}\n" {
+				t.Errorf("exp filter -workers %s wrote %q", workers, s)
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("exp filter -workers %s wrote nothing before the end of the input", workers)
+		}
+		fmt.Fprintln(w, `{"a": "y"}`)
+		w.Close()
+		if code := <-done; code != 0 {
+			t.Errorf("exp filter -workers %s = %d, want 0", workers, code)
+		}
+	}
+}
+
+func TestFilterErrors(t *testing.T) {
+	for _, test := range []struct {
+		args   []string
+		stdin  string
+		out    string
+		stderr string
+	}{
+		{[]string{"filter"}, "", "", "usage: exp filter [flags] rule"},
+		{[]string{"filter", "-format", "xml", "a == 1"}, "", "", `unknown format "xml"`},
+		{[]string{"filter", "-workers", "0", "a == 1"}, "", "", "invalid number of workers 0"},
+		{[]string{"filter", "a == 1"}, "{\"a\": 1}\n\n{\"a\": \n{\"a\": 1}", "{\"a\": 1}\n", "line 3: unexpected EOF"},
+		{[]string{"filter", "-format", "csv", "a == 1"}, "", "", "missing CSV header"},
+		{[]string{"filter", "-format", "csv", "a == 1"}, "a,b\n1,2\n1\n", "a,b\n1,2\n", "record on line 3: wrong number of fields"},
+	} {
+		code, out, stderr := run(t, test.stdin, test.args...)
+		if code != 2 || out != test.out || !strings.Contains(stderr, test.stderr) {
+			t.Errorf("exp %s = %d, %q, %q, want 2, %q, %q", strings.Join(test.args, " "), code, out, stderr, test.out, test.stderr)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/alexkappa/exp"
+	"github.com/alexkappa/exp/parse"
+)
+
+var fmtCommand = &command{
+	name:  "fmt",
+	args:  "[file...]",
+	short: "format rules in their canonical text form",
+	run:   runFmt,
+}
+
+// runFmt formats the expressions held by files, or read from standard input
+// if there are none. With -l, it reports whether they were all formatted.
+//
+// Formatting expands let bindings, since it works on the compiled expression,
+// so -w and -l refuse input using them rather than rewrite it.
+func runFmt(c *cli, fs *flag.FlagSet, args []string) (bool, error) {
+	var (
+		write = fs.Bool("w", false, "write the result to the file instead of standard output")
+		list  = fs.Bool("l", false, "list the files whose formatting differs instead of printing them")
+	)
+	if err := parseArgs(fs, args, 0, -1); err != nil {
+		return false, err
+	}
+	files := fs.Args()
+	if len(files) == 0 {
+		if *write {
+			return false, fmt.Errorf("cannot use -w with standard input")
+		}
+		files = []string{"-"}
+	}
+	same := true
+	for _, file := range files {
+		b, err := readInput(c, file)
+		if err != nil {
+			return false, err
+		}
+		src := strings.TrimSpace(string(b))
+		e, err := exp.Parse(src)
+		if err != nil {
+			return false, fmt.Errorf("%s: %w", file, err)
+		}
+		if (*write || *list) && usesLet(src) {
+			return false, fmt.Errorf("%s: cannot rewrite let bindings, which formatting expands", file)
+		}
+		out, err := exp.Format(e)
+		if err != nil {
+			return false, fmt.Errorf("%s: %w", file, err)
+		}
+		switch {
+		case *list && out != src:
+			fmt.Fprintln(c.stdout, file)
+			same = false
+		case *write && out != src:
+			if err := os.WriteFile(file, []byte(out+"\n"), 0644); err != nil {
+				return false, err
+			}
+		case !*list && !*write:
+			fmt.Fprintln(c.stdout, out)
+		}
+	}
+	return same, nil
+}
+
+// usesLet reports whether the expression src binds names with let.
+func usesLet(src string) bool {
+	t, err := parse.Parse(src)
+	return err == nil && hasLet(t)
+}
+
+func hasLet(t parse.Tree) bool {
+	if t == nil {
+		return false
+	}
+	return t.Value().Type == parse.T_LET || hasLet(t.Left()) || hasLet(t.Right())
+}
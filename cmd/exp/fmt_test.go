@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFmt(t *testing.T) {
+	dir := files(t, map[string]string{
+		"a.rule": `a==1&&(b=="x"||c>2)`,
+		"b.rule": "a == 1\n",
+	})
+	a, b := filepath.Join(dir, "a.rule"), filepath.Join(dir, "b.rule")
+
+	code, out, _ := run(t, `x>=1 && !(y=="z")`, "fmt")
+	if want := "x >= 1 && y != \"z\"\n"; code != 0 || out != want {
+		t.Errorf("exp fmt = %d, %q, want 0, %q", code, out, want)
+	}
+
+	code, out, _ = run(t, "", "fmt", "-l", a, b)
+	if code != 1 || out != a+"\n" {
+		t.Errorf("exp fmt -l = %d, %q, want 1, %q", code, out, a+"\n")
+	}
+
+	if code, out, _ = run(t, "", "fmt", "-w", a, b); code != 0 || out != "" {
+		t.Errorf("exp fmt -w = %d, %q", code, out)
+	}
+	if src, _ := os.ReadFile(a); string(src) != "a == 1 && (b == \"x\" || c > 2)\n" {
+		t.Errorf("exp fmt -w wrote %q", src)
+	}
+	if code, _, _ = run(t, "", "fmt", "-l", a, b); code != 0 {
+		t.Errorf("exp fmt -l after -w = %d, want 0", code)
+	}
+
+	let := filepath.Join(files(t, map[string]string{"let.rule": "let a = x == 1 in a && !a\n"}), "let.rule")
+	for _, flag := range []string{"-w", "-l"} {
+		code, _, stderr := run(t, "", "fmt", flag, let)
+		if code != 2 || !strings.Contains(stderr, "cannot rewrite let bindings") {
+			t.Errorf("exp fmt %s of let = %d, %q, want 2", flag, code, stderr)
+		}
+	}
+	if src, _ := os.ReadFile(let); string(src) != "let a = x == 1 in a && !a\n" {
+		t.Errorf("exp fmt -w rewrote let to %q", src)
+	}
+
+	if code, _, _ = run(t, "x ==", "fmt"); code != 2 {
+		t.Errorf("exp fmt of invalid input = %d, want 2", code)
+	}
+}
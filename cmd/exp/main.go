@@ -0,0 +1,122 @@
+// Command exp works with rules from the shell.
+//
+// Usage:
+//
+//	exp command [flags] [arguments]
+//
+// The commands are:
+//
+//	eval    evaluate a rule against key=value pairs or a JSON object
+//	explain show how a rule evaluates, element by element
+//	check   parse rules and check that each key is used with a single type
+//	fmt     format rules in their canonical text form
+//	diff    compare two versions of a rule and replay inputs through both
+//	filter  print the JSON lines or CSV records of standard input matching a rule
+//
+// Run "exp command -h" for the flags of a command. Commands exit with status
+// 0 on success, 1 if the answer is negative, such as for rules which evaluate
+// to false or differ, and 2 on error.
+//
+//	$ exp eval 'country == "GR" && amount > 100' country=GR amount=150
+//	true
+//	$ echo '{"user": {"country": "GR"}}' | exp eval -json - 'user.country == "GR"'
+//	true
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// command is a subcommand of exp. Its run function reports whether the answer
+// is positive, which determines the exit status.
+type command struct {
+	name  string
+	args  string
+	short string
+	run   func(c *cli, fs *flag.FlagSet, args []string) (bool, error)
+}
+
+var commands = []*command{
+	evalCommand,
+	explainCommand,
+	checkCommand,
+	fmtCommand,
+	diffCommand,
+	filterCommand,
+}
+
+// cli holds the standard streams of the command, so that it may be tested.
+type cli struct {
+	stdin          io.Reader
+	stdout, stderr io.Writer
+}
+
+func main() {
+	os.Exit((&cli{os.Stdin, os.Stdout, os.Stderr}).main(os.Args[1:]))
+}
+
+// main runs the command named by args[0] and returns the exit status.
+func (c *cli) main(args []string) int {
+	if len(args) == 0 {
+		c.usage()
+		return 2
+	}
+	for _, cmd := range commands {
+		if cmd.name != args[0] {
+			continue
+		}
+		fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+		fs.SetOutput(c.stderr)
+		fs.Usage = func() {
+			fmt.Fprintf(c.stderr, "usage: exp %s [flags] %s\n", cmd.name, cmd.args)
+			fs.PrintDefaults()
+		}
+		ok, err := cmd.run(c, fs, args[1:])
+		switch {
+		case err == flag.ErrHelp:
+			return 0
+		case err == errUsage:
+			return 2
+		case err != nil:
+			fmt.Fprintf(c.stderr, "exp %s: %s\n", cmd.name, err)
+			return 2
+		case !ok:
+			return 1
+		}
+		return 0
+	}
+	fmt.Fprintf(c.stderr, "exp: unknown command %q\n", args[0])
+	c.usage()
+	return 2
+}
+
+func (c *cli) usage() {
+	fmt.Fprintf(c.stderr, "usage: exp command [flags] [arguments]\n\ncommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(c.stderr, "  %-8s %s\n", cmd.name, cmd.short)
+	}
+}
+
+// errUsage is returned by commands invoked incorrectly, once the usage of the
+// command has been printed.
+var errUsage = errors.New("usage")
+
+// parseArgs parses the flags of fs from args and checks that at least min and
+// at most max arguments remain, or any number if max is negative.
+func parseArgs(fs *flag.FlagSet, args []string, min, max int) error {
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return err
+		}
+		return errUsage
+	}
+	if fs.NArg() < min || (max >= 0 && fs.NArg() > max) {
+		fs.Usage()
+		return errUsage
+	}
+	return nil
+}
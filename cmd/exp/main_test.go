@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// run runs exp with args and the given standard input, returning its exit
+// status and output.
+func run(t *testing.T, stdin string, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	c := &cli{strings.NewReader(stdin), &stdout, &stderr}
+	code := c.main(args)
+	return code, stdout.String(), stderr.String()
+}
+
+// files writes files to a temporary directory and returns the directory.
+func files(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestUsage(t *testing.T) {
+	for _, test := range []struct {
+		args []string
+		code int
+		out  string
+	}{
+		{nil, 2, "usage: exp command"},
+		{[]string{"nope"}, 2, `exp: unknown command "nope"`},
+		{[]string{"eval", "-h"}, 0, "usage: exp eval [flags] rule [key=value ...]"},
+		{[]string{"eval", "-nope"}, 2, "flag provided but not defined: -nope"},
+		{[]string{"check"}, 2, "usage: exp check [flags] file..."},
+	} {
+		code, _, stderr := run(t, "", test.args...)
+		if code != test.code || !strings.Contains(stderr, test.out) {
+			t.Errorf("exp %s = %d, %q, want %d, %q", strings.Join(test.args, " "), code, stderr, test.code, test.out)
+		}
+	}
+}
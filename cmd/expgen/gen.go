@@ -0,0 +1,502 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"math"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/alexkappa/exp"
+	"github.com/alexkappa/exp/internal/shape"
+)
+
+// rule is a named rule read from a rule file.
+type rule struct {
+	name string // Go identifier of the generated function.
+	file string // file the rule was read from.
+	text string // rule text as parsed by exp.Parse.
+	exp  exp.Exp
+}
+
+// generator generates Go source for a set of rules.
+type generator struct {
+	pkg        string
+	dateFormat string
+
+	imports map[string]bool
+	helpers map[string]bool
+	vars    bytes.Buffer
+	nvars   int
+}
+
+func newGenerator(pkg, dateFormat string) *generator {
+	return &generator{
+		pkg:        pkg,
+		dateFormat: dateFormat,
+		imports:    map[string]bool{"github.com/alexkappa/exp": true},
+		helpers:    map[string]bool{},
+	}
+}
+
+// source returns the formatted Go source implementing rules.
+func (g *generator) source(rules []rule) ([]byte, error) {
+	var body bytes.Buffer
+	for _, r := range rules {
+		if err := g.function(&body, r); err != nil {
+			return nil, fmt.Errorf("%s: %w", r.file, err)
+		}
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by expgen. DO NOT EDIT.\n\npackage %s\n\n", g.pkg)
+	writeImports(&b, g.imports)
+	if g.helpers["expgenDate"] {
+		fmt.Fprintf(&b, "const expgenDateFormat = %q\n\n", g.dateFormat)
+	}
+	if g.vars.Len() > 0 {
+		fmt.Fprintf(&b, "var (\n%s)\n\n", g.vars.Bytes())
+	}
+	b.Write(body.Bytes())
+	for _, name := range sortedKeys(g.helpers) {
+		b.WriteString(helpers[name].src)
+		b.WriteString("\n")
+	}
+	return format.Source(b.Bytes())
+}
+
+func (g *generator) function(w *bytes.Buffer, r rule) error {
+	f := &function{
+		generator: g,
+		uses:      map[string]int{},
+		numeric:   map[string]int{},
+		locals:    map[string]string{},
+		floats:    map[string]string{},
+	}
+	f.count(r.exp)
+
+	// Keys read more than once are fetched a single time up front, and
+	// parsed a single time if they are compared numerically more than once.
+	var prologue bytes.Buffer
+	for _, key := range sortedKeys(f.uses) {
+		if f.uses[key] < 2 {
+			continue
+		}
+		if f.numeric[key] < 2 {
+			local := sprintf("v%d", len(f.locals))
+			f.locals[key] = local
+			fmt.Fprintf(&prologue, "\t%s := p.Get(%q)\n", local, key)
+		}
+	}
+	for _, key := range sortedKeys(f.numeric) {
+		if f.numeric[key] < 2 {
+			continue
+		}
+		f.use("expgenFloat")
+		local := sprintf("f%d", len(f.floats))
+		fmt.Fprintf(&prologue, "\t%s := expgenFloat(%s)\n", local, f.get(key))
+		f.floats[key] = local
+	}
+
+	expr, err := f.expr(r.exp)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "// %s implements the rule in %s:\n//\n", r.name, r.file)
+	for _, line := range strings.Split(strings.TrimSpace(r.text), "\n") {
+		fmt.Fprintf(w, "//\t%s\n", line)
+	}
+	fmt.Fprintf(w, "func %s(p exp.Params) bool {\n%s\treturn %s\n}\n\n", r.name, prologue.Bytes(), expr)
+	return nil
+}
+
+// use marks a helper and its imports as used.
+func (g *generator) use(helper string) {
+	g.helpers[helper] = true
+	for _, imp := range helpers[helper].imports {
+		g.imports[imp] = true
+	}
+}
+
+// declare adds a package level variable initialized to value and returns its
+// name. Values which are expensive to compute are declared once rather than on
+// every evaluation.
+func (g *generator) declare(value string) string {
+	name := sprintf("expgenVar%d", g.nvars)
+	g.nvars++
+	fmt.Fprintf(&g.vars, "\t%s = %s\n", name, value)
+	return name
+}
+
+type function struct {
+	*generator
+	uses    map[string]int    // number of leaves reading each key.
+	numeric map[string]int    // number of numeric leaves reading each key.
+	locals  map[string]string // local variables holding values.
+	floats  map[string]string // local variables holding parsed values.
+}
+
+// count counts how many leaves read each key.
+func (f *function) count(e exp.Exp) {
+	n := exp.Inspect(e)
+	if key, _, _, ok := shape.OrEqual(n); ok {
+		f.uses[key]++
+		f.numeric[key]++
+		return
+	}
+	for _, elem := range n.Elems {
+		f.count(elem)
+	}
+	switch n.Op {
+	case exp.OpBool, exp.OpAnd, exp.OpOr, exp.OpNot:
+	case exp.OpEq, exp.OpGt, exp.OpLt:
+		f.uses[n.Key]++
+		f.numeric[n.Key]++
+	default:
+		f.uses[n.Key]++
+	}
+}
+
+// number returns a Go expression evaluating to the value pointed to by key
+// parsed as a float64.
+func (f *function) number(key string) string {
+	if local, ok := f.floats[key]; ok {
+		return local
+	}
+	f.use("expgenFloat")
+	return sprintf("expgenFloat(%s)", f.get(key))
+}
+
+// get returns a Go expression evaluating to the value pointed to by key.
+func (f *function) get(key string) string {
+	if local, ok := f.locals[key]; ok {
+		return local
+	}
+	return sprintf("p.Get(%q)", key)
+}
+
+func (f *function) join(elems []exp.Exp, sep, empty string) (string, error) {
+	if len(elems) == 0 {
+		return empty, nil
+	}
+	s := make([]string, len(elems))
+	for i, elem := range elems {
+		x, err := f.expr(elem)
+		if err != nil {
+			return "", err
+		}
+		s[i] = x
+	}
+	return "(" + strings.Join(s, sep) + ")", nil
+}
+
+// expr returns a Go boolean expression equivalent to e. And and Or are
+// translated to && and || so the generated code short-circuits the same way
+// expressions do.
+func (f *function) expr(e exp.Exp) (string, error) {
+	n := exp.Inspect(e)
+	if key, v, op, ok := shape.OrEqual(n); ok {
+		cmp := map[exp.Op]string{exp.OpGt: ">=", exp.OpLt: "<="}[op]
+		return sprintf("(%s %s %s)", f.number(key), cmp, f.float(v)), nil
+	}
+	switch n.Op {
+	case exp.OpBool:
+		return strconv.FormatBool(n.Value.(bool)), nil
+	case exp.OpAnd:
+		return f.join(n.Elems, " && ", "true")
+	case exp.OpOr:
+		return f.join(n.Elems, " || ", "false")
+	case exp.OpNot:
+		x, err := f.expr(n.Elems[0])
+		if err != nil {
+			return "", err
+		}
+		return "!" + x, nil
+	}
+
+	v := f.get(n.Key)
+	switch n.Op {
+	case exp.OpMatch:
+		return sprintf("(%s == %q)", v, n.Value), nil
+	case exp.OpContains:
+		f.imports["strings"] = true
+		return sprintf("strings.Contains(%s, %q)", v, n.Value), nil
+	case exp.OpContainsAny:
+		f.imports["strings"] = true
+		return sprintf("strings.ContainsAny(%s, %q)", v, n.Value), nil
+	case exp.OpContainsRune:
+		f.imports["strings"] = true
+		return sprintf("strings.ContainsRune(%s, %q)", v, n.Value), nil
+	case exp.OpLen:
+		return sprintf("(len(%s) == %d)", v, n.N), nil
+	case exp.OpCount:
+		f.imports["strings"] = true
+		return sprintf("(strings.Count(%s, %q) == %d)", v, n.Value, n.N), nil
+	case exp.OpEqualFold:
+		f.imports["strings"] = true
+		return sprintf("strings.EqualFold(%s, %q)", v, n.Value), nil
+	case exp.OpEq, exp.OpGt, exp.OpLt:
+		// expgenFloat returns NaN for values which fail to parse, and every
+		// comparison with NaN is false, matching the behavior of exp.
+		op := map[exp.Op]string{exp.OpEq: "==", exp.OpGt: ">", exp.OpLt: "<"}[n.Op]
+		return sprintf("(%s %s %s)", f.number(n.Key), op, f.float(n.Value.(float64))), nil
+	case exp.OpOn, exp.OpBefore, exp.OpAfter:
+		f.use("expgenDate")
+		t := f.declare(f.time(n.Value.(time.Time)))
+		method := map[exp.Op]string{exp.OpOn: "Equal", exp.OpBefore: "Before", exp.OpAfter: "After"}[n.Op]
+		return sprintf("expgenDate(%s, func(d time.Time) bool { return d.%s(%s) })", v, method, t), nil
+	case exp.OpWeekday:
+		f.use("expgenDate")
+		return sprintf("expgenDate(%s, func(d time.Time) bool { return d.Weekday() == time.%s })", v, n.Value), nil
+	case exp.OpDay:
+		f.use("expgenDate")
+		return sprintf("expgenDate(%s, func(d time.Time) bool { return d.Day() == %d })", v, n.N), nil
+	case exp.OpMonth:
+		f.use("expgenDate")
+		return sprintf("expgenDate(%s, func(d time.Time) bool { return d.Month() == time.%s })", v, n.Value), nil
+	case exp.OpYear:
+		f.use("expgenDate")
+		return sprintf("expgenDate(%s, func(d time.Time) bool { return d.Year() == %d })", v, n.N), nil
+	case exp.OpContainsIP:
+		f.use("expgenCIDR")
+		f.imports["net"] = true
+		cidr := f.declare(sprintf("expgenCIDR(%q)", n.Value.(*net.IPNet)))
+		return sprintf("%s.Contains(net.ParseIP(%s))", cidr, v), nil
+	}
+	return "", fmt.Errorf("unsupported expression %v", e)
+}
+
+func (f *function) float(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		f.imports["math"] = true
+		return "math.NaN()"
+	case math.IsInf(v, 1):
+		f.imports["math"] = true
+		return "math.Inf(1)"
+	case math.IsInf(v, -1):
+		f.imports["math"] = true
+		return "math.Inf(-1)"
+	}
+	s := strconv.FormatFloat(v, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eE") {
+		s += ".0"
+	}
+	return s
+}
+
+func (f *function) time(t time.Time) string {
+	f.imports["time"] = true
+	return sprintf("time.Unix(%d, %d)", t.Unix(), t.Nanosecond())
+}
+
+type helper struct {
+	imports []string
+	src     string
+}
+
+var helpers = map[string]helper{
+	"expgenFloat": {
+		imports: []string{"math", "strconv"},
+		src: `func expgenFloat(s string) float64 {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return math.NaN()
+	}
+	return f
+}
+`,
+	},
+	"expgenDate": {
+		imports: []string{"time"},
+		src: `func expgenDate(s string, fn func(time.Time) bool) bool {
+	d, err := time.Parse(expgenDateFormat, s)
+	if err != nil {
+		return false
+	}
+	return fn(d)
+}
+`,
+	},
+	"expgenCIDR": {
+		imports: []string{"net"},
+		src: `func expgenCIDR(s string) *net.IPNet {
+	_, cidr, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return cidr
+}
+`,
+	},
+}
+
+func writeImports(b *bytes.Buffer, imports map[string]bool) {
+	var std, other []string
+	for _, imp := range sortedKeys(imports) {
+		if strings.Contains(imp, ".") {
+			other = append(other, imp)
+		} else {
+			std = append(std, imp)
+		}
+	}
+	b.WriteString("import (\n")
+	for _, imp := range std {
+		fmt.Fprintf(b, "\t%q\n", imp)
+	}
+	if len(std) > 0 && len(other) > 0 {
+		b.WriteString("\n")
+	}
+	for _, imp := range other {
+		fmt.Fprintf(b, "\t%q\n", imp)
+	}
+	b.WriteString(")\n\n")
+}
+
+// identifier converts a file name such as "high_value" into an exported Go
+// identifier such as "HighValue".
+func identifier(s string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	id := b.String()
+	if id == "" || !unicode.IsLetter([]rune(id)[0]) {
+		id = "Rule" + id
+	}
+	return id
+}
+
+// maxSamples limits the number of parameter sets generated for each rule.
+const maxSamples = 256
+
+// samples returns parameter sets exercising the leaves of e. Each key is given
+// values on and around every operand it is compared to, along with values
+// which fail to parse.
+func samples(e exp.Exp, dateFormat string) []exp.Map {
+	candidates := map[string]map[string]bool{}
+	var collect func(exp.Exp)
+	collect = func(e exp.Exp) {
+		n := exp.Inspect(e)
+		for _, elem := range n.Elems {
+			collect(elem)
+		}
+		switch n.Op {
+		case exp.OpBool, exp.OpAnd, exp.OpOr, exp.OpNot:
+			return
+		}
+		c := candidates[n.Key]
+		if c == nil {
+			c = map[string]bool{"": true, "x": true}
+			candidates[n.Key] = c
+		}
+		switch v := n.Value.(type) {
+		case string:
+			c[v], c[strings.ToUpper(v)], c["_"+v+"_"] = true, true, true
+		case float64:
+			for _, d := range []float64{-1, 0, 1} {
+				c[strconv.FormatFloat(v+d, 'g', -1, 64)] = true
+			}
+		case time.Time:
+			for _, d := range []int{-1, 0, 1} {
+				c[v.AddDate(0, 0, d).Format(dateFormat)] = true
+			}
+		case *net.IPNet:
+			c[v.IP.String()] = true
+			c["255.255.255.255"] = true
+		}
+		switch n.Op {
+		case exp.OpLen, exp.OpDay, exp.OpYear, exp.OpMonth, exp.OpWeekday:
+			c["2014-12-15"], c["1969-07-10"] = true, true
+		}
+	}
+	collect(e)
+
+	keys := sortedKeys(candidates)
+	values := make([][]string, len(keys))
+	total := 1
+	for i, key := range keys {
+		values[i] = sortedKeys(candidates[key])
+		if total <= maxSamples {
+			total *= len(values[i])
+		}
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	var out []exp.Map
+	for i := 0; i < total && i < maxSamples; i++ {
+		m := exp.Map{}
+		x := i
+		for j, key := range keys {
+			if total > maxSamples {
+				m[key] = values[j][rnd.Intn(len(values[j]))]
+				continue
+			}
+			m[key] = values[j][x%len(values[j])]
+			x /= len(values[j])
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+// testSource returns a test file asserting that the generated functions agree
+// with the expressions they were generated from.
+func testSource(pkg, dateFormat string, rules []rule) ([]byte, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by expgen. DO NOT EDIT.\n\npackage %s\n\n", pkg)
+	b.WriteString("import (\n\t\"testing\"\n\n\t\"github.com/alexkappa/exp\"\n)\n\n")
+	b.WriteString("func TestExpgenParity(t *testing.T) {\n")
+	fmt.Fprintf(&b, "\tprev := exp.DateFormat(%q)\n\tdefer exp.DateFormat(prev)\n\n", dateFormat)
+	b.WriteString("\tfor _, test := range []struct {\n\t\tname    string\n\t\ttext    string\n\t\tfn      func(exp.Params) bool\n\t\tsamples []exp.Map\n\t}{\n")
+	for _, r := range rules {
+		fmt.Fprintf(&b, "\t\t{\n\t\t\t%q,\n\t\t\t%q,\n\t\t\t%s,\n\t\t\t[]exp.Map{\n", r.name, r.text, r.name)
+		for _, m := range samples(r.exp, dateFormat) {
+			b.WriteString("\t\t\t\t{")
+			for i, key := range sortedKeys(m) {
+				if i > 0 {
+					b.WriteString(", ")
+				}
+				fmt.Fprintf(&b, "%q: %q", key, m[key])
+			}
+			b.WriteString("},\n")
+		}
+		b.WriteString("\t\t\t},\n\t\t},\n")
+	}
+	b.WriteString("\t} {\n")
+	b.WriteString("\t\te, err := exp.Parse(test.text)\n\t\tif err != nil {\n\t\t\tt.Fatalf(\"%s: %s\", test.name, err)\n\t\t}\n")
+	b.WriteString("\t\tfor _, p := range test.samples {\n")
+	b.WriteString("\t\t\tif want, have := e.Eval(p), test.fn(p); want != have {\n")
+	b.WriteString("\t\t\t\tt.Errorf(\"%s(%v) = %t, want %t\", test.name, p, have, want)\n")
+	b.WriteString("\t\t\t}\n\t\t}\n\t}\n}\n")
+	return format.Source(b.Bytes())
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sprintf(format string, v ...any) string {
+	return fmt.Sprintf(format, v...)
+}
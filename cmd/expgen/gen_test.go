@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexkappa/exp"
+)
+
+func TestIdentifier(t *testing.T) {
+	for in, out := range map[string]string{
+		"high_value":  "HighValue",
+		"eu-country":  "EuCountry",
+		"rule":        "Rule",
+		"2fa.enabled": "Rule2faEnabled",
+		"":            "Rule",
+	} {
+		if id := identifier(in); id != out {
+			t.Errorf("identifier(%q) = %q, want %q", in, id, out)
+		}
+	}
+}
+
+func TestSource(t *testing.T) {
+	_, cidr, _ := net.ParseCIDR("10.0.0.0/8")
+	date := time.Date(2014, time.December, 15, 0, 0, 0, 0, time.UTC)
+
+	src, err := newGenerator("rules", "2006-01-02").source([]rule{
+		{
+			name: "Everything",
+			file: "everything.rule",
+			text: "(amount > 100)",
+			exp: exp.And(
+				exp.Gt("amount", 100),
+				exp.Lte("amount", 200),
+				exp.MatchAny("country", "GR", "CY"),
+				exp.Not(exp.Contains("ref", "bing")),
+				exp.Before("date", date),
+				exp.Month("date", time.December),
+				exp.ContainsIP("ip", cidr),
+			),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"func Everything(p exp.Params) bool {",
+		`f0 := expgenFloat(p.Get("amount"))`,
+		"(f0 > 100.0)",
+		"(f0 <= 200.0)",
+		`v0 := p.Get("country")`,
+		`(v0 == "GR") || (v0 == "CY")`,
+		`!strings.Contains(p.Get("ref"), "bing")`,
+		"expgenVar0 = time.Unix(1418601600, 0)",
+		`expgenVar1 = expgenCIDR("10.0.0.0/8")`,
+		`expgenVar1.Contains(net.ParseIP(p.Get("ip")))`,
+		"d.Month() == time.December",
+	} {
+		if !strings.Contains(string(src), want) {
+			t.Errorf("generated source does not contain %q\n%s", want, src)
+		}
+	}
+}
+
+func TestUnsupported(t *testing.T) {
+	_, err := newGenerator("rules", "2006-01-02").source([]rule{
+		{name: "Custom", file: "custom.rule", exp: exp.And(custom{})},
+	})
+	if err == nil {
+		t.Error("expected error for custom expression")
+	}
+}
+
+type custom struct{}
+
+func (custom) Eval(exp.Params) bool { return true }
+
+// TestParity generates code for the rules in testdata and runs the generated
+// parity tests against it.
+func TestParity(t *testing.T) {
+	dir := goTestDir(t)
+	files, err := filepath.Glob("testdata/*.rule")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = run(files, "rules", filepath.Join(dir, "rules.go"), filepath.Join(dir, "rules_test.go"), "2006-01-02")
+	if err != nil {
+		t.Fatal(err)
+	}
+	goTest(t, dir)
+}
+
+// TestParityConstructed is like TestParity for expressions on dates and
+// networks, which have no text form and are therefore constructed in Go, both
+// here and in the parity test.
+func TestParityConstructed(t *testing.T) {
+	dir := goTestDir(t)
+	_, cidr, _ := net.ParseCIDR("10.0.0.0/8")
+	date := time.Date(2014, time.December, 15, 0, 0, 0, 0, time.UTC)
+
+	var rules []rule
+	var b strings.Builder
+	b.WriteString("package rules\n\nimport (\n\t\"net\"\n\t\"testing\"\n\t\"time\"\n\n\t\"github.com/alexkappa/exp\"\n)\n\n")
+	b.WriteString("func TestConstructed(t *testing.T) {\n")
+	b.WriteString("\tprev := exp.DateFormat(\"2006-01-02\")\n\tdefer exp.DateFormat(prev)\n\n")
+	b.WriteString("\t_, cidr, _ := net.ParseCIDR(\"10.0.0.0/8\")\n")
+	b.WriteString("\tdate := time.Date(2014, time.December, 15, 0, 0, 0, 0, time.UTC)\n\n")
+	b.WriteString("\tfor _, test := range []struct {\n\t\tname    string\n\t\tfn      func(exp.Params) bool\n\t\texp     exp.Exp\n\t\tsamples []exp.Map\n\t}{\n")
+	for _, test := range []struct {
+		name string
+		src  string
+		exp  exp.Exp
+	}{
+		{"On", `exp.On("d", date)`, exp.On("d", date)},
+		{"Before", `exp.Before("d", date)`, exp.Before("d", date)},
+		{"After", `exp.Not(exp.After("d", date))`, exp.Not(exp.After("d", date))},
+		{"Weekday", `exp.Weekday("d", time.Monday)`, exp.Weekday("d", time.Monday)},
+		{"Day", `exp.Day("d", 15)`, exp.Day("d", 15)},
+		{"Month", `exp.Month("d", time.July)`, exp.Month("d", time.July)},
+		{"Year", `exp.Year("d", 2014)`, exp.Year("d", 2014)},
+		{
+			"Network",
+			`exp.Or(exp.ContainsIP("ip", cidr), exp.And(exp.ContainsIP("from", cidr), exp.After("d", date)))`,
+			exp.Or(exp.ContainsIP("ip", cidr), exp.And(exp.ContainsIP("from", cidr), exp.After("d", date))),
+		},
+	} {
+		rules = append(rules, rule{name: test.name, file: "constructed", exp: test.exp})
+		fmt.Fprintf(&b, "\t\t{\n\t\t\t%q,\n\t\t\t%s,\n\t\t\t%s,\n\t\t\t[]exp.Map{\n", test.name, test.name, test.src)
+		for _, m := range samples(test.exp, "2006-01-02") {
+			fmt.Fprintf(&b, "\t\t\t\t%#v,\n", map[string]string(m))
+		}
+		b.WriteString("\t\t\t},\n\t\t},\n")
+	}
+	b.WriteString("\t} {\n\t\tfor _, p := range test.samples {\n")
+	b.WriteString("\t\t\tif want, have := test.exp.Eval(p), test.fn(p); want != have {\n")
+	b.WriteString("\t\t\t\tt.Errorf(\"%s(%v) = %t, want %t\", test.name, p, have, want)\n")
+	b.WriteString("\t\t\t}\n\t\t}\n\t}\n}\n")
+
+	src, err := newGenerator("rules", "2006-01-02").source(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "rules.go"), src, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "rules_test.go"), []byte(b.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	goTest(t, dir)
+}
+
+// goTestDir returns a directory for a module testing generated code, skipping
+// the test in short mode or if the go command is missing.
+func goTestDir(t *testing.T) string {
+	if testing.Short() {
+		t.Skip("skipping go test of generated code in short mode")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not found")
+	}
+	return t.TempDir()
+}
+
+// goTest runs go test in dir, as a module depending on this repository.
+func goTest(t *testing.T, dir string) {
+	root, err := filepath.Abs("../..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gomod := "module rules\n\ngo 1.18\n\n" +
+		"require github.com/alexkappa/exp v0.0.0\n\n" +
+		"replace github.com/alexkappa/exp => " + root + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte(gomod), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command("go", "test", "-mod=mod", ".")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOFLAGS=", "GOPROXY=off", "GOWORK=off")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%s\n%s", err, out)
+	}
+}
@@ -0,0 +1,119 @@
+// Command expgen compiles rules into native Go functions.
+//
+// Each rule file holds a single rule in the text format understood by
+// exp.Parse. For every file expgen generates an exported function named after
+// the file, so rules/high_value.rule becomes
+//
+//	func HighValue(p exp.Params) bool
+//
+// The generated functions evaluate the rule using inlined comparisons and
+// short-circuiting boolean operators, avoiding the interface dispatch of
+// Exp.Eval. Dates and CIDR ranges are computed once when the package is
+// initialized.
+//
+// Usage:
+//
+//	expgen [flags] file...
+//
+// The flags are:
+//
+//	-pkg name
+//		package name of the generated code (default "rules").
+//	-o file
+//		write the generated code to file instead of standard output.
+//	-test file
+//		also write a test asserting that the generated functions agree with
+//		the interpreted rules.
+//	-datefmt layout
+//		date layout the generated code parses dates with (default
+//		"2006-01-02").
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/alexkappa/exp"
+)
+
+func main() {
+	var (
+		pkg        = flag.String("pkg", "rules", "package name of the generated code")
+		out        = flag.String("o", "", "output file (default standard output)")
+		test       = flag.String("test", "", "test output file")
+		dateFormat = flag.String("datefmt", "2006-01-02", "date layout used to parse dates")
+	)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: expgen [flags] file...\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(flag.Args(), *pkg, *out, *test, *dateFormat); err != nil {
+		fmt.Fprintf(os.Stderr, "expgen: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(files []string, pkg, out, test, dateFormat string) error {
+	rules, err := readRules(files)
+	if err != nil {
+		return err
+	}
+
+	src, err := newGenerator(pkg, dateFormat).source(rules)
+	if err != nil {
+		return err
+	}
+	if out == "" {
+		_, err = os.Stdout.Write(src)
+	} else {
+		err = os.WriteFile(out, src, 0644)
+	}
+	if err != nil {
+		return err
+	}
+
+	if test != "" {
+		src, err := testSource(pkg, dateFormat, rules)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(test, src, 0644)
+	}
+	return nil
+}
+
+func readRules(files []string) ([]rule, error) {
+	var (
+		rules []rule
+		names = map[string]string{}
+	)
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		text := strings.TrimSpace(string(b))
+		e, err := exp.Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		base := filepath.Base(file)
+		name := identifier(strings.TrimSuffix(base, filepath.Ext(base)))
+		if prev, ok := names[name]; ok {
+			return nil, fmt.Errorf("%s: rule %s already defined in %s", file, name, prev)
+		}
+		names[name] = file
+		rules = append(rules, rule{name: name, file: base, text: text, exp: e})
+	}
+	return rules, nil
+}
@@ -0,0 +1,302 @@
+package exp
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Program is an expression compiled into a tree of closures. Every distinct key
+// of the expression is assigned a slot, and during evaluation each slot is
+// fetched from Params at most once and parsed at most once per type, no matter
+// how many expressions read it. A Program is itself an Exp and is safe for
+// concurrent use.
+type Program struct {
+	exp    Exp
+	root   func(*frame) bool
+	keys   []string
+	frames *framePool
+}
+
+// Compile compiles e into a Program. Expressions not defined by this package
+// are evaluated by calling their Eval method.
+//
+//	p := Compile(And(Gt("amount", 100), Lt("amount", 500)))
+//	p.Eval(Map{"amount": "150"}) // true, amount is parsed once
+func Compile(e Exp) *Program {
+	c := newCompiler()
+	root := c.compile(e)
+	return &Program{
+		exp:    e,
+		root:   root,
+		keys:   c.keys,
+		frames: newFramePool(c.keys),
+	}
+}
+
+// Eval evaluates the program against p.
+func (prog *Program) Eval(p Params) bool {
+	f := prog.frames.get(p)
+	defer prog.frames.put(f)
+	return prog.root(f)
+}
+
+func (prog *Program) evalContext(ev *evaluator, p Params) (bool, error) {
+	return ev.eval(prog.exp, p)
+}
+
+func (prog *Program) String() string {
+	return sprintf("%s", prog.exp)
+}
+
+// Keys returns the distinct keys read by the program.
+func (prog *Program) Keys() []string {
+	return append([]string(nil), prog.keys...)
+}
+
+// compiler compiles expressions into closures. Expressions compiled by the
+// same compiler share slots, so they can be evaluated against the same frame.
+type compiler struct {
+	keys  []string
+	index map[string]int
+}
+
+func newCompiler() *compiler {
+	return &compiler{index: map[string]int{}}
+}
+
+func (c *compiler) slot(key string) int {
+	i, ok := c.index[key]
+	if !ok {
+		i = len(c.keys)
+		c.index[key] = i
+		c.keys = append(c.keys, key)
+	}
+	return i
+}
+
+func (c *compiler) compileAll(elems []Exp) []func(*frame) bool {
+	fns := make([]func(*frame) bool, len(elems))
+	for i, elem := range elems {
+		fns[i] = c.compile(elem)
+	}
+	return fns
+}
+
+func (c *compiler) compile(e Exp) func(*frame) bool {
+	switch e := e.(type) {
+	case Bool:
+		b := bool(e)
+		return func(*frame) bool { return b }
+	case expAnd:
+		fns := c.compileAll(e.elems)
+		return func(f *frame) bool {
+			for _, fn := range fns {
+				if !fn(f) {
+					return false
+				}
+			}
+			return true
+		}
+	case expOr:
+		fns := c.compileAll(e.elems)
+		return func(f *frame) bool {
+			for _, fn := range fns {
+				if fn(f) {
+					return true
+				}
+			}
+			return false
+		}
+	case expNot:
+		fn := c.compile(e.elem)
+		return func(f *frame) bool { return !fn(f) }
+	case expMatch:
+		i, str := c.slot(e.key), e.str
+		return func(f *frame) bool { return f.str(i) == str }
+	case expContains:
+		i, substr := c.slot(e.key), e.substr
+		return func(f *frame) bool { return strings.Contains(f.str(i), substr) }
+	case expContainsAny:
+		i, chars := c.slot(e.key), e.chars
+		return func(f *frame) bool { return strings.ContainsAny(f.str(i), chars) }
+	case expContainsRune:
+		i, r := c.slot(e.key), e.r
+		return func(f *frame) bool { return strings.ContainsRune(f.str(i), r) }
+	case expLen:
+		i, length := c.slot(e.key), e.length
+		return func(f *frame) bool { return len(f.str(i)) == length }
+	case expCount:
+		i, sep, count := c.slot(e.key), e.sep, e.count
+		return func(f *frame) bool { return strings.Count(f.str(i), sep) == count }
+	case expEqualFold:
+		i, s := c.slot(e.key), e.s
+		return func(f *frame) bool { return strings.EqualFold(f.str(i), s) }
+	case expEq:
+		i, value := c.slot(e.key), e.value
+		return func(f *frame) bool {
+			v, ok := f.num(i)
+			return ok && v == value
+		}
+	case expGt:
+		i, value := c.slot(e.key), e.value
+		return func(f *frame) bool {
+			v, ok := f.num(i)
+			return ok && v > value
+		}
+	case expLt:
+		i, value := c.slot(e.key), e.value
+		return func(f *frame) bool {
+			v, ok := f.num(i)
+			return ok && v < value
+		}
+	case expOn:
+		i, date := c.slot(e.key), e.date
+		return func(f *frame) bool {
+			d, ok := f.date(i)
+			return ok && d.Equal(date)
+		}
+	case expBefore:
+		i, date := c.slot(e.key), e.date
+		return func(f *frame) bool {
+			d, ok := f.date(i)
+			return ok && d.Before(date)
+		}
+	case expAfter:
+		i, date := c.slot(e.key), e.date
+		return func(f *frame) bool {
+			d, ok := f.date(i)
+			return ok && d.After(date)
+		}
+	case expWeekday:
+		i, weekday := c.slot(e.key), e.weekday
+		return func(f *frame) bool {
+			d, ok := f.date(i)
+			return ok && d.Weekday() == weekday
+		}
+	case expDay:
+		i, day := c.slot(e.key), e.day
+		return func(f *frame) bool {
+			d, ok := f.date(i)
+			return ok && d.Day() == day
+		}
+	case expMonth:
+		i, month := c.slot(e.key), e.month
+		return func(f *frame) bool {
+			d, ok := f.date(i)
+			return ok && d.Month() == month
+		}
+	case expYear:
+		i, year := c.slot(e.key), e.year
+		return func(f *frame) bool {
+			d, ok := f.date(i)
+			return ok && d.Year() == year
+		}
+	case expContainsIP:
+		i, cidr := c.slot(e.key), e.cidr
+		return func(f *frame) bool { return cidr.Contains(f.ip(i)) }
+	case expRegexp:
+		i, re := c.slot(e.key), e.re
+		return func(f *frame) bool { return re.MatchString(f.str(i)) }
+	}
+	return func(f *frame) bool { return e.Eval(f.p) }
+}
+
+// framePool recycles frames so that evaluations do not allocate.
+type framePool struct {
+	pool sync.Pool
+}
+
+func newFramePool(keys []string) *framePool {
+	fp := &framePool{}
+	fp.pool.New = func() any {
+		return &frame{keys: keys, slots: make([]slot, len(keys))}
+	}
+	return fp
+}
+
+// get returns a frame ready to evaluate against p.
+func (fp *framePool) get(p Params) *frame {
+	f := fp.pool.Get().(*frame)
+	f.p = p
+	for i := range f.slots {
+		f.slots[i].flags = 0
+	}
+	return f
+}
+
+func (fp *framePool) put(f *frame) {
+	f.p = nil
+	fp.pool.Put(f)
+}
+
+// frame holds the state of a single evaluation.
+type frame struct {
+	p     Params
+	keys  []string
+	slots []slot
+}
+
+// slot caches the value of a key along with its parsed representations.
+type slot struct {
+	flags uint8
+	str   string
+	num   float64
+	date  time.Time
+	ip    net.IP
+}
+
+const (
+	slotStr uint8 = 1 << iota
+	slotNum
+	slotNumOK
+	slotDate
+	slotDateOK
+	slotIP
+)
+
+func (f *frame) str(i int) string {
+	s := &f.slots[i]
+	if s.flags&slotStr == 0 {
+		s.str = f.p.Get(f.keys[i])
+		s.flags |= slotStr
+	}
+	return s.str
+}
+
+func (f *frame) num(i int) (float64, bool) {
+	s := &f.slots[i]
+	if s.flags&slotNum == 0 {
+		v, err := strconv.ParseFloat(f.str(i), 64)
+		s.num = v
+		s.flags |= slotNum
+		if err == nil {
+			s.flags |= slotNumOK
+		}
+	}
+	return s.num, s.flags&slotNumOK != 0
+}
+
+func (f *frame) date(i int) (time.Time, bool) {
+	s := &f.slots[i]
+	if s.flags&slotDate == 0 {
+		d, err := time.Parse(dateFormat, f.str(i))
+		s.date = d
+		s.flags |= slotDate
+		if err == nil {
+			s.flags |= slotDateOK
+		}
+	}
+	return s.date, s.flags&slotDateOK != 0
+}
+
+func (f *frame) ip(i int) net.IP {
+	s := &f.slots[i]
+	if s.flags&slotIP == 0 {
+		s.ip = net.ParseIP(f.str(i))
+		s.flags |= slotIP
+	}
+	return s.ip
+}
@@ -0,0 +1,127 @@
+package exp
+
+import (
+	"net"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestCompile(t *testing.T) {
+	_, cidr, _ := net.ParseCIDR("192.168.1.0/24")
+	date := time.Date(2014, time.December, 15, 0, 0, 0, 0, time.UTC)
+
+	params := []Map{
+		{},
+		{"foo": "bar", "num": "5", "date": "2014-12-15", "ip": "192.168.1.20"},
+		{"foo": "baz", "num": "x", "date": "1969-07-10", "ip": "10.0.0.1"},
+		{"foo": "BAR", "num": "23", "date": "2033-03-09", "ip": "x"},
+	}
+	for _, e := range []Exp{
+		True,
+		And(),
+		Or(),
+		Not(False),
+		Match("foo", "bar"),
+		MatchAny("foo", "baz", "qux"),
+		And(Contains("foo", "a"), ContainsAny("foo", "zr"), ContainsRune("foo", 'b')),
+		Or(Len("foo", 3), Count("foo", "a", 1), EqualFold("foo", "bar")),
+		And(Gte("num", 5), Lte("num", 23), Neq("num", 6)),
+		Or(On("date", date), Before("date", date), After("date", date)),
+		And(Weekday("date", time.Monday), Day("date", 15), Month("date", time.December), Year("date", 2014)),
+		ContainsIP("ip", cidr),
+		expRegexp{"foo", regexp.MustCompile("^ba")},
+		And(Not(Match("foo", "baz")), Or(Gt("num", 10), custom{})),
+	} {
+		prog := Compile(e)
+		for _, p := range params {
+			if want, have := e.Eval(p), prog.Eval(p); want != have {
+				t.Errorf("Compile(%s).Eval(%v) = %t, want %t", e, p, have, want)
+			}
+		}
+	}
+}
+
+func TestCompileKeys(t *testing.T) {
+	prog := Compile(And(Gt("a", 1), Lt("a", 5), Match("b", "x"), Or(Eq("a", 3), Match("c", "y"))))
+	if keys := prog.Keys(); !reflect.DeepEqual(keys, []string{"a", "b", "c"}) {
+		t.Errorf("unexpected keys %q", keys)
+	}
+	if s := prog.String(); s != "([a>1.00]∧[a<5.00]∧[b==x]∧([a==3.00]∨[c==y]))" {
+		t.Errorf("unexpected string %q", s)
+	}
+}
+
+func TestCompileFetchOnce(t *testing.T) {
+	p := &countingParams{Map: Map{"amount": "150"}, gets: map[string]int{}}
+	Compile(And(Gt("amount", 100), Lt("amount", 500), Neq("amount", 120))).Eval(p)
+	if n := p.gets["amount"]; n != 1 {
+		t.Errorf("amount was fetched %d times", n)
+	}
+}
+
+type custom struct{}
+
+func (custom) Eval(p Params) bool { return p.Get("foo") == "bar" }
+
+type countingParams struct {
+	Map
+	gets map[string]int
+}
+
+func (p *countingParams) Get(key string) string {
+	p.gets[key]++
+	return p.Map.Get(key)
+}
+
+// benchmarkRule returns a rule with 50 leaves over 8 keys, similar in shape to
+// rules written to qualify transactions.
+func benchmarkRule() Exp {
+	_, cidr, _ := net.ParseCIDR("10.0.0.0/8")
+	since := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	var groups []Exp
+	for i := 0; i < 5; i++ {
+		n := float64(i * 100)
+		groups = append(groups, And(
+			Gte("amount", n),
+			Lt("amount", n+1000),
+			Match("country", "CY"),
+			Not(Match("status", "blocked")),
+			Contains("referrer", "example.com"),
+			After("created", since),
+			ContainsIP("ip", cidr),
+			Gt("score", float64(i)),
+			Lt("items", 50),
+		))
+	}
+	return Or(groups...)
+}
+
+var benchmarkParams = Map{
+	"amount":   "450.50",
+	"country":  "CY",
+	"status":   "active",
+	"referrer": "https://www.example.com/landing",
+	"created":  "2023-06-01",
+	"ip":       "10.1.2.3",
+	"score":    "0.5",
+	"items":    "60",
+}
+
+func BenchmarkEval(b *testing.B) {
+	e := benchmarkRule()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		e.Eval(benchmarkParams)
+	}
+}
+
+func BenchmarkCompile(b *testing.B) {
+	prog := Compile(benchmarkRule())
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		prog.Eval(benchmarkParams)
+	}
+}
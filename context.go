@@ -0,0 +1,153 @@
+package exp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrBudgetExceeded is returned by EvalContext when an evaluation visits more
+// nodes or takes longer than allowed by its options.
+var ErrBudgetExceeded = errors.New("exp: evaluation budget exceeded")
+
+// ContextExp is implemented by expressions which can be cancelled, for example
+// custom expressions performing slow lookups. EvalContext passes them its
+// context, which is also cancelled when the time budget runs out.
+type ContextExp interface {
+	Exp
+	EvalContext(context.Context, Params) (bool, error)
+}
+
+// EvalOption configures EvalContext.
+type EvalOption func(*evaluator)
+
+// MaxNodes limits the number of expressions an evaluation may visit. Every
+// And, Or, Not and leaf counts as one node, including those evaluated by Any
+// and All for each value and those of compiled and adaptive expressions.
+func MaxNodes(n int) EvalOption {
+	return func(ev *evaluator) {
+		ev.maxNodes = n
+	}
+}
+
+// MaxTime limits the time an evaluation may take.
+func MaxTime(d time.Duration) EvalOption {
+	return func(ev *evaluator) {
+		ev.maxTime = d
+	}
+}
+
+// EvalContext evaluates e against p, like e.Eval(p), but gives up once ctx is
+// done or the budget set by opts is exceeded. And, Or and Not are walked by
+// EvalContext itself, as are the expressions wrapped by Any, All, a Program
+// or an Adaptive. Expressions implementing ContextExp are passed the context
+// and all other expressions are evaluated by their Eval method. An Adaptive
+// does not record statistics for evaluations by EvalContext.
+//
+// If ctx is done the error is ctx.Err(). If the budget is exceeded the error
+// wraps ErrBudgetExceeded.
+//
+//	ok, err := exp.EvalContext(r.Context(), e, p, exp.MaxNodes(1000), exp.MaxTime(10*time.Millisecond))
+//	if errors.Is(err, exp.ErrBudgetExceeded) {
+//		// the rule is too expensive
+//	}
+func EvalContext(ctx context.Context, e Exp, p Params, opts ...EvalOption) (bool, error) {
+	ev := &evaluator{parent: ctx, ctx: ctx}
+	for _, opt := range opts {
+		opt(ev)
+	}
+	if ev.maxTime > 0 {
+		ev.deadline = time.Now().Add(ev.maxTime)
+		var cancel context.CancelFunc
+		ev.ctx, cancel = context.WithDeadline(ctx, ev.deadline)
+		defer cancel()
+	}
+	if err := ev.check(); err != nil {
+		return false, err
+	}
+	return ev.eval(e, p)
+}
+
+// checkInterval is the number of nodes visited between checks of the context
+// and the clock.
+const checkInterval = 16
+
+// contextWalker is implemented by the expressions of this package which wrap
+// others, so that EvalContext applies its budget to the wrapped expressions
+// rather than calling Eval on them.
+type contextWalker interface {
+	evalContext(ev *evaluator, p Params) (bool, error)
+}
+
+type evaluator struct {
+	parent   context.Context
+	ctx      context.Context // parent, with the deadline of the time budget.
+	maxNodes int
+	maxTime  time.Duration
+	deadline time.Time
+	nodes    int
+}
+
+func (ev *evaluator) check() error {
+	if err := ev.parent.Err(); err != nil {
+		return err
+	}
+	if ev.maxTime > 0 && !time.Now().Before(ev.deadline) {
+		return fmt.Errorf("%w: took longer than %s", ErrBudgetExceeded, ev.maxTime)
+	}
+	return nil
+}
+
+func (ev *evaluator) eval(e Exp, p Params) (bool, error) {
+	if w, ok := e.(contextWalker); ok {
+		return w.evalContext(ev, p)
+	}
+	ev.nodes++
+	if ev.maxNodes > 0 && ev.nodes > ev.maxNodes {
+		return false, fmt.Errorf("%w: visited more than %d nodes", ErrBudgetExceeded, ev.maxNodes)
+	}
+	if ev.nodes%checkInterval == 0 {
+		if err := ev.check(); err != nil {
+			return false, err
+		}
+	}
+	switch e := e.(type) {
+	case expAnd:
+		for _, elem := range e.elems {
+			ok, err := ev.eval(elem, p)
+			if err != nil || !ok {
+				return false, err
+			}
+		}
+		return true, nil
+	case expOr:
+		for _, elem := range e.elems {
+			ok, err := ev.eval(elem, p)
+			if err != nil || ok {
+				return ok, err
+			}
+		}
+		return false, nil
+	case expNot:
+		ok, err := ev.eval(e.elem, p)
+		if err != nil {
+			return false, err
+		}
+		return !ok, nil
+	case ContextExp:
+		ok, err := e.EvalContext(ev.ctx, p)
+		if err != nil {
+			// The deadline of the time budget surfaces as a context error,
+			// report it as exceeding the budget instead.
+			if errors.Is(err, context.DeadlineExceeded) {
+				if budget := ev.check(); budget != nil {
+					return false, budget
+				}
+			}
+			return false, err
+		}
+		return ok, nil
+	}
+	return e.Eval(p), nil
+}
@@ -0,0 +1,125 @@
+package exp
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// sleep is an expression which takes d to evaluate to true, unless its context
+// is done first.
+type sleep struct{ d time.Duration }
+
+func (s sleep) Eval(p Params) bool {
+	time.Sleep(s.d)
+	return true
+}
+
+func (s sleep) EvalContext(ctx context.Context, p Params) (bool, error) {
+	select {
+	case <-time.After(s.d):
+		return true, nil
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+}
+
+func TestEvalContext(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, r := range randomRules(100, rnd) {
+		e := Or(r.Exp, Not(And(r.Exp, Match("status", "active"))))
+		for i := 0; i < 20; i++ {
+			p := randomParams(rnd)
+			ok, err := EvalContext(context.Background(), e, p, MaxNodes(100), MaxTime(time.Minute))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := e.Eval(p); ok != want {
+				t.Fatalf("EvalContext(%s, %v) = %t, want %t", e, p, ok, want)
+			}
+		}
+	}
+}
+
+func TestEvalContextBudget(t *testing.T) {
+	wide := make([]Exp, 100)
+	for i := range wide {
+		wide[i] = True
+	}
+	slow := make([]Exp, 100)
+	for i := range slow {
+		slow[i] = Not(struct{ Exp }{sleep{time.Millisecond}})
+	}
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, test := range []struct {
+		ctx  context.Context
+		exp  Exp
+		opts []EvalOption
+		want bool
+		err  error
+	}{
+		{context.Background(), And(wide...), []EvalOption{MaxNodes(101)}, true, nil},
+		{context.Background(), And(wide...), []EvalOption{MaxNodes(100)}, false, ErrBudgetExceeded},
+		{context.Background(), Not(Or(False, True)), []EvalOption{MaxNodes(4)}, false, nil},
+		{context.Background(), Not(Or(False, True)), []EvalOption{MaxNodes(3)}, false, ErrBudgetExceeded},
+		{context.Background(), And(sleep{time.Hour}), []EvalOption{MaxTime(10 * time.Millisecond)}, false, ErrBudgetExceeded},
+		{context.Background(), Or(slow...), []EvalOption{MaxTime(5 * time.Millisecond)}, false, ErrBudgetExceeded},
+		{cancelled, True, nil, false, context.Canceled},
+		{cancelled, sleep{time.Hour}, []EvalOption{MaxTime(time.Hour)}, false, context.Canceled},
+	} {
+		ok, err := EvalContext(test.ctx, test.exp, Map{}, test.opts...)
+		if ok != test.want || !errors.Is(err, test.err) || (err == nil) != (test.err == nil) {
+			t.Errorf("EvalContext(%s) = %t, %v, want %t, %v", test.exp, ok, err, test.want, test.err)
+		}
+	}
+}
+
+func TestEvalContextWrapped(t *testing.T) {
+	wide := make([]Exp, 10)
+	for i := range wide {
+		wide[i] = True
+	}
+	p := Values(map[string][]string{"tag": {"a", "b", "c"}})
+	// Let bindings are shared subtrees, walked at every reference.
+	let, err := Parse(`let a = x == 1 && y == 2 in a || a`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		exp  Exp
+		want int // the smallest budget evaluating exp.
+	}{
+		{Any("tag", And(Match("tag", "c"), And(wide...))), 2 + 2 + 13},
+		{All("tag", And(wide...)), 3 * 11},
+		{Compile(And(wide...)), 11},
+		{NewAdaptive(And(wide...)), 11},
+		{Compile(Any("tag", Not(And(wide...)))), 3 * 12},
+		{let, 5},
+	} {
+		if _, err := EvalContext(context.Background(), test.exp, p, MaxNodes(test.want)); err != nil {
+			t.Errorf("EvalContext(%s, MaxNodes(%d)) = %v", test.exp, test.want, err)
+		}
+		if _, err := EvalContext(context.Background(), test.exp, p, MaxNodes(test.want-1)); !errors.Is(err, ErrBudgetExceeded) {
+			t.Errorf("EvalContext(%s, MaxNodes(%d)) = %v, want ErrBudgetExceeded", test.exp, test.want-1, err)
+		}
+	}
+
+	// The operand of a quantifier is cancelled with the evaluation.
+	_, err = EvalContext(context.Background(), Any("tag", sleep{time.Hour}), p, MaxTime(10*time.Millisecond))
+	if !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestEvalContextCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	_, err := EvalContext(ctx, And(True, sleep{time.Hour}), Map{})
+	if !errors.Is(err, context.Canceled) || errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
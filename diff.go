@@ -0,0 +1,255 @@
+package exp
+
+import "strings"
+
+// ChangeKind describes how an element differs between two expressions.
+type ChangeKind int
+
+const (
+	// Added elements are only present in the new expression.
+	Added ChangeKind = iota + 1
+	// Removed elements are only present in the old expression.
+	Removed
+	// Changed elements are present in both expressions, with different
+	// operators or operands.
+	Changed
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	case Changed:
+		return "changed"
+	}
+	return sprintf("ChangeKind(%d)", int(k))
+}
+
+// Change is a difference between two expressions, as returned by Diff.
+type Change struct {
+	Kind ChangeKind
+	// Path locates the element in the new expression, or in the old one if it
+	// was removed, in the format of the keys of Stats. The root has an empty
+	// path.
+	Path string
+	// Old and New are the element in the old and new expression. Old is nil if
+	// the element was added and New is nil if it was removed.
+	Old, New Exp
+}
+
+// String returns a line describing the change, such as
+//
+//	~ 1: amount > 100 → amount > 1000
+func (c Change) String() string {
+	path := c.Path
+	if path == "" {
+		path = "root"
+	}
+	switch c.Kind {
+	case Added:
+		return sprintf("+ %s: %s", path, describeExp(c.New))
+	case Removed:
+		return sprintf("- %s: %s", path, describeExp(c.Old))
+	}
+	return sprintf("~ %s: %s → %s", path, describeExp(c.Old), describeExp(c.New))
+}
+
+// Diff compares the old and new versions of an expression and returns the
+// elements which were added, removed or changed, in the order they appear.
+//
+// The elements of And and Or are matched by their operators and operands, so
+// that reordering
+// or inserting elements only reports the elements affected. Unmatched elements
+// of old and new found between matched ones are compared pairwise, and the
+// remainder is reported as removed or added. Elements of Not, Any and All are
+// compared recursively, while any other expression is compared as a whole and
+// reported as changed if it differs.
+//
+//	old, _ := exp.Parse(`country == "GR" && amount > 100`)
+//	new, _ := exp.Parse(`country == "GR" && amount > 1000 && trial != "yes"`)
+//	for _, c := range exp.Diff(old, new) {
+//		fmt.Println(c) // ~ 1: amount > 100 → amount > 1000, + 2: trial != "yes"
+//	}
+func Diff(old, new Exp) []Change {
+	var changes []Change
+	diff(&changes, old, new, "")
+	return changes
+}
+
+func diff(changes *[]Change, old, new Exp, path string) {
+	if diffKey(old) == diffKey(new) {
+		return
+	}
+	oldElems, oldOk := diffElems(old)
+	newElems, newOk := diffElems(new)
+	if !oldOk || !newOk || !sameOperator(old, new) {
+		*changes = append(*changes, Change{Kind: Changed, Path: path, Old: old, New: new})
+		return
+	}
+	diffLists(changes, oldElems, newElems, path)
+}
+
+// describeExp returns the text representation of e, or its String if it has
+// none.
+func describeExp(e Exp) string {
+	if s, err := Format(e); err == nil {
+		return s
+	}
+	return sprintf("%s", e)
+}
+
+// diffKey returns a string identifying e, by which Diff compares expressions.
+// Unlike String, which rounds numbers, it tells apart any two expressions with
+// different operands.
+func diffKey(e Exp) string {
+	if s, err := Format(e); err == nil {
+		return s
+	}
+	n := Inspect(e)
+	switch {
+	case n.Op == OpUnknown:
+		return sprintf("%s", e)
+	case n.Elems == nil:
+		return sprintf("%s(%q, %v, %d)", n.Op, n.Key, n.Value, n.N)
+	}
+	keys := make([]string, len(n.Elems))
+	for i, elem := range n.Elems {
+		keys[i] = diffKey(elem)
+	}
+	return sprintf("%s(%q, %s)", n.Op, n.Key, strings.Join(keys, ", "))
+}
+
+// diffElems returns the elements of e compared by Diff, if it is an operator.
+func diffElems(e Exp) ([]Exp, bool) {
+	if _, _, _, ok := inspectOrEqual(e); ok {
+		return nil, false
+	}
+	switch n := Inspect(e); n.Op {
+	case OpAnd, OpOr, OpNot, OpAny, OpAll:
+		return n.Elems, true
+	}
+	return nil, false
+}
+
+// sameOperator reports whether old and new are the same operator, quantifying
+// the same key in the case of Any and All.
+func sameOperator(old, new Exp) bool {
+	o, n := Inspect(old), Inspect(new)
+	return o.Op == n.Op && o.Key == n.Key
+}
+
+// diffLists compares the elements of two operators. Elements are matched using
+// their longest common subsequence.
+func diffLists(changes *[]Change, old, new []Exp, path string) {
+	oldStr := make([]string, len(old))
+	for i, e := range old {
+		oldStr[i] = diffKey(e)
+	}
+	newStr := make([]string, len(new))
+	for j, e := range new {
+		newStr[j] = diffKey(e)
+	}
+	// lcs[i][j] is the length of the longest common subsequence of old[i:] and
+	// new[j:].
+	lcs := make([][]int, len(old)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(new)+1)
+	}
+	for i := len(old) - 1; i >= 0; i-- {
+		for j := len(new) - 1; j >= 0; j-- {
+			if oldStr[i] == newStr[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	i, j := 0, 0
+	i0, j0 := 0, 0 // the unmatched elements since the last match.
+	flush := func() {
+		for ; i0 < i && j0 < j; i0, j0 = i0+1, j0+1 {
+			diff(changes, old[i0], new[j0], childPath(path, j0))
+		}
+		for ; i0 < i; i0++ {
+			*changes = append(*changes, Change{Kind: Removed, Path: childPath(path, i0), Old: old[i0]})
+		}
+		for ; j0 < j; j0++ {
+			*changes = append(*changes, Change{Kind: Added, Path: childPath(path, j0), New: new[j0]})
+		}
+	}
+	for i < len(old) && j < len(new) {
+		switch {
+		case oldStr[i] == newStr[j]:
+			flush()
+			i, j = i+1, j+1
+			i0, j0 = i, j
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	i, j = len(old), len(new)
+	flush()
+}
+
+// Flip is an input whose outcome differs between two versions of an
+// expression.
+type Flip struct {
+	// Index is the position of the input in the corpus.
+	Index int
+	// Params is the input.
+	Params Params
+	// Old and New are the outcomes of the old and new expression.
+	Old, New bool
+}
+
+// Impact summarizes the effect of changing an expression on a corpus of
+// inputs, as returned by Replay.
+type Impact struct {
+	// Total is the number of inputs replayed.
+	Total int
+	// Flips holds the inputs whose outcome changed, in the order of the corpus.
+	Flips []Flip
+}
+
+// Replay evaluates the old and new versions of an expression against every
+// input of corpus, such as recorded production traffic, and reports the
+// inputs whose outcome changed.
+func Replay(old, new Exp, corpus []Params) Impact {
+	im := Impact{Total: len(corpus)}
+	for i, p := range corpus {
+		if o, n := old.Eval(p), new.Eval(p); o != n {
+			im.Flips = append(im.Flips, Flip{i, p, o, n})
+		}
+	}
+	return im
+}
+
+// Gained returns the number of inputs which only the new expression matches.
+func (im Impact) Gained() int {
+	n := 0
+	for _, f := range im.Flips {
+		if f.New {
+			n++
+		}
+	}
+	return n
+}
+
+// Lost returns the number of inputs which only the old expression matches.
+func (im Impact) Lost() int {
+	return len(im.Flips) - im.Gained()
+}
+
+// String summarizes the impact, such as
+//
+//	3 of 1000 inputs flipped: 2 false → true, 1 true → false
+func (im Impact) String() string {
+	return sprintf("%d of %d inputs flipped: %d false → true, %d true → false",
+		len(im.Flips), im.Total, im.Gained(), im.Lost())
+}
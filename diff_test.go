@@ -0,0 +1,124 @@
+package exp
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	for _, test := range []struct {
+		old, new string
+		changes  []string
+	}{
+		{`a == 1 && b == 2`, `a == 1 && b == 2`, nil},
+		{
+			`country == "GR" && amount > 100`,
+			`country == "GR" && amount > 1000 && trial != "yes"`,
+			[]string{"~ 1: amount > 100 → amount > 1000", `+ 2: trial != "yes"`},
+		},
+		{
+			`a == 1 && b == 2 && c == 3`,
+			`c == 3 && a == 1`,
+			[]string{"- 0: a == 1", "- 1: b == 2", "+ 1: a == 1"},
+		},
+		{
+			`a == 1 || !(b == 2 && c == 3)`,
+			`a == 1 || !(b == 2 && c == 4)`,
+			[]string{"~ 1.0.1: c == 3 → c == 4"},
+		},
+		{
+			`any tag == "a"`,
+			`any tag == "b"`,
+			[]string{`~ 0: tag == "a" → tag == "b"`},
+		},
+		{
+			`any tag == "a"`,
+			`all tag == "a"`,
+			[]string{`~ root: any tag == "a" → all tag == "a"`},
+		},
+		{
+			`a >= 1 && b == 2`,
+			`a >= 2 && b == 2`,
+			[]string{"~ 0: a >= 1 → a >= 2"},
+		},
+		{
+			`country == "GR" && amount > 100.001`,
+			`country == "GR" && amount > 100.004`,
+			[]string{"~ 1: amount > 100.001 → amount > 100.004"},
+		},
+		{`amount == 0.001`, `amount == 0.002`, []string{"~ root: amount == 0.001 → amount == 0.002"}},
+		{
+			`a == 1`,
+			`a == 1 && b == 2`,
+			[]string{"~ root: a == 1 → a == 1 && b == 2"},
+		},
+	} {
+		old, err := Parse(test.old)
+		if err != nil {
+			t.Fatal(err)
+		}
+		new, err := Parse(test.new)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var have []string
+		for _, c := range Diff(old, new) {
+			have = append(have, c.String())
+		}
+		if strings.Join(have, "\n") != strings.Join(test.changes, "\n") {
+			t.Errorf("Diff(%s, %s) = %q, want %q", test.old, test.new, have, test.changes)
+		}
+	}
+}
+
+func TestDiffUnformatted(t *testing.T) {
+	// Negative numbers cannot be formatted, and String rounds them alike.
+	old := And(Match("a", "x"), Gt("b", -0.001))
+	new := And(Match("a", "x"), Gt("b", -0.002))
+	changes := Diff(old, new)
+	if len(changes) != 1 || changes[0].Kind != Changed || changes[0].Path != "1" {
+		t.Errorf("Diff(%s, %s) = %v", old, new, changes)
+	}
+	if changes := Diff(old, And(Match("a", "x"), Gt("b", -0.001))); len(changes) != 0 {
+		t.Errorf("Diff of equal expressions = %v", changes)
+	}
+}
+
+func TestDiffPaths(t *testing.T) {
+	old := And(Match("a", "1"), Match("b", "2"))
+	new := And(Match("b", "2"), Match("c", "3"))
+	changes := Diff(old, new)
+	if len(changes) != 2 {
+		t.Fatalf("Diff(%s, %s) = %v", old, new, changes)
+	}
+	if c := changes[0]; c.Kind != Removed || c.Path != "0" || c.New != nil {
+		t.Errorf("changes[0] = %+v", c)
+	}
+	if c := changes[1]; c.Kind != Added || c.Path != "1" || c.Old != nil {
+		t.Errorf("changes[1] = %+v", c)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	old := Gt("amount", 100)
+	new := Gt("amount", 1000)
+	corpus := []Params{
+		Map{"amount": "50"},
+		Map{"amount": "500"},
+		Map{"amount": "5000"},
+		Map{"amount": "700"},
+	}
+	im := Replay(old, new, corpus)
+	if im.Total != 4 || len(im.Flips) != 2 || im.Flips[0].Index != 1 || im.Flips[1].Index != 3 {
+		t.Errorf("Replay = %+v", im)
+	}
+	if f := im.Flips[0]; !f.Old || f.New {
+		t.Errorf("Flips[0] = %+v", f)
+	}
+	if have, want := im.String(), "2 of 4 inputs flipped: 0 false → true, 2 true → false"; have != want {
+		t.Errorf("String() = %q, want %q", have, want)
+	}
+	if im.Gained() != 0 || im.Lost() != 2 {
+		t.Errorf("Gained() = %d, Lost() = %d", im.Gained(), im.Lost())
+	}
+}
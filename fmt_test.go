@@ -1,8 +1,13 @@
 package exp
 
-import "testing"
+import (
+	"regexp"
+	"testing"
+	"time"
+)
 
 func TestString(t *testing.T) {
+	date := time.Date(2014, time.December, 15, 0, 0, 0, 0, time.UTC)
 	for _, test := range []struct {
 		exp Exp
 		str string
@@ -28,6 +33,14 @@ func TestString(t *testing.T) {
 		{Len("bar", 3), "[len(bar)==3]"},
 		{Count("bar", "a", 2), "[count(bar,a)==2]"},
 		{EqualFold("bar", "AbC"), "[bar≈AbC]"},
+		{On("baz", date), "[baz==2014-12-15]"},
+		{Before("baz", date), "[baz<2014-12-15]"},
+		{After("baz", date), "[baz>2014-12-15]"},
+		{Weekday("baz", time.Monday), "[weekday(baz)==Monday]"},
+		{Day("baz", 15), "[day(baz)==15]"},
+		{Month("baz", time.December), "[month(baz)==December]"},
+		{expRegexp{"baz", regexp.MustCompile("^a+$")}, "[baz=~^a+$]"},
+		{Year("baz", 2014), "[year(baz)==2014]"},
 	} {
 		if sprintf("%s", test.exp) != test.str {
 			t.Errorf("unexpected string %q != %q", test.exp, test.str)
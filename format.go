@@ -0,0 +1,218 @@
+package exp
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ErrUnsupported is returned by Format for expressions which have no text
+// representation.
+var ErrUnsupported = errors.New("exp: unsupported expression")
+
+// Format returns the text representation of e, as accepted by Parse. Parsing
+// the result yields an expression equivalent to e, although nested And and Or
+// expressions may be flattened.
+//
+// Only expressions which Parse can produce may be formatted. An error wrapping
+// ErrUnsupported is returned for any other expression, as well as for negative
+// or non finite numbers, strings containing a double quote and keys containing
+// a single quote, none of which can be expressed in text.
+//
+//	s, err := exp.Format(exp.And(exp.Gte("foo", 100), exp.Match("bar", "baz")))
+//	// s == `foo >= 100 && bar == "baz"`
+func Format(e Exp) (string, error) {
+	var b strings.Builder
+	if err := format(&b, e); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func format(b *strings.Builder, e Exp) error {
+	if key, v, op, ok := inspectOrEqual(e); ok {
+		if op == OpGt {
+			return formatComparison(b, key, ">=", v)
+		}
+		return formatComparison(b, key, "<=", v)
+	}
+	n := Inspect(e)
+	switch n.Op {
+	case OpBool:
+		b.WriteString(strconv.FormatBool(n.Value.(bool)))
+		return nil
+	case OpAnd, OpOr:
+		if len(n.Elems) == 0 {
+			b.WriteString(strconv.FormatBool(n.Op == OpAnd))
+			return nil
+		}
+		sep := " && "
+		if n.Op == OpOr {
+			sep = " || "
+		}
+		for i, elem := range n.Elems {
+			if i > 0 {
+				b.WriteString(sep)
+			}
+			if err := formatOperand(b, elem); err != nil {
+				return err
+			}
+		}
+		return nil
+	case OpNot:
+		switch inner := Inspect(n.Elems[0]); inner.Op {
+		case OpMatch:
+			return formatComparison(b, inner.Key, "!=", inner.Value)
+		case OpEq:
+			return formatComparison(b, inner.Key, "!=", inner.Value)
+		case OpSizeEq:
+			b.WriteString("size ")
+			return formatComparison(b, inner.Key, "!=", float64(inner.N))
+		case OpSizeGt:
+			b.WriteString("size ")
+			return formatComparison(b, inner.Key, "<=", float64(inner.N))
+		}
+		b.WriteString("!")
+		return formatOperand(b, n.Elems[0])
+	case OpMatch:
+		return formatComparison(b, n.Key, "==", n.Value)
+	case OpEq:
+		return formatComparison(b, n.Key, "==", n.Value)
+	case OpGt:
+		return formatComparison(b, n.Key, ">", n.Value)
+	case OpLt:
+		return formatComparison(b, n.Key, "<", n.Value)
+	case OpRegexp:
+		return formatComparison(b, n.Key, "=~", sprintf("%s", n.Value))
+	case OpHasElement:
+		return formatComparison(b, n.Key, "has", n.Value)
+	case OpIntersects:
+		return formatComparison(b, n.Key, "intersects", n.Value)
+	case OpSubsetOf:
+		return formatComparison(b, n.Key, "subsetof", n.Value)
+	case OpSizeGt:
+		if n.N < 0 {
+			break
+		}
+		b.WriteString("size ")
+		return formatComparison(b, n.Key, ">", float64(n.N))
+	case OpSizeEq:
+		b.WriteString("size ")
+		return formatComparison(b, n.Key, "==", float64(n.N))
+	case OpAny, OpAll:
+		if key, ok := comparisonKey(n.Elems[0]); !ok || key != n.Key {
+			break
+		}
+		if n.Op == OpAny {
+			b.WriteString("any ")
+		} else {
+			b.WriteString("all ")
+		}
+		return format(b, n.Elems[0])
+	}
+	return fmt.Errorf("%w %v", ErrUnsupported, e)
+}
+
+// comparisonKey returns the key of e and true if it is formatted as a single
+// comparison.
+func comparisonKey(e Exp) (string, bool) {
+	if key, _, _, ok := inspectOrEqual(e); ok {
+		return key, true
+	}
+	n := Inspect(e)
+	switch n.Op {
+	case OpMatch, OpEq, OpGt, OpLt, OpRegexp:
+		return n.Key, true
+	case OpNot:
+		switch inner := Inspect(n.Elems[0]); inner.Op {
+		case OpMatch, OpEq:
+			return inner.Key, true
+		}
+	}
+	return "", false
+}
+
+// formatOperand formats e as the operand of an And, Or or Not, enclosing it in
+// parentheses unless it is a single comparison or boolean.
+func formatOperand(b *strings.Builder, e Exp) error {
+	if _, _, _, ok := inspectOrEqual(e); !ok {
+		switch Inspect(e).Op {
+		case OpAnd, OpOr:
+			b.WriteString("(")
+			if err := format(b, e); err != nil {
+				return err
+			}
+			b.WriteString(")")
+			return nil
+		}
+	}
+	return format(b, e)
+}
+
+func formatComparison(b *strings.Builder, key, op string, value any) error {
+	if err := formatKey(b, key); err != nil {
+		return err
+	}
+	b.WriteString(" ")
+	b.WriteString(op)
+	b.WriteString(" ")
+	switch v := value.(type) {
+	case string:
+		if strings.ContainsRune(v, '"') {
+			return fmt.Errorf("%w string %q", ErrUnsupported, v)
+		}
+		b.WriteString(`"` + v + `"`)
+	case float64:
+		if v < 0 || math.IsInf(v, 0) || math.IsNaN(v) {
+			return fmt.Errorf("%w number %v", ErrUnsupported, v)
+		}
+		b.WriteString(strconv.FormatFloat(v, 'f', -1, 64))
+	case []string:
+		b.WriteString("[")
+		for i, s := range v {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			if strings.ContainsRune(s, '"') {
+				return fmt.Errorf("%w string %q", ErrUnsupported, s)
+			}
+			b.WriteString(`"` + s + `"`)
+		}
+		b.WriteString("]")
+	}
+	return nil
+}
+
+// formatKey writes key as a bare identifier if possible, or enclosed in single
+// quotes otherwise.
+func formatKey(b *strings.Builder, key string) error {
+	if isBareKey(key) {
+		b.WriteString(key)
+		return nil
+	}
+	if strings.ContainsRune(key, '\'') {
+		return fmt.Errorf("%w key %q", ErrUnsupported, key)
+	}
+	b.WriteString("'" + key + "'")
+	return nil
+}
+
+// isBareKey reports whether key is scanned as an identifier without quotes.
+func isBareKey(key string) bool {
+	if key == "" || key == "true" || key == "false" {
+		return false
+	}
+	for i, r := range key {
+		if r == utf8.RuneError {
+			return false
+		}
+		if !(r == '_' || r == '.' || unicode.IsLetter(r) || (i > 0 && unicode.IsDigit(r))) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,103 @@
+package exp
+
+import (
+	"errors"
+	"math"
+	"regexp"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	for _, test := range []struct {
+		exp  Exp
+		text string
+	}{
+		{True, `true`},
+		{And(), `true`},
+		{Or(), `false`},
+		{Match("foo", "bar"), `foo == "bar"`},
+		{Not(Match("foo", "bar")), `foo != "bar"`},
+		{Eq("foo", 1.5), `foo == 1.5`},
+		{Neq("foo", 100), `foo != 100`},
+		{Gt("foo", 1), `foo > 1`},
+		{Gte("foo", 1), `foo >= 1`},
+		{Lt("foo", 1), `foo < 1`},
+		{Lte("foo", 1), `foo <= 1`},
+		{expRegexp{"foo", regexp.MustCompile(`^\d+$`)}, `foo =~ "^\d+$"`},
+		{Match("b-z", "x"), `'b-z' == "x"`},
+		{Match("true", "x"), `'true' == "x"`},
+		{Match("1a", "x"), `'1a' == "x"`},
+		{Match("a.b_1", "x"), `a.b_1 == "x"`},
+		{And(Gt("a", 1), Lt("a", 5), Match("b", "x")), `a > 1 && a < 5 && b == "x"`},
+		{Or(Match("a", "x"), And(Match("b", "y"), Not(True))), `a == "x" || (b == "y" && !true)`},
+		{Not(And(Gte("a", 1), Or(False))), `!(a >= 1 && (false))`},
+		{Not(Not(Eq("a", 1))), `!a != 1`},
+		{Any("b", Match("b", "x")), `any b == "x"`},
+		{HasElement("b", "x"), `b has "x"`},
+		{And(SizeGt("b", 0), SizeEq("a", 1), Not(SizeEq("a", 2)), Not(SizeGt("b", 3))), `size b > 0 && size a == 1 && size a != 2 && size b <= 3`},
+		{Or(Intersects("b", "x", "y"), SubsetOf("a")), `b intersects ["x", "y"] || a subsetof []`},
+		{And(All("a", Gte("a", 1)), Not(Any("b", Not(Match("b", "y"))))), `all a >= 1 && !any b != "y"`},
+	} {
+		text, err := Format(test.exp)
+		if err != nil {
+			t.Errorf("Format(%s) = %v", test.exp, err)
+			continue
+		}
+		if text != test.text {
+			t.Errorf("Format(%s) = %s, want %s", test.exp, text, test.text)
+		}
+		e, err := Parse(text)
+		if err != nil {
+			t.Errorf("Parse(%q) = %v", text, err)
+			continue
+		}
+		for _, p := range []Map{{}, {"a": "3", "b": "x", "foo": "1"}, {"a": "1", "b": "y", "foo": "bar"}} {
+			if e.Eval(p) != test.exp.Eval(p) {
+				t.Errorf("Parse(Format(%s)) = %s, which evaluates differently against %v", test.exp, e, p)
+			}
+		}
+	}
+}
+
+func TestFormatUnsupported(t *testing.T) {
+	for _, e := range []Exp{
+		Contains("foo", "bar"),
+		And(True, Len("foo", 3)),
+		Match("foo", `"`),
+		Match("'", "x"),
+		Eq("foo", -1),
+		Gt("foo", math.Inf(1)),
+		custom{},
+		Any("a", Match("b", "x")),
+		All("a", And(Gt("a", 1), Lt("a", 5))),
+		SizeGt("a", -1),
+		Intersects("a", `"`),
+	} {
+		if _, err := Format(e); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("Format(%s) = %v, want ErrUnsupported", e, err)
+		}
+	}
+}
+
+// FuzzFormat checks that formatting a parsed expression and parsing it again
+// yields an equivalent expression. The seed corpus lives in
+// testdata/fuzz/FuzzFormat.
+func FuzzFormat(f *testing.F) {
+	f.Fuzz(func(t *testing.T, s string) {
+		e, err := Parse(s)
+		if err != nil {
+			return
+		}
+		text, err := Format(e)
+		if err != nil {
+			t.Fatalf("Format(Parse(%q)) = %v", s, err)
+		}
+		again, err := Parse(text)
+		if err != nil {
+			t.Fatalf("Parse(%q) = %v, formatted from %q", text, err, s)
+		}
+		if want, have := sprintf("%s", e), sprintf("%s", again); want != have {
+			t.Fatalf("Parse(Format(Parse(%q))) = %s, want %s", s, have, want)
+		}
+	})
+}
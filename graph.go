@@ -0,0 +1,181 @@
+package exp
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// GraphOption configures the output of WriteDOT and WriteMermaid.
+type GraphOption func(*graph)
+
+// Highlight colours every node of the graph by the result of evaluating it
+// against p. Nodes which were not reached because And or Or short-circuited
+// are coloured grey, so the path taken by the evaluation stands out.
+func Highlight(p Params) GraphOption {
+	return func(g *graph) {
+		g.params = p
+		g.highlight = true
+	}
+}
+
+// WriteDOT writes e to w as a Graphviz DOT digraph. Operators are rendered as
+// inner nodes and all other expressions as leaves labeled by their String
+// method.
+//
+//	exp.WriteDOT(os.Stdout, e, exp.Highlight(exp.Map{"foo": "bar"}))
+func WriteDOT(w io.Writer, e Exp, opts ...GraphOption) error {
+	g := newGraph(e, opts)
+	b := bufio.NewWriter(w)
+	b.WriteString("digraph exp {\n")
+	b.WriteString("\tnode [shape=box, fontname=\"monospace\"];\n")
+	for _, n := range g.nodes {
+		b.WriteString(sprintf("\tn%d [label=%q", n.id, n.label))
+		if g.highlight {
+			b.WriteString(sprintf(", style=filled, fillcolor=%q", n.state.colour()))
+		}
+		b.WriteString("];\n")
+	}
+	for _, edge := range g.edges {
+		b.WriteString(sprintf("\tn%d -> n%d;\n", edge[0], edge[1]))
+	}
+	b.WriteString("}\n")
+	return b.Flush()
+}
+
+// WriteMermaid writes e to w as a Mermaid flowchart. It accepts the same
+// options as WriteDOT.
+func WriteMermaid(w io.Writer, e Exp, opts ...GraphOption) error {
+	g := newGraph(e, opts)
+	b := bufio.NewWriter(w)
+	b.WriteString("flowchart TD\n")
+	for _, n := range g.nodes {
+		b.WriteString(sprintf("\tn%d[\"%s\"]\n", n.id, mermaidEscaper.Replace(n.label)))
+	}
+	for _, edge := range g.edges {
+		b.WriteString(sprintf("\tn%d --> n%d\n", edge[0], edge[1]))
+	}
+	if g.highlight {
+		for _, s := range []nodeState{statePass, stateFail, stateSkip} {
+			b.WriteString(sprintf("\tclassDef %s fill:%s\n", s, s.colour()))
+		}
+		for _, n := range g.nodes {
+			b.WriteString(sprintf("\tclass n%d %s\n", n.id, n.state))
+		}
+	}
+	return b.Flush()
+}
+
+var mermaidEscaper = strings.NewReplacer(`"`, "#quot;")
+
+type nodeState int
+
+const (
+	stateSkip nodeState = iota
+	statePass
+	stateFail
+)
+
+func (s nodeState) String() string {
+	switch s {
+	case statePass:
+		return "pass"
+	case stateFail:
+		return "fail"
+	}
+	return "skip"
+}
+
+func (s nodeState) colour() string {
+	switch s {
+	case statePass:
+		return "#c8e6c9"
+	case stateFail:
+		return "#ffcdd2"
+	}
+	return "#eeeeee"
+}
+
+type graphNode struct {
+	id    int
+	label string
+	state nodeState
+}
+
+type graph struct {
+	nodes     []graphNode
+	edges     [][2]int
+	params    Params
+	highlight bool
+}
+
+func newGraph(e Exp, opts []GraphOption) *graph {
+	g := &graph{}
+	for _, opt := range opts {
+		opt(g)
+	}
+	g.add(e, true)
+	return g
+}
+
+// add adds e and its operands to the graph and returns its id along with the
+// result of its evaluation. The reached argument reports whether the
+// evaluation of the parent reached e.
+func (g *graph) add(e Exp, reached bool) (int, bool) {
+	id := len(g.nodes)
+	g.nodes = append(g.nodes, graphNode{id: id})
+
+	var (
+		label string
+		elems []Exp
+		// Evaluating an operand to stop short-circuits the evaluation of
+		// the remaining operands of And and Or.
+		stop, stoppable bool
+	)
+	switch e := e.(type) {
+	case expAnd:
+		label, elems, stop, stoppable = "∧", e.elems, false, true
+	case expOr:
+		label, elems, stop, stoppable = "∨", e.elems, true, true
+	case expNot:
+		label, elems = "¬", []Exp{e.elem}
+	default:
+		label = sprintf("%s", e)
+	}
+
+	reached = reached && g.highlight
+	// The result of And, Or and Not follows from those of their operands, so
+	// that only the leaves are evaluated.
+	var result bool
+	switch {
+	case stoppable:
+		result = !stop
+	case elems == nil:
+		result = reached && e.Eval(g.params)
+	}
+
+	reachedElem := reached
+	for _, elem := range elems {
+		child, r := g.add(elem, reachedElem)
+		g.edges = append(g.edges, [2]int{id, child})
+		switch {
+		case !reachedElem:
+		case stoppable && r == stop:
+			result, reachedElem = stop, false
+		case !stoppable:
+			result = !r
+		}
+	}
+	result = reached && result
+
+	g.nodes[id].label = label
+	switch {
+	case !reached:
+		g.nodes[id].state = stateSkip
+	case result:
+		g.nodes[id].state = statePass
+	default:
+		g.nodes[id].state = stateFail
+	}
+	return id, result
+}
@@ -0,0 +1,100 @@
+package exp
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteDOT(t *testing.T) {
+	var b bytes.Buffer
+	err := WriteDOT(&b, And(Match("foo", `"bar"`), Not(False)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `digraph exp {
+	node [shape=box, fontname="monospace"];
+	n0 [label="∧"];
+	n1 [label="[foo==\"bar\"]"];
+	n2 [label="¬"];
+	n3 [label="F"];
+	n0 -> n1;
+	n2 -> n3;
+	n0 -> n2;
+}
+`
+	if b.String() != want {
+		t.Errorf("unexpected output.\n\twant: %s\n\thave: %s", want, b.String())
+	}
+}
+
+func TestWriteDOTHighlight(t *testing.T) {
+	var b bytes.Buffer
+	err := WriteDOT(&b, Or(Match("foo", "baz"), Match("foo", "bar"), True), Highlight(Map{"foo": "bar"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `digraph exp {
+	node [shape=box, fontname="monospace"];
+	n0 [label="∨", style=filled, fillcolor="#c8e6c9"];
+	n1 [label="[foo==baz]", style=filled, fillcolor="#ffcdd2"];
+	n2 [label="[foo==bar]", style=filled, fillcolor="#c8e6c9"];
+	n3 [label="T", style=filled, fillcolor="#eeeeee"];
+	n0 -> n1;
+	n0 -> n2;
+	n0 -> n3;
+}
+`
+	if b.String() != want {
+		t.Errorf("unexpected output.\n\twant: %s\n\thave: %s", want, b.String())
+	}
+}
+
+func TestWriteMermaid(t *testing.T) {
+	var b bytes.Buffer
+	err := WriteMermaid(&b, And(False, Match("foo", `"bar"`)), Highlight(Map{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `flowchart TD
+	n0["∧"]
+	n1["F"]
+	n2["[foo==#quot;bar#quot;]"]
+	n0 --> n1
+	n0 --> n2
+	classDef pass fill:#c8e6c9
+	classDef fail fill:#ffcdd2
+	classDef skip fill:#eeeeee
+	class n0 fail
+	class n1 fail
+	class n2 skip
+`
+	if b.String() != want {
+		t.Errorf("unexpected output.\n\twant: %s\n\thave: %s", want, b.String())
+	}
+}
+
+// countParams counts the values read from it.
+type countParams struct {
+	Params
+	n int
+}
+
+func (p *countParams) Get(key string) string {
+	p.n++
+	return p.Params.Get(key)
+}
+
+func TestWriteDOTHighlightEvaluatesLeavesOnce(t *testing.T) {
+	e := Not(And(Or(Match("a", "x"), Match("b", "y")), Not(Match("c", "z")), Match("d", "w")))
+	p := &countParams{Params: Map{"b": "y", "c": "z"}}
+	var b bytes.Buffer
+	if err := WriteDOT(&b, e, Highlight(p)); err != nil {
+		t.Fatal(err)
+	}
+	if p.n != 3 {
+		t.Errorf("read %d values, want 3", p.n)
+	}
+	if want := `n0 [label="¬", style=filled, fillcolor="#c8e6c9"];`; !bytes.Contains(b.Bytes(), []byte(want)) {
+		t.Errorf("unexpected output, want %s\n%s", want, b.String())
+	}
+}
@@ -0,0 +1,116 @@
+// Package httpexp evaluates expressions against HTTP requests, so that rules
+// such as those of an API gateway can be written in terms of a request's
+// method, path, headers and cookies.
+//
+//	e, err := exp.Parse(`method == "POST" && 'header.Content-Type' != "application/json"`)
+//	if err != nil {
+//		// handle error
+//	}
+//	if e.Eval(httpexp.Request(r)) {
+//		// reject the request
+//	}
+//
+// Keys containing characters other than letters, digits, dots and underscores
+// must be quoted in text, as shown above. Middleware applies a rule to every
+// request handled by an http.Handler.
+package httpexp
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/alexkappa/exp"
+)
+
+// Request returns Params reading from r. The following keys are available.
+//
+//	method         the request method, such as "GET"
+//	path           the path of the request URL, such as "/users/1"
+//	host           the host the request was sent to, without a port
+//	remote_ip      the IP address of the client, without a port
+//	header.<name>  the header with the given name, which is case insensitive
+//	cookie.<name>  the cookie with the given name
+//	query.<name>   the query string parameter with the given name
+//
+// Headers, cookies and query string parameters may be repeated, and are all
+// read by GetAll, so that they can be used with exp.Any, exp.All and the list
+// predicates such as exp.HasElement. Get reads the first of them.
+//
+// The remote IP is read from r.RemoteAddr. Requests forwarded by a proxy should
+// have their RemoteAddr set to the client address, or be matched against the
+// header set by the proxy instead, such as header.X-Forwarded-For.
+func Request(r *http.Request) exp.MultiParams {
+	return request{r}
+}
+
+type request struct {
+	r *http.Request
+}
+
+// Get returns the first value of key.
+func (r request) Get(key string) string {
+	if v := r.GetAll(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// GetAll returns every value of key.
+func (r request) GetAll(key string) []string {
+	switch key {
+	case "method":
+		return one(r.r.Method)
+	case "path":
+		if r.r.URL == nil {
+			return nil
+		}
+		return one(r.r.URL.Path)
+	case "host":
+		return one(hostname(r.r.Host))
+	case "remote_ip":
+		return one(hostname(r.r.RemoteAddr))
+	}
+	ns, name, ok := strings.Cut(key, ".")
+	if !ok || name == "" {
+		return nil
+	}
+	switch ns {
+	case "header":
+		if http.CanonicalHeaderKey(name) == "Host" {
+			return one(r.r.Host)
+		}
+		return r.r.Header.Values(name)
+	case "cookie":
+		var values []string
+		for _, c := range r.r.Cookies() {
+			if c.Name == name {
+				values = append(values, c.Value)
+			}
+		}
+		return values
+	case "query":
+		if r.r.URL == nil {
+			return nil
+		}
+		return r.r.URL.Query()[name]
+	}
+	return nil
+}
+
+// one returns v as a list of values, which is empty if v is.
+func one(v string) []string {
+	if v == "" {
+		return nil
+	}
+	return []string{v}
+}
+
+// hostname strips the port from a host:port address, as well as the brackets
+// enclosing an IPv6 address.
+func hostname(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+}
@@ -0,0 +1,112 @@
+package httpexp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/alexkappa/exp"
+)
+
+func newRequest() *http.Request {
+	r := httptest.NewRequest("POST", "http://api.example.com:8080/users/1?tag=a&tag=b", nil)
+	r.RemoteAddr = "[2001:db8::1]:54321"
+	r.Header.Set("User-Agent", "curl/8.0")
+	r.Header.Add("Accept", "text/html")
+	r.Header.Add("Accept", "application/json")
+	r.AddCookie(&http.Cookie{Name: "session", Value: "abc"})
+	r.AddCookie(&http.Cookie{Name: "pref", Value: "dark"})
+	r.AddCookie(&http.Cookie{Name: "pref", Value: "compact"})
+	return r
+}
+
+func TestRequest(t *testing.T) {
+	p := Request(newRequest())
+	for key, want := range map[string]string{
+		"method":            "POST",
+		"path":              "/users/1",
+		"host":              "api.example.com",
+		"remote_ip":         "2001:db8::1",
+		"header.User-Agent": "curl/8.0",
+		"header.user-agent": "curl/8.0",
+		"header.Accept":     "text/html",
+		"header.Host":       "api.example.com:8080",
+		"header.Missing":    "",
+		"cookie.session":    "abc",
+		"cookie.pref":       "dark",
+		"cookie.missing":    "",
+		"query.tag":         "a",
+		"query.missing":     "",
+		"header.":           "",
+		"missing":           "",
+		"missing.key":       "",
+	} {
+		if have := p.Get(key); have != want {
+			t.Errorf("Get(%q) = %q, want %q", key, have, want)
+		}
+	}
+	for key, want := range map[string][]string{
+		"header.Accept": {"text/html", "application/json"},
+		"cookie.pref":   {"dark", "compact"},
+		"query.tag":     {"a", "b"},
+		"path":          {"/users/1"},
+		"query.missing": nil,
+	} {
+		if have := p.GetAll(key); !reflect.DeepEqual(have, want) {
+			t.Errorf("GetAll(%q) = %q, want %q", key, have, want)
+		}
+	}
+}
+
+func TestRequestParse(t *testing.T) {
+	e, err := exp.Parse(`method == "POST" && path =~ "^/users/" && any query.tag == "b" && 'header.Accept' has "application/json" && remote_ip != "127.0.0.1"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !e.Eval(Request(newRequest())) {
+		t.Errorf("%s should evaluate to true", e)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	rule := exp.Match("cookie.session", "abc")
+	for _, test := range []struct {
+		opts    []Option
+		cookie  string
+		status  int
+		matched bool
+		name    string
+	}{
+		{nil, "abc", http.StatusOK, true, ""},
+		{nil, "xyz", http.StatusOK, false, ""},
+		{[]Option{Name("session")}, "abc", http.StatusOK, true, "session"},
+		{[]Option{Reject(http.StatusForbidden)}, "abc", http.StatusOK, true, ""},
+		{[]Option{Reject(http.StatusForbidden)}, "xyz", http.StatusForbidden, false, ""},
+		{[]Option{Reject(http.StatusUnauthorized)}, "", http.StatusUnauthorized, false, ""},
+	} {
+		var called, matched, ok bool
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+			matched, ok = Matched(r.Context(), test.name)
+		})
+		r := httptest.NewRequest("GET", "/", nil)
+		if test.cookie != "" {
+			r.AddCookie(&http.Cookie{Name: "session", Value: test.cookie})
+		}
+		w := httptest.NewRecorder()
+		Middleware(rule, test.opts...)(next).ServeHTTP(w, r)
+		if w.Code != test.status {
+			t.Errorf("status = %d, want %d", w.Code, test.status)
+		}
+		if called != (test.status == http.StatusOK) {
+			t.Errorf("next handler called = %t", called)
+		}
+		if called && (!ok || matched != test.matched) {
+			t.Errorf("Matched(%q) = %t, %t, want %t, true", test.name, matched, ok, test.matched)
+		}
+	}
+	if _, ok := Matched(httptest.NewRequest("GET", "/", nil).Context(), ""); ok {
+		t.Error("Matched should not be ok for a request without a rule")
+	}
+}
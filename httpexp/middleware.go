@@ -0,0 +1,78 @@
+package httpexp
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/alexkappa/exp"
+)
+
+// Option configures the middleware returned by Middleware.
+type Option func(*middleware)
+
+// Reject configures the middleware to respond with status to requests for
+// which the rule evaluates to false, instead of passing them on.
+func Reject(status int) Option {
+	return func(m *middleware) {
+		m.reject = status
+	}
+}
+
+// Name configures the name the result of the rule is recorded under in the
+// request context, so that the results of several rules can be told apart.
+// The default name is empty.
+func Name(name string) Option {
+	return func(m *middleware) {
+		m.name = name
+	}
+}
+
+type middleware struct {
+	rule   exp.Exp
+	reject int
+	name   string
+	next   http.Handler
+}
+
+// Middleware returns net/http middleware which evaluates e against every
+// request, as read by Request.
+//
+// By default every request is passed on to the next handler, with the result
+// recorded in its context where it can be read by Matched. If configured with
+// Reject, requests for which e evaluates to false are answered with the given
+// status instead.
+//
+//	mux := http.NewServeMux()
+//	rule := exp.Match("header.X-Api-Key", key)
+//	http.ListenAndServe(":8080", httpexp.Middleware(rule, httpexp.Reject(http.StatusForbidden))(mux))
+func Middleware(e exp.Exp, opts ...Option) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		m := &middleware{rule: e, next: next}
+		for _, opt := range opts {
+			opt(m)
+		}
+		return m
+	}
+}
+
+func (m *middleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	matched := m.rule.Eval(Request(r))
+	if !matched && m.reject != 0 {
+		http.Error(w, http.StatusText(m.reject), m.reject)
+		return
+	}
+	ctx := context.WithValue(r.Context(), contextKey{m.name}, matched)
+	m.next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// contextKey is the key the result of a rule is recorded under.
+type contextKey struct {
+	name string
+}
+
+// Matched returns the result of the rule recorded under name by Middleware.
+// If no such rule was evaluated, ok is false.
+func Matched(ctx context.Context, name string) (matched, ok bool) {
+	matched, ok = ctx.Value(contextKey{name}).(bool)
+	return matched, ok
+}
@@ -0,0 +1,437 @@
+package exp
+
+import (
+	"net"
+	"sort"
+	"sync"
+)
+
+// Index speeds up the evaluation of a RuleSet with many rules. It extracts
+// predicates which are necessary for a rule to match, such as Match, Equal and
+// MatchAny (equality), GreaterThan and LessThan (range) and ContainsIP (network)
+// from the conjunctions of each rule, and indexes them using hash tables,
+// sorted bounds and network prefixes respectively. On evaluation only rules
+// whose necessary predicate holds are evaluated in full.
+//
+// Rules without an indexable predicate, for example rules consisting only of
+// Contains expressions, are evaluated against every Params. An Index is
+// immutable and safe for concurrent use.
+type Index struct {
+	rs *RuleSet
+
+	// rank is the position of each rule in rs.byPriority.
+	rank []int
+	// always holds rules which must be evaluated against every Params.
+	always []int
+
+	str    map[string]map[string][]int
+	num    map[string]map[float64][]int
+	lower  map[string][]bound // key > value, ascending.
+	upper  map[string][]bound // key < value, ascending.
+	cidr   map[string]map[prefix][]int
+	prefix map[string][]prefix // distinct prefix lengths per key.
+
+	// keys holds every key read by an index, along with its slot in the
+	// frames of the RuleSet, so that each is fetched and parsed once.
+	keys    []string
+	slots   []int
+	scratch sync.Pool
+}
+
+// bound is an indexed range predicate.
+type bound struct {
+	value     float64
+	inclusive bool
+	rule      int
+}
+
+// prefix is an indexed network. The addr field holds the masked network
+// address when used as a map key and is empty when listing prefix lengths.
+type prefix struct {
+	bits, ones int
+	addr       string
+}
+
+// anchor is a predicate which must hold for a rule, or one of its disjuncts,
+// to evaluate to true.
+type anchor struct {
+	kind      anchorKind
+	key       string
+	str       string
+	num       float64
+	inclusive bool
+	prefix    prefix
+}
+
+type anchorKind int
+
+const (
+	anchorStr anchorKind = iota
+	anchorNum
+	anchorCIDR
+	anchorLower
+	anchorUpper
+)
+
+// NewIndex indexes the rules of rs.
+func NewIndex(rs *RuleSet) *Index {
+	ix := &Index{
+		rs:     rs,
+		rank:   make([]int, len(rs.rules)),
+		str:    map[string]map[string][]int{},
+		num:    map[string]map[float64][]int{},
+		lower:  map[string][]bound{},
+		upper:  map[string][]bound{},
+		cidr:   map[string]map[prefix][]int{},
+		prefix: map[string][]prefix{},
+	}
+	for pos, i := range rs.byPriority {
+		ix.rank[i] = pos
+	}
+	pl := newPlanner(rs.rules)
+	keys := map[string]bool{}
+	for i, r := range rs.rules {
+		anchors, ok := pl.anchors(r.Exp)
+		if !ok {
+			ix.always = append(ix.always, i)
+			continue
+		}
+		for _, a := range anchors {
+			keys[a.key] = true
+			ix.add(i, a)
+		}
+	}
+	for key := range keys {
+		ix.keys = append(ix.keys, key)
+	}
+	sort.Strings(ix.keys)
+	for _, key := range ix.keys {
+		ix.slots = append(ix.slots, rs.slots[key])
+	}
+	for _, bounds := range ix.lower {
+		sort.SliceStable(bounds, func(i, j int) bool { return bounds[i].value < bounds[j].value })
+	}
+	for _, bounds := range ix.upper {
+		sort.SliceStable(bounds, func(i, j int) bool { return bounds[i].value < bounds[j].value })
+	}
+	ix.scratch.New = func() any {
+		return &scratch{seen: make([]uint32, len(rs.rules))}
+	}
+	return ix
+}
+
+func (ix *Index) add(rule int, a anchor) {
+	switch a.kind {
+	case anchorStr:
+		if ix.str[a.key] == nil {
+			ix.str[a.key] = map[string][]int{}
+		}
+		ix.str[a.key][a.str] = append(ix.str[a.key][a.str], rule)
+	case anchorNum:
+		if ix.num[a.key] == nil {
+			ix.num[a.key] = map[float64][]int{}
+		}
+		ix.num[a.key][a.num] = append(ix.num[a.key][a.num], rule)
+	case anchorLower:
+		ix.lower[a.key] = append(ix.lower[a.key], bound{a.num, a.inclusive, rule})
+	case anchorUpper:
+		ix.upper[a.key] = append(ix.upper[a.key], bound{a.num, a.inclusive, rule})
+	case anchorCIDR:
+		if ix.cidr[a.key] == nil {
+			ix.cidr[a.key] = map[prefix][]int{}
+		}
+		length := prefix{bits: a.prefix.bits, ones: a.prefix.ones}
+		if !containsPrefix(ix.prefix[a.key], length) {
+			ix.prefix[a.key] = append(ix.prefix[a.key], length)
+		}
+		ix.cidr[a.key][a.prefix] = append(ix.cidr[a.key][a.prefix], rule)
+	}
+}
+
+func containsPrefix(prefixes []prefix, p prefix) bool {
+	for _, q := range prefixes {
+		if q == p {
+			return true
+		}
+	}
+	return false
+}
+
+// planner chooses the predicates under which each rule is indexed. For a
+// conjunction it prefers the predicate expected to produce the fewest
+// candidates, estimated from how often each predicate occurs across all rules.
+type planner struct {
+	freq   map[anchor]int   // occurrences of each equality or network predicate.
+	ranges map[rangeKey]int // occurrences of range predicates per key and direction.
+}
+
+type rangeKey struct {
+	key  string
+	kind anchorKind
+}
+
+func newPlanner(rules []Rule) *planner {
+	pl := &planner{freq: map[anchor]int{}, ranges: map[rangeKey]int{}}
+	for _, r := range rules {
+		pl.count(r.Exp)
+	}
+	return pl
+}
+
+// count records every predicate of e which could be indexed.
+func (pl *planner) count(e Exp) {
+	if key, _, op, ok := inspectOrEqual(e); ok {
+		kind := anchorLower
+		if op == OpLt {
+			kind = anchorUpper
+		}
+		pl.ranges[rangeKey{key, kind}]++
+		return
+	}
+	n := Inspect(e)
+	for _, elem := range n.Elems {
+		pl.count(elem)
+	}
+	if a, ok := leafAnchor(n); ok {
+		switch a.kind {
+		case anchorLower, anchorUpper:
+			pl.ranges[rangeKey{a.key, a.kind}]++
+		default:
+			pl.freq[a]++
+		}
+	}
+}
+
+// cost estimates the number of candidates produced by anchors. A range
+// predicate is assumed to hold for half the rules bounding the same key in the
+// same direction. Ties are broken in favor of equality, then network, then
+// range predicates.
+func (pl *planner) cost(anchors []anchor) int {
+	c, worst := 0, anchorStr
+	for _, a := range anchors {
+		switch a.kind {
+		case anchorLower, anchorUpper:
+			c += pl.ranges[rangeKey{a.key, a.kind}]/2 + 1
+		default:
+			c += pl.freq[a]
+		}
+		if a.kind > worst {
+			worst = a.kind
+		}
+	}
+	return c*8 + int(worst)
+}
+
+// anchors returns predicates of which at least one must hold for e to evaluate
+// to true. If no such predicates can be found, ok is false.
+func (pl *planner) anchors(e Exp) (anchors []anchor, ok bool) {
+	if key, v, op, ok := inspectOrEqual(e); ok {
+		kind := anchorLower
+		if op == OpLt {
+			kind = anchorUpper
+		}
+		return []anchor{{kind: kind, key: key, num: v, inclusive: true}}, true
+	}
+	n := Inspect(e)
+	switch n.Op {
+	case OpBool:
+		// A false rule never matches so it needs no anchors at all.
+		return nil, !n.Value.(bool)
+	case OpOr:
+		for _, elem := range n.Elems {
+			a, ok := pl.anchors(elem)
+			if !ok {
+				return nil, false
+			}
+			anchors = append(anchors, a...)
+		}
+		return anchors, true
+	case OpAnd:
+		best := -1
+		for _, elem := range n.Elems {
+			a, ok := pl.anchors(elem)
+			if !ok {
+				continue
+			}
+			if c := pl.cost(a); best < 0 || c < best {
+				anchors, best = a, c
+			}
+		}
+		return anchors, best >= 0
+	}
+	a, ok := leafAnchor(n)
+	if !ok {
+		return nil, false
+	}
+	return []anchor{a}, true
+}
+
+func leafAnchor(n Node) (anchor, bool) {
+	switch n.Op {
+	case OpMatch:
+		return anchor{kind: anchorStr, key: n.Key, str: n.Value.(string)}, true
+	case OpEq:
+		return anchor{kind: anchorNum, key: n.Key, num: n.Value.(float64)}, true
+	case OpGt:
+		return anchor{kind: anchorLower, key: n.Key, num: n.Value.(float64)}, true
+	case OpLt:
+		return anchor{kind: anchorUpper, key: n.Key, num: n.Value.(float64)}, true
+	case OpContainsIP:
+		p, ok := networkPrefix(n.Value.(*net.IPNet))
+		if !ok {
+			return anchor{}, false
+		}
+		return anchor{kind: anchorCIDR, key: n.Key, prefix: p}, true
+	}
+	return anchor{}, false
+}
+
+func networkPrefix(n *net.IPNet) (prefix, bool) {
+	ones, bits := n.Mask.Size()
+	if bits == 0 {
+		return prefix{}, false
+	}
+	ip := n.IP
+	if bits == 8*net.IPv4len {
+		ip = ip.To4()
+	}
+	if len(ip) != bits/8 {
+		return prefix{}, false
+	}
+	return prefix{bits: bits, ones: ones, addr: string(ip.Mask(n.Mask))}, true
+}
+
+// scratch holds the state of a single lookup.
+type scratch struct {
+	// seen[i] == gen if rule i is already a candidate.
+	seen  []uint32
+	gen   uint32
+	cands []int
+}
+
+func (s *scratch) reset() {
+	s.gen++
+	if s.gen == 0 {
+		// The generation counter wrapped around, so stale marks could be
+		// mistaken for current ones.
+		for i := range s.seen {
+			s.seen[i] = 0
+		}
+		s.gen = 1
+	}
+	s.cands = s.cands[:0]
+}
+
+func (s *scratch) add(rules ...int) {
+	for _, i := range rules {
+		if s.seen[i] != s.gen {
+			s.seen[i] = s.gen
+			s.cands = append(s.cands, i)
+		}
+	}
+}
+
+// candidates collects the rules which may evaluate to true against f.
+func (ix *Index) candidates(f *frame, s *scratch) {
+	s.reset()
+	s.add(ix.always...)
+	for k, key := range ix.keys {
+		slot := ix.slots[k]
+		if rules, ok := ix.str[key][f.str(slot)]; ok {
+			s.add(rules...)
+		}
+		if len(ix.num[key]) == 0 && len(ix.lower[key]) == 0 && len(ix.upper[key]) == 0 && len(ix.cidr[key]) == 0 {
+			continue
+		}
+		if x, ok := f.num(slot); ok {
+			if rules, ok := ix.num[key][x]; ok {
+				s.add(rules...)
+			}
+			lower := ix.lower[key]
+			end := sort.Search(len(lower), func(i int) bool { return lower[i].value > x })
+			for _, b := range lower[:end] {
+				if b.value < x || b.inclusive {
+					s.add(b.rule)
+				}
+			}
+			upper := ix.upper[key]
+			start := sort.Search(len(upper), func(i int) bool { return upper[i].value >= x })
+			for _, b := range upper[start:] {
+				if b.value > x || b.inclusive {
+					s.add(b.rule)
+				}
+			}
+		}
+		if networks := ix.cidr[key]; len(networks) > 0 {
+			ip := f.ip(slot)
+			if ip4 := ip.To4(); ip4 != nil {
+				ip = ip4
+			}
+			for _, length := range ix.prefix[key] {
+				if len(ip)*8 != length.bits {
+					continue
+				}
+				length.addr = string(ip.Mask(net.CIDRMask(length.ones, length.bits)))
+				s.add(networks[length]...)
+			}
+		}
+	}
+}
+
+// lookup evaluates the candidate rules for p in the order defined by less,
+// calling fn for each rule which evaluates to true until fn returns false.
+func (ix *Index) lookup(p Params, less func(a, b int) bool, fn func(int) bool) {
+	f := ix.rs.frames.get(p)
+	defer ix.rs.frames.put(f)
+	s := ix.scratch.Get().(*scratch)
+	defer ix.scratch.Put(s)
+
+	ix.candidates(f, s)
+	sort.Slice(s.cands, func(i, j int) bool { return less(s.cands[i], s.cands[j]) })
+	for _, i := range s.cands {
+		if ix.rs.roots[i](f) && !fn(i) {
+			return
+		}
+	}
+}
+
+func byOrder(a, b int) bool { return a < b }
+
+// First returns the first rule, in the order they were added to the RuleSet,
+// which evaluates to true against p.
+func (ix *Index) First(p Params) (Rule, bool) {
+	match := -1
+	ix.lookup(p, byOrder, func(i int) bool {
+		match = i
+		return false
+	})
+	if match < 0 {
+		return Rule{}, false
+	}
+	return ix.rs.rules[match], true
+}
+
+// Best returns the rule with the highest priority which evaluates to true
+// against p, with the same tie breaking as RuleSet.Best.
+func (ix *Index) Best(p Params) (Rule, bool) {
+	match := -1
+	ix.lookup(p, func(a, b int) bool { return ix.rank[a] < ix.rank[b] }, func(i int) bool {
+		match = i
+		return false
+	})
+	if match < 0 {
+		return Rule{}, false
+	}
+	return ix.rs.rules[match], true
+}
+
+// All returns every rule which evaluates to true against p, in the order they
+// were added to the RuleSet.
+func (ix *Index) All(p Params) []Rule {
+	var matches []Rule
+	ix.lookup(p, byOrder, func(i int) bool {
+		matches = append(matches, ix.rs.rules[i])
+		return true
+	})
+	return matches
+}
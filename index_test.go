@@ -0,0 +1,173 @@
+package exp
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"reflect"
+	"testing"
+)
+
+// randomRules returns n rules mixing indexable and non indexable predicates
+// over a handful of keys.
+func randomRules(n int, rnd *rand.Rand) []Rule {
+	countries := []string{"GR", "CY", "DE", "FR", "IT", "ES", "NL", "BE"}
+	leaf := func() Exp {
+		switch rnd.Intn(9) {
+		case 0:
+			return Match("country", countries[rnd.Intn(len(countries))])
+		case 1:
+			return MatchAny("country", countries[rnd.Intn(len(countries))], countries[rnd.Intn(len(countries))])
+		case 2:
+			return Eq("amount", float64(rnd.Intn(100)))
+		case 3:
+			return Gt("amount", float64(rnd.Intn(100)))
+		case 4:
+			return Lte("amount", float64(rnd.Intn(100)))
+		case 5:
+			_, cidr, _ := net.ParseCIDR(fmt.Sprintf("10.%d.0.0/%d", rnd.Intn(4), 8+rnd.Intn(9)))
+			return ContainsIP("ip", cidr)
+		case 6:
+			return Contains("ref", "example")
+		case 7:
+			return Not(Match("status", "blocked"))
+		default:
+			return Bool(rnd.Intn(4) > 0)
+		}
+	}
+	rules := make([]Rule, n)
+	for i := range rules {
+		var e Exp
+		switch rnd.Intn(3) {
+		case 0:
+			e = And(leaf(), leaf(), leaf())
+		case 1:
+			e = Or(And(leaf(), leaf()), leaf())
+		default:
+			e = leaf()
+		}
+		rules[i] = Rule{Name: fmt.Sprint(i), Exp: e, Priority: rnd.Intn(5)}
+	}
+	return rules
+}
+
+func randomParams(rnd *rand.Rand) Map {
+	return Map{
+		"country": []string{"GR", "CY", "DE", "US"}[rnd.Intn(4)],
+		"amount":  []string{fmt.Sprint(rnd.Intn(100)), "x", ""}[rnd.Intn(3)],
+		"ip":      fmt.Sprintf("10.%d.%d.1", rnd.Intn(5), rnd.Intn(256)),
+		"ref":     []string{"https://example.com", "https://other.com"}[rnd.Intn(2)],
+		"status":  []string{"active", "blocked"}[rnd.Intn(2)],
+	}
+}
+
+func TestIndex(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	rs, err := NewRuleSet(randomRules(500, rnd)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ix := NewIndex(rs)
+
+	for i := 0; i < 200; i++ {
+		p := randomParams(rnd)
+		if want, have := names(rs.All(p)), names(ix.All(p)); !reflect.DeepEqual(want, have) {
+			t.Fatalf("All(%v) = %v, want %v", p, have, want)
+		}
+		if want, have := first(rs.First(p)), first(ix.First(p)); want != have {
+			t.Fatalf("First(%v) = %q, want %q", p, have, want)
+		}
+		if want, have := first(rs.Best(p)), first(ix.Best(p)); want != have {
+			t.Fatalf("Best(%v) = %q, want %q", p, have, want)
+		}
+	}
+}
+
+func first(r Rule, ok bool) string {
+	if !ok {
+		return "<none>"
+	}
+	return r.Name
+}
+
+func TestIndexAnchors(t *testing.T) {
+	_, cidr, _ := net.ParseCIDR("10.0.0.0/8")
+	for _, test := range []struct {
+		exp  Exp
+		kind anchorKind
+		n    int
+		ok   bool
+	}{
+		{Match("a", "x"), anchorStr, 1, true},
+		{MatchAny("a", "x", "y"), anchorStr, 2, true},
+		{Gte("a", 1), anchorLower, 1, true},
+		{And(Gt("a", 1), ContainsIP("ip", cidr), Match("b", "x")), anchorStr, 1, true},
+		{And(Gt("a", 1), ContainsIP("ip", cidr)), anchorCIDR, 1, true},
+		{And(Match("status", "active"), Gt("a", 1)), anchorLower, 1, true},
+		{Or(Match("a", "x"), Contains("b", "y")), 0, 0, false},
+		{Not(Match("a", "x")), 0, 0, false},
+		{True, 0, 0, false},
+		{False, 0, 0, true},
+	} {
+		pl := newPlanner([]Rule{
+			{Exp: test.exp},
+			{Exp: Match("status", "active")},
+			{Exp: Match("status", "active")},
+		})
+		anchors, ok := pl.anchors(test.exp)
+		if ok != test.ok || len(anchors) != test.n || (len(anchors) > 0 && anchors[0].kind != test.kind) {
+			t.Errorf("anchors(%s) = %+v, %t", test.exp, anchors, ok)
+		}
+	}
+}
+
+// benchmarkRules returns n rules anchored on a mix of equality, range and
+// network predicates, as in a rule base routing events to tenants.
+func benchmarkRules(n int) []Rule {
+	rules := make([]Rule, n)
+	for i := range rules {
+		_, cidr, _ := net.ParseCIDR(fmt.Sprintf("10.%d.%d.0/24", (i/256)%256, i%256))
+		var e Exp
+		switch i % 3 {
+		case 0:
+			e = And(Match("tenant", fmt.Sprint(i)), Gt("amount", float64(i%1000)), Contains("ref", "example"))
+		case 1:
+			e = And(ContainsIP("ip", cidr), Lt("amount", 500))
+		default:
+			e = And(Gte("score", float64(i)), Lt("score", float64(i+10)), Match("status", "active"))
+		}
+		rules[i] = Rule{Name: fmt.Sprint(i), Exp: e, Priority: i % 10}
+	}
+	return rules
+}
+
+var benchmarkIndexParams = Map{
+	"tenant": "4242",
+	"amount": "250",
+	"ref":    "https://example.com",
+	"ip":     "10.16.146.7",
+	"score":  "4240.5",
+	"status": "active",
+}
+
+func benchmarkIndex(b *testing.B, n int, indexed bool) {
+	rs, err := NewRuleSet(benchmarkRules(n)...)
+	if err != nil {
+		b.Fatal(err)
+	}
+	ix := NewIndex(rs)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if indexed {
+			ix.All(benchmarkIndexParams)
+		} else {
+			rs.All(benchmarkIndexParams)
+		}
+	}
+}
+
+func BenchmarkRuleSet10k(b *testing.B)  { benchmarkIndex(b, 10000, false) }
+func BenchmarkIndex10k(b *testing.B)    { benchmarkIndex(b, 10000, true) }
+func BenchmarkRuleSet100k(b *testing.B) { benchmarkIndex(b, 100000, false) }
+func BenchmarkIndex100k(b *testing.B)   { benchmarkIndex(b, 100000, true) }
@@ -0,0 +1,194 @@
+package exp
+
+// Op identifies the kind of expression described by a Node.
+type Op int
+
+const (
+	OpUnknown Op = iota
+	OpBool
+	OpAnd
+	OpOr
+	OpNot
+	OpMatch
+	OpContains
+	OpContainsAny
+	OpContainsRune
+	OpLen
+	OpCount
+	OpEqualFold
+	OpEq
+	OpGt
+	OpLt
+	OpOn
+	OpBefore
+	OpAfter
+	OpWeekday
+	OpDay
+	OpMonth
+	OpYear
+	OpContainsIP
+	OpRegexp
+	OpAny
+	OpAll
+	OpHasElement
+	OpSizeGt
+	OpSizeEq
+	OpIntersects
+	OpSubsetOf
+)
+
+var opName = map[Op]string{
+	OpUnknown:      "Unknown",
+	OpBool:         "Bool",
+	OpAnd:          "And",
+	OpOr:           "Or",
+	OpNot:          "Not",
+	OpMatch:        "Match",
+	OpContains:     "Contains",
+	OpContainsAny:  "ContainsAny",
+	OpContainsRune: "ContainsRune",
+	OpLen:          "Len",
+	OpCount:        "Count",
+	OpEqualFold:    "EqualFold",
+	OpEq:           "Equal",
+	OpGt:           "GreaterThan",
+	OpLt:           "LessThan",
+	OpOn:           "On",
+	OpBefore:       "Before",
+	OpAfter:        "After",
+	OpWeekday:      "Weekday",
+	OpDay:          "Day",
+	OpMonth:        "Month",
+	OpYear:         "Year",
+	OpContainsIP:   "ContainsIP",
+	OpRegexp:       "Regexp",
+	OpAny:          "Any",
+	OpAll:          "All",
+	OpHasElement:   "HasElement",
+	OpSizeGt:       "SizeGt",
+	OpSizeEq:       "SizeEq",
+	OpIntersects:   "Intersects",
+	OpSubsetOf:     "SubsetOf",
+}
+
+// String satisfies the fmt.Stringer interface.
+func (o Op) String() string {
+	if s, ok := opName[o]; ok {
+		return s
+	}
+	return sprintf("Op(%d)", int(o))
+}
+
+// Node describes a single expression so that packages outside of exp can
+// translate expressions into other representations.
+//
+// Key is the parameter the expression reads. Value holds its operand, which is
+// a bool for Bool, a string for Match, Contains, ContainsAny, EqualFold,
+// HasElement and Count, a []string for Intersects and SubsetOf, a rune for
+// ContainsRune, a float64 for Eq, Gt and Lt, a time.Time for On, Before and
+// After, a time.Weekday for Weekday, a time.Month for Month, a *net.IPNet for
+// ContainsIP and a *regexp.Regexp for Regexp. Integer operands of Len, Count,
+// Day, Year, SizeGt and SizeEq are stored in N. Elems holds the operands of
+// And, Or and Not, and the template of Any and All, whose Key is the
+// quantified key.
+type Node struct {
+	Op    Op
+	Key   string
+	Value any
+	N     int
+	Elems []Exp
+}
+
+// Inspect returns a Node describing e. Expressions not defined by this package
+// are described with OpUnknown.
+func Inspect(e Exp) Node {
+	switch e := e.(type) {
+	case Bool:
+		return Node{Op: OpBool, Value: bool(e)}
+	case expAnd:
+		return Node{Op: OpAnd, Elems: e.elems}
+	case expOr:
+		return Node{Op: OpOr, Elems: e.elems}
+	case expNot:
+		return Node{Op: OpNot, Elems: []Exp{e.elem}}
+	case expMatch:
+		return Node{Op: OpMatch, Key: e.key, Value: e.str}
+	case expContains:
+		return Node{Op: OpContains, Key: e.key, Value: e.substr}
+	case expContainsAny:
+		return Node{Op: OpContainsAny, Key: e.key, Value: e.chars}
+	case expContainsRune:
+		return Node{Op: OpContainsRune, Key: e.key, Value: e.r}
+	case expLen:
+		return Node{Op: OpLen, Key: e.key, N: e.length}
+	case expCount:
+		return Node{Op: OpCount, Key: e.key, Value: e.sep, N: e.count}
+	case expEqualFold:
+		return Node{Op: OpEqualFold, Key: e.key, Value: e.s}
+	case expEq:
+		return Node{Op: OpEq, Key: e.key, Value: e.value}
+	case expGt:
+		return Node{Op: OpGt, Key: e.key, Value: e.value}
+	case expLt:
+		return Node{Op: OpLt, Key: e.key, Value: e.value}
+	case expOn:
+		return Node{Op: OpOn, Key: e.key, Value: e.date}
+	case expBefore:
+		return Node{Op: OpBefore, Key: e.key, Value: e.date}
+	case expAfter:
+		return Node{Op: OpAfter, Key: e.key, Value: e.date}
+	case expWeekday:
+		return Node{Op: OpWeekday, Key: e.key, Value: e.weekday}
+	case expDay:
+		return Node{Op: OpDay, Key: e.key, N: e.day}
+	case expMonth:
+		return Node{Op: OpMonth, Key: e.key, Value: e.month}
+	case expYear:
+		return Node{Op: OpYear, Key: e.key, N: e.year}
+	case expContainsIP:
+		return Node{Op: OpContainsIP, Key: e.key, Value: e.cidr}
+	case expRegexp:
+		return Node{Op: OpRegexp, Key: e.key, Value: e.re}
+	case expAny:
+		return Node{Op: OpAny, Key: e.key, Elems: []Exp{e.elem}}
+	case expAll:
+		return Node{Op: OpAll, Key: e.key, Elems: []Exp{e.elem}}
+	case expHasElement:
+		return Node{Op: OpHasElement, Key: e.key, Value: e.elem}
+	case expSizeGt:
+		return Node{Op: OpSizeGt, Key: e.key, N: e.n}
+	case expSizeEq:
+		return Node{Op: OpSizeEq, Key: e.key, N: e.n}
+	case expIntersects:
+		return Node{Op: OpIntersects, Key: e.key, Value: e.set}
+	case expSubsetOf:
+		return Node{Op: OpSubsetOf, Key: e.key, Value: e.set}
+	}
+	return Node{Op: OpUnknown}
+}
+
+// inspectOrEqual reports whether e is an Or built by GreaterOrEqual or
+// LessOrEqual and returns the key, value and strict comparison, which is one
+// of OpGt or OpLt. Other packages recognize it with internal/shape.OrEqual,
+// which must be kept in step.
+func inspectOrEqual(e Exp) (key string, v float64, op Op, ok bool) {
+	or, ok := e.(expOr)
+	if !ok || len(or.elems) != 2 {
+		return "", 0, OpUnknown, false
+	}
+	eq, ok := or.elems[1].(expEq)
+	if !ok {
+		return "", 0, OpUnknown, false
+	}
+	switch cmp := or.elems[0].(type) {
+	case expGt:
+		if cmp.key == eq.key && cmp.value == eq.value {
+			return cmp.key, cmp.value, OpGt, true
+		}
+	case expLt:
+		if cmp.key == eq.key && cmp.value == eq.value {
+			return cmp.key, cmp.value, OpLt, true
+		}
+	}
+	return "", 0, OpUnknown, false
+}
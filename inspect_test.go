@@ -0,0 +1,64 @@
+package exp
+
+import (
+	"net"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestInspect(t *testing.T) {
+	_, cidr, _ := net.ParseCIDR("10.0.0.0/8")
+	date := time.Date(2014, time.December, 15, 0, 0, 0, 0, time.UTC)
+	re := regexp.MustCompile("^b")
+
+	for _, test := range []struct {
+		exp  Exp
+		node Node
+	}{
+		{True, Node{Op: OpBool, Value: true}},
+		{And(True, False), Node{Op: OpAnd, Elems: []Exp{True, False}}},
+		{Or(True), Node{Op: OpOr, Elems: []Exp{True}}},
+		{Not(True), Node{Op: OpNot, Elems: []Exp{True}}},
+		{Match("foo", "bar"), Node{Op: OpMatch, Key: "foo", Value: "bar"}},
+		{ContainsRune("foo", 'x'), Node{Op: OpContainsRune, Key: "foo", Value: 'x'}},
+		{Len("foo", 3), Node{Op: OpLen, Key: "foo", N: 3}},
+		{Count("foo", "o", 2), Node{Op: OpCount, Key: "foo", Value: "o", N: 2}},
+		{Gt("foo", 1), Node{Op: OpGt, Key: "foo", Value: 1.0}},
+		{Before("foo", date), Node{Op: OpBefore, Key: "foo", Value: date}},
+		{Month("foo", time.May), Node{Op: OpMonth, Key: "foo", Value: time.May}},
+		{Year("foo", 2014), Node{Op: OpYear, Key: "foo", N: 2014}},
+		{ContainsIP("foo", cidr), Node{Op: OpContainsIP, Key: "foo", Value: cidr}},
+		{expRegexp{"foo", re}, Node{Op: OpRegexp, Key: "foo", Value: re}},
+	} {
+		if node := Inspect(test.exp); !reflect.DeepEqual(node, test.node) {
+			t.Errorf("Inspect(%s) = %+v, want %+v", test.exp, node, test.node)
+		}
+	}
+}
+
+func TestInspectUnknown(t *testing.T) {
+	if op := Inspect(nil).Op; op != OpUnknown {
+		t.Errorf("unexpected op %s", op)
+	}
+}
+
+func TestInspectOrEqual(t *testing.T) {
+	for _, test := range []struct {
+		exp Exp
+		op  Op
+		ok  bool
+	}{
+		{Gte("foo", 1), OpGt, true},
+		{Lte("foo", 1), OpLt, true},
+		{Or(Gt("foo", 1), Eq("foo", 2)), OpUnknown, false},
+		{Or(Gt("foo", 1), Eq("bar", 1)), OpUnknown, false},
+		{Or(Eq("foo", 1), Gt("foo", 1)), OpUnknown, false},
+	} {
+		_, _, op, ok := inspectOrEqual(test.exp)
+		if op != test.op || ok != test.ok {
+			t.Errorf("inspectOrEqual(%s) = %s %t", test.exp, op, ok)
+		}
+	}
+}
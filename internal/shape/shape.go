@@ -0,0 +1,42 @@
+// Package shape recognizes expressions built by the helpers of package exp out
+// of several nodes, such as MatchAny and GreaterOrEqual, so that translators
+// may render them as a single operator.
+package shape
+
+import "github.com/alexkappa/exp"
+
+// MatchAny reports whether n is an Or built by exp.MatchAny, that is two or
+// more matches against the same key, and returns the key and the strings
+// matched.
+func MatchAny(n exp.Node) (key string, strs []string, ok bool) {
+	if n.Op != exp.OpOr || len(n.Elems) < 2 {
+		return "", nil, false
+	}
+	strs = make([]string, len(n.Elems))
+	for i, elem := range n.Elems {
+		m := exp.Inspect(elem)
+		if m.Op != exp.OpMatch || (i > 0 && m.Key != key) {
+			return "", nil, false
+		}
+		key, strs[i] = m.Key, m.Value.(string)
+	}
+	return key, strs, true
+}
+
+// OrEqual reports whether n is an Or built by exp.GreaterOrEqual or
+// exp.LessOrEqual and returns the key, the value and the strict comparison,
+// which is one of exp.OpGt or exp.OpLt.
+func OrEqual(n exp.Node) (key string, v float64, op exp.Op, ok bool) {
+	if n.Op != exp.OpOr || len(n.Elems) != 2 {
+		return "", 0, exp.OpUnknown, false
+	}
+	cmp, eq := exp.Inspect(n.Elems[0]), exp.Inspect(n.Elems[1])
+	if eq.Op != exp.OpEq || cmp.Key != eq.Key || cmp.Value != eq.Value {
+		return "", 0, exp.OpUnknown, false
+	}
+	switch cmp.Op {
+	case exp.OpGt, exp.OpLt:
+		return cmp.Key, cmp.Value.(float64), cmp.Op, true
+	}
+	return "", 0, exp.OpUnknown, false
+}
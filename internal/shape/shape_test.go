@@ -0,0 +1,45 @@
+package shape
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/alexkappa/exp"
+)
+
+func TestMatchAny(t *testing.T) {
+	key, strs, ok := MatchAny(exp.Inspect(exp.MatchAny("foo", "a", "b")))
+	if !ok || key != "foo" || !reflect.DeepEqual(strs, []string{"a", "b"}) {
+		t.Errorf("unexpected result %q %q %t", key, strs, ok)
+	}
+	for _, e := range []exp.Exp{
+		exp.MatchAny("foo", "a"),
+		exp.Or(exp.Match("foo", "a"), exp.Match("bar", "b")),
+		exp.Or(exp.Match("foo", "a"), exp.True),
+		exp.And(exp.Match("foo", "a"), exp.Match("foo", "b")),
+	} {
+		if _, _, ok := MatchAny(exp.Inspect(e)); ok {
+			t.Errorf("%s should not be reported as MatchAny", e)
+		}
+	}
+}
+
+func TestOrEqual(t *testing.T) {
+	for _, test := range []struct {
+		exp exp.Exp
+		op  exp.Op
+		ok  bool
+	}{
+		{exp.Gte("foo", 1), exp.OpGt, true},
+		{exp.Lte("foo", 1), exp.OpLt, true},
+		{exp.Or(exp.Gt("foo", 1), exp.Eq("foo", 2)), exp.OpUnknown, false},
+		{exp.Or(exp.Gt("foo", 1), exp.Eq("bar", 1)), exp.OpUnknown, false},
+		{exp.Or(exp.Eq("foo", 1), exp.Gt("foo", 1)), exp.OpUnknown, false},
+		{exp.Or(exp.Match("foo", "1"), exp.Eq("foo", 1)), exp.OpUnknown, false},
+	} {
+		_, _, op, ok := OrEqual(exp.Inspect(test.exp))
+		if op != test.op || ok != test.ok {
+			t.Errorf("OrEqual(%s) = %s %t", test.exp, op, ok)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+// Package jsonlogic translates expressions to and from JSONLogic
+// (https://jsonlogic.com) so that rules can be authored in the browser and
+// enforced on the server.
+//
+//	e, err := jsonlogic.Decode([]byte(`{"and": [
+//		{"==": [{"var": "country"}, "GR"]},
+//		{">": [{"var": "amount"}, 100]}
+//	]}`))
+//
+// The operators and, or, !, ==, !=, <, <=, >, >=, in and var are supported.
+// Comparisons must have a var on one side and a string or number literal on the
+// other. Comparing against a string produces a string expression such as
+// exp.Match and comparing against a number produces a numeric expression such
+// as exp.Equal.
+package jsonlogic
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/alexkappa/exp"
+	"github.com/alexkappa/exp/internal/shape"
+)
+
+// ErrUnsupported is returned for expressions or JSONLogic rules which have no
+// equivalent in the other representation.
+var ErrUnsupported = errors.New("jsonlogic: unsupported expression")
+
+// Decode parses the JSONLogic rule data into an expression.
+func Decode(data []byte) (exp.Exp, error) {
+	var rule any
+	if err := json.Unmarshal(data, &rule); err != nil {
+		return nil, err
+	}
+	return decode(rule)
+}
+
+// Encode returns the JSONLogic encoding of e.
+func Encode(e exp.Exp) ([]byte, error) {
+	rule, err := encode(e)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(rule); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(b.Bytes(), "\n"), nil
+}
+
+func decode(rule any) (exp.Exp, error) {
+	switch rule := rule.(type) {
+	case bool:
+		return exp.Bool(rule), nil
+	case map[string]any:
+		if len(rule) != 1 {
+			return nil, fmt.Errorf("jsonlogic: rule must have exactly one operator, have %d", len(rule))
+		}
+		for op, args := range rule {
+			return decodeOp(op, args)
+		}
+	}
+	return nil, fmt.Errorf("jsonlogic: unexpected rule %v", rule)
+}
+
+func decodeOp(op string, v any) (exp.Exp, error) {
+	args, ok := v.([]any)
+	if !ok {
+		// Unary operators may omit the array around their argument.
+		args = []any{v}
+	}
+	switch op {
+	case "and", "or":
+		elems := make([]exp.Exp, len(args))
+		for i, arg := range args {
+			e, err := decode(arg)
+			if err != nil {
+				return nil, err
+			}
+			elems[i] = e
+		}
+		if op == "and" {
+			return exp.And(elems...), nil
+		}
+		return exp.Or(elems...), nil
+	case "!":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("jsonlogic: ! expects 1 argument, have %d", len(args))
+		}
+		e, err := decode(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return exp.Not(e), nil
+	case "==", "!=":
+		key, value, err := operands(op, args)
+		if err != nil {
+			return nil, err
+		}
+		var e exp.Exp
+		switch value := value.(type) {
+		case string:
+			e = exp.Match(key, value)
+		case float64:
+			e = exp.Equal(key, value)
+		default:
+			return nil, fmt.Errorf("jsonlogic: %s expects a string or number, have %v", op, value)
+		}
+		if op == "!=" {
+			return exp.Not(e), nil
+		}
+		return e, nil
+	case "<", "<=", ">", ">=":
+		if len(args) == 3 {
+			// Between: {"<": [1, {"var": "x"}, 10]}.
+			lo, err := decodeOp(op, args[:2])
+			if err != nil {
+				return nil, err
+			}
+			hi, err := decodeOp(op, args[1:])
+			if err != nil {
+				return nil, err
+			}
+			return exp.And(lo, hi), nil
+		}
+		if len(args) != 2 {
+			return nil, fmt.Errorf("jsonlogic: %s expects 2 or 3 arguments, have %d", op, len(args))
+		}
+		if _, ok := variable(args[0]); !ok {
+			// The literal is on the left, so flip the comparison.
+			args = []any{args[1], args[0]}
+			op = flip[op]
+		}
+		key, value, err := operands(op, args)
+		if err != nil {
+			return nil, err
+		}
+		f, ok := value.(float64)
+		if !ok {
+			return nil, fmt.Errorf("jsonlogic: %s expects a number, have %v", op, value)
+		}
+		switch op {
+		case "<":
+			return exp.LessThan(key, f), nil
+		case "<=":
+			return exp.LessOrEqual(key, f), nil
+		case ">":
+			return exp.GreaterThan(key, f), nil
+		default:
+			return exp.GreaterOrEqual(key, f), nil
+		}
+	case "in":
+		if len(args) != 2 {
+			return nil, fmt.Errorf("jsonlogic: in expects 2 arguments, have %d", len(args))
+		}
+		if key, ok := variable(args[1]); ok {
+			// Substring: {"in": ["foo", {"var": "x"}]}.
+			substr, ok := args[0].(string)
+			if !ok {
+				return nil, fmt.Errorf("jsonlogic: in expects a string, have %v", args[0])
+			}
+			return exp.Contains(key, substr), nil
+		}
+		key, ok := variable(args[0])
+		if !ok {
+			return nil, fmt.Errorf("jsonlogic: in expects a var argument")
+		}
+		list, ok := args[1].([]any)
+		if !ok {
+			return nil, fmt.Errorf("jsonlogic: in expects an array, have %v", args[1])
+		}
+		elems := make([]exp.Exp, len(list))
+		for i, item := range list {
+			switch item := item.(type) {
+			case string:
+				elems[i] = exp.Match(key, item)
+			case float64:
+				elems[i] = exp.Equal(key, item)
+			default:
+				return nil, fmt.Errorf("jsonlogic: in expects strings or numbers, have %v", item)
+			}
+		}
+		return exp.Or(elems...), nil
+	}
+	return nil, fmt.Errorf("%w operator %q", ErrUnsupported, op)
+}
+
+var flip = map[string]string{
+	"<":  ">",
+	"<=": ">=",
+	">":  "<",
+	">=": "<=",
+}
+
+// operands returns the key and literal value of a binary comparison in which
+// the var appears on either side.
+func operands(op string, args []any) (string, any, error) {
+	if len(args) != 2 {
+		return "", nil, fmt.Errorf("jsonlogic: %s expects 2 arguments, have %d", op, len(args))
+	}
+	if key, ok := variable(args[0]); ok {
+		return key, args[1], nil
+	}
+	if key, ok := variable(args[1]); ok {
+		return key, args[0], nil
+	}
+	return "", nil, fmt.Errorf("jsonlogic: %s expects a var argument", op)
+}
+
+// variable returns the name of v if it is a {"var": name} rule. Default values
+// are not supported.
+func variable(v any) (string, bool) {
+	m, ok := v.(map[string]any)
+	if !ok || len(m) != 1 {
+		return "", false
+	}
+	switch name := m["var"].(type) {
+	case string:
+		return name, true
+	case []any:
+		if len(name) == 1 {
+			s, ok := name[0].(string)
+			return s, ok
+		}
+	}
+	return "", false
+}
+
+func encode(e exp.Exp) (any, error) {
+	n := exp.Inspect(e)
+	switch n.Op {
+	case exp.OpBool:
+		return n.Value, nil
+	case exp.OpAnd, exp.OpOr:
+		if n.Op == exp.OpOr {
+			if key, strs, ok := shape.MatchAny(n); ok {
+				return op("in", v(key), strs), nil
+			}
+			if key, value, cmp, ok := shape.OrEqual(n); ok {
+				if cmp == exp.OpGt {
+					return op(">=", v(key), value), nil
+				}
+				return op("<=", v(key), value), nil
+			}
+		}
+		args := make([]any, len(n.Elems))
+		for i, elem := range n.Elems {
+			rule, err := encode(elem)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = rule
+		}
+		if n.Op == exp.OpAnd {
+			return op("and", args...), nil
+		}
+		return op("or", args...), nil
+	case exp.OpNot:
+		rule, err := encode(n.Elems[0])
+		if err != nil {
+			return nil, err
+		}
+		return op("!", rule), nil
+	case exp.OpMatch, exp.OpEq:
+		return op("==", v(n.Key), n.Value), nil
+	case exp.OpGt:
+		return op(">", v(n.Key), n.Value), nil
+	case exp.OpLt:
+		return op("<", v(n.Key), n.Value), nil
+	case exp.OpContains:
+		return op("in", n.Value, v(n.Key)), nil
+	}
+	return nil, fmt.Errorf("%w %v", ErrUnsupported, e)
+}
+
+func op(name string, args ...any) map[string]any {
+	return map[string]any{name: args}
+}
+
+func v(key string) map[string]any {
+	return map[string]any{"var": key}
+}
@@ -0,0 +1,102 @@
+package jsonlogic
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alexkappa/exp"
+)
+
+func TestDecode(t *testing.T) {
+	for _, test := range []struct {
+		json string
+		exp  exp.Exp
+	}{
+		{`true`, exp.True},
+		{`{"==": [{"var": "country"}, "GR"]}`, exp.Match("country", "GR")},
+		{`{"==": ["GR", {"var": "country"}]}`, exp.Match("country", "GR")},
+		{`{"==": [{"var": "amount"}, 10]}`, exp.Equal("amount", 10)},
+		{`{"!=": [{"var": ["amount"]}, 10]}`, exp.Not(exp.Equal("amount", 10))},
+		{`{"<": [{"var": "amount"}, 10]}`, exp.LessThan("amount", 10)},
+		{`{"<": [10, {"var": "amount"}]}`, exp.GreaterThan("amount", 10)},
+		{`{">=": [{"var": "amount"}, 10]}`, exp.GreaterOrEqual("amount", 10)},
+		{`{"<": [1, {"var": "x"}, 10]}`, exp.And(exp.GreaterThan("x", 1), exp.LessThan("x", 10))},
+		{`{"!": {"var": "x"}}`, nil},
+		{`{"!": [true]}`, exp.Not(exp.True)},
+		{`{"!": true}`, exp.Not(exp.True)},
+		{`{"in": [{"var": "country"}, ["GR", "CY"]]}`, exp.MatchAny("country", "GR", "CY")},
+		{`{"in": ["google", {"var": "referrer"}]}`, exp.Contains("referrer", "google")},
+		{
+			`{"and": [{"==": [{"var": "a"}, "x"]}, {"or": [{">": [{"var": "b"}, 1]}, false]}]}`,
+			exp.And(exp.Match("a", "x"), exp.Or(exp.GreaterThan("b", 1), exp.False)),
+		},
+	} {
+		e, err := Decode([]byte(test.json))
+		if test.exp == nil {
+			if err == nil {
+				t.Errorf("%s: expected error", test.json)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.json, err)
+			continue
+		}
+		if !reflect.DeepEqual(e, test.exp) {
+			t.Errorf("unexpected expression.\n\twant: %v\n\thave: %v", test.exp, e)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	for _, test := range []struct {
+		exp  exp.Exp
+		json string
+	}{
+		{exp.False, `false`},
+		{exp.Match("country", "GR"), `{"==":[{"var":"country"},"GR"]}`},
+		{exp.Not(exp.Gt("amount", 1.5)), `{"!":[{">":[{"var":"amount"},1.5]}]}`},
+		{exp.Lte("amount", 2), `{"<=":[{"var":"amount"},2]}`},
+		{exp.MatchAny("country", "GR", "CY"), `{"in":[{"var":"country"},["GR","CY"]]}`},
+		{exp.Contains("referrer", "google"), `{"in":["google",{"var":"referrer"}]}`},
+		{exp.Or(exp.True, exp.Lt("a", 1)), `{"or":[true,{"<":[{"var":"a"},1]}]}`},
+	} {
+		b, err := Encode(test.exp)
+		if err != nil {
+			t.Errorf("%s: %s", test.exp, err)
+			continue
+		}
+		if string(b) != test.json {
+			t.Errorf("unexpected json.\n\twant: %s\n\thave: %s", test.json, b)
+		}
+		e, err := Decode(b)
+		if err != nil {
+			t.Errorf("%s: %s", b, err)
+			continue
+		}
+		if !reflect.DeepEqual(e, test.exp) {
+			t.Errorf("unexpected expression.\n\twant: %v\n\thave: %v", test.exp, e)
+		}
+	}
+}
+
+func TestUnsupported(t *testing.T) {
+	for _, s := range []string{
+		`{"+": [1, 2]}`,
+		`{"some": [{"var": "a"}, {"==": [{"var": ""}, 1]}]}`,
+	} {
+		if _, err := Decode([]byte(s)); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("%s: expected ErrUnsupported, have %v", s, err)
+		}
+	}
+	for _, e := range []exp.Exp{
+		exp.Year("date", 2014),
+		exp.And(exp.Weekday("date", time.Monday)),
+	} {
+		if _, err := Encode(e); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("%v: expected ErrUnsupported, have %v", e, err)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package exp
+
+import "strings"
+
+// Split returns MultiParams reading lists from p, where every value of p is a
+// list of elements separated by sep, such as "admin,dev" with sep ",". An
+// empty value is an empty list.
+//
+//	p := Split(Map{"roles": "admin,dev"}, ",")
+//	HasElement("roles", "dev").Eval(p) // true
+func Split(p Params, sep string) MultiParams {
+	return split{p, sep}
+}
+
+type split struct {
+	p   Params
+	sep string
+}
+
+// Get returns the value of key, which is the list as a whole.
+func (s split) Get(key string) string {
+	return s.p.Get(key)
+}
+
+// GetAll returns the elements of the list pointed to by key.
+func (s split) GetAll(key string) []string {
+	v := s.p.Get(key)
+	if v == "" {
+		return nil
+	}
+	return strings.Split(v, s.sep)
+}
+
+// newSet returns the elements of set as the keys of a map.
+func newSet(set []string) map[string]bool {
+	m := make(map[string]bool, len(set))
+	for _, s := range set {
+		m[s] = true
+	}
+	return m
+}
+
+// HasElement
+
+type expHasElement struct {
+	key, elem string
+}
+
+func (e expHasElement) Eval(p Params) bool {
+	for _, v := range getAll(p, e.key) {
+		if v == e.elem {
+			return true
+		}
+	}
+	return false
+}
+
+func (e expHasElement) String() string {
+	return sprintf("[%s∋{%s}]", e.key, e.elem)
+}
+
+// HasElement evaluates to true if elem is one of the values of key. The
+// values of a key are read as described by Any.
+//
+//	p := Values(url.Values{"role": {"dev", "admin"}})
+//	HasElement("role", "admin").Eval(p) // true
+func HasElement(key, elem string) Exp {
+	return expHasElement{key, elem}
+}
+
+// SizeGt
+
+type expSizeGt struct {
+	key string
+	n   int
+}
+
+func (e expSizeGt) Eval(p Params) bool {
+	return len(getAll(p, e.key)) > e.n
+}
+
+func (e expSizeGt) String() string {
+	return sprintf("[|%s|>%d]", e.key, e.n)
+}
+
+// SizeGt evaluates to true if key has more than n values.
+func SizeGt(key string, n int) Exp {
+	return expSizeGt{key, n}
+}
+
+// SizeEq
+
+type expSizeEq struct {
+	key string
+	n   int
+}
+
+func (e expSizeEq) Eval(p Params) bool {
+	return len(getAll(p, e.key)) == e.n
+}
+
+func (e expSizeEq) String() string {
+	return sprintf("[|%s|==%d]", e.key, e.n)
+}
+
+// SizeEq evaluates to true if key has exactly n values.
+func SizeEq(key string, n int) Exp {
+	return expSizeEq{key, n}
+}
+
+// Intersects
+
+type expIntersects struct {
+	key string
+	set []string
+	m   map[string]bool
+}
+
+func (e expIntersects) Eval(p Params) bool {
+	for _, v := range getAll(p, e.key) {
+		if e.m[v] {
+			return true
+		}
+	}
+	return false
+}
+
+func (e expIntersects) String() string {
+	return sprintf("[%s∩{%s}]", e.key, strings.Join(e.set, ","))
+}
+
+// Intersects evaluates to true if any of the values of key is in set.
+//
+//	p := Values(url.Values{"group": {"eng", "ops"}})
+//	Intersects("group", "ops", "sec").Eval(p) // true
+func Intersects(key string, set ...string) Exp {
+	return expIntersects{key, set, newSet(set)}
+}
+
+// SubsetOf
+
+type expSubsetOf struct {
+	key string
+	set []string
+	m   map[string]bool
+}
+
+func (e expSubsetOf) Eval(p Params) bool {
+	for _, v := range getAll(p, e.key) {
+		if !e.m[v] {
+			return false
+		}
+	}
+	return true
+}
+
+func (e expSubsetOf) String() string {
+	return sprintf("[%s⊆{%s}]", e.key, strings.Join(e.set, ","))
+}
+
+// SubsetOf evaluates to true if all of the values of key are in set, which
+// includes the case where key has no values.
+//
+//	p := Values(url.Values{"scope": {"read", "write"}})
+//	SubsetOf("scope", "read", "write", "admin").Eval(p) // true
+func SubsetOf(key string, set ...string) Exp {
+	return expSubsetOf{key, set, newSet(set)}
+}
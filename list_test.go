@@ -0,0 +1,73 @@
+package exp
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	p := Split(Map{"roles": "admin,dev", "empty": ""}, ",")
+	if have := p.Get("roles"); have != "admin,dev" {
+		t.Errorf("Get(roles) = %q", have)
+	}
+	for key, want := range map[string][]string{
+		"roles":   {"admin", "dev"},
+		"empty":   nil,
+		"missing": nil,
+	} {
+		if have := p.GetAll(key); !reflect.DeepEqual(have, want) {
+			t.Errorf("GetAll(%q) = %q, want %q", key, have, want)
+		}
+	}
+}
+
+func TestListPredicates(t *testing.T) {
+	p := Values(url.Values{
+		"roles":  {"admin", "dev"},
+		"groups": {"eng", "ops"},
+	})
+	for _, test := range []struct {
+		exp  Exp
+		p    Params
+		want bool
+	}{
+		{HasElement("roles", "dev"), p, true},
+		{HasElement("roles", "ops"), p, false},
+		{HasElement("roles", "dev"), Map{"roles": "dev"}, true},
+		{HasElement("roles", "dev"), Split(Map{"roles": "admin,dev"}, ","), true},
+		{SizeGt("roles", 1), p, true},
+		{SizeGt("roles", 2), p, false},
+		{SizeEq("roles", 2), p, true},
+		{SizeEq("missing", 0), p, true},
+		{SizeEq("missing", 0), Map{}, true},
+		{SizeEq("roles", 1), Map{"roles": "dev"}, true},
+		{Intersects("groups", "ops", "sec"), p, true},
+		{Intersects("groups", "sec"), p, false},
+		{Intersects("groups"), p, false},
+		{SubsetOf("groups", "eng", "ops", "sec"), p, true},
+		{SubsetOf("groups", "eng"), p, false},
+		{SubsetOf("missing", "eng"), p, true},
+	} {
+		if have := test.exp.Eval(test.p); have != test.want {
+			t.Errorf("%s.Eval(%v) = %t, want %t", test.exp, test.p, have, test.want)
+		}
+	}
+}
+
+func TestListString(t *testing.T) {
+	for _, test := range []struct {
+		exp Exp
+		str string
+	}{
+		{HasElement("roles", "dev"), "[roles∋{dev}]"},
+		{SizeGt("roles", 1), "[|roles|>1]"},
+		{SizeEq("roles", 2), "[|roles|==2]"},
+		{Intersects("groups", "a", "b"), "[groups∩{a,b}]"},
+		{SubsetOf("groups", "a", "b"), "[groups⊆{a,b}]"},
+	} {
+		if str := sprintf("%s", test.exp); str != test.str {
+			t.Errorf("String() = %s, want %s", str, test.str)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+// Package mongo translates expressions to and from MongoDB style query filter
+// documents.
+//
+//	f, err := mongo.Filter(exp.And(
+//		exp.Match("country", "GR"),
+//		exp.GreaterThan("amount", 100),
+//	))
+//
+//	// f: {"$and": [{"country": {"$eq": "GR"}}, {"amount": {"$gt": 100}}]}
+//
+// Dates are exported as time.Time values. When a filter is read back from JSON,
+// RFC 3339 strings or extended JSON {"$date": ...} objects are accepted wherever
+// a date is expected.
+package mongo
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/alexkappa/exp"
+	"github.com/alexkappa/exp/internal/shape"
+)
+
+// ErrUnsupported is returned for expressions or filters which have no
+// equivalent in the other representation.
+var ErrUnsupported = errors.New("mongo: unsupported expression")
+
+// Filter returns a filter document equivalent to e.
+func Filter(e exp.Exp) (map[string]any, error) {
+	n := exp.Inspect(e)
+	switch n.Op {
+	case exp.OpBool:
+		if n.Value.(bool) {
+			return map[string]any{}, nil
+		}
+		return map[string]any{"$expr": false}, nil
+	case exp.OpAnd:
+		return list("$and", n.Elems)
+	case exp.OpOr:
+		if key, strs, ok := shape.MatchAny(n); ok {
+			return field(key, "$in", strs), nil
+		}
+		if key, v, op, ok := shape.OrEqual(n); ok {
+			if op == exp.OpGt {
+				return field(key, "$gte", v), nil
+			}
+			return field(key, "$lte", v), nil
+		}
+		return list("$or", n.Elems)
+	case exp.OpNot:
+		inner := exp.Inspect(n.Elems[0])
+		switch inner.Op {
+		case exp.OpMatch, exp.OpEq:
+			return field(inner.Key, "$ne", inner.Value), nil
+		case exp.OpOr:
+			if key, strs, ok := shape.MatchAny(inner); ok {
+				return field(key, "$nin", strs), nil
+			}
+		}
+		return list("$nor", n.Elems)
+	case exp.OpMatch, exp.OpEq, exp.OpOn:
+		return field(n.Key, "$eq", n.Value), nil
+	case exp.OpGt, exp.OpAfter:
+		return field(n.Key, "$gt", n.Value), nil
+	case exp.OpLt, exp.OpBefore:
+		return field(n.Key, "$lt", n.Value), nil
+	case exp.OpContains:
+		return field(n.Key, "$regex", regexp.QuoteMeta(n.Value.(string))), nil
+	case exp.OpYear:
+		return extract("$year", n.Key, n.N), nil
+	case exp.OpMonth:
+		return extract("$month", n.Key, int(n.Value.(time.Month))), nil
+	}
+	return nil, fmt.Errorf("%w %s", ErrUnsupported, e)
+}
+
+func field(key, op string, value any) map[string]any {
+	return map[string]any{key: map[string]any{op: value}}
+}
+
+func list(op string, elems []exp.Exp) (map[string]any, error) {
+	filters := make([]any, len(elems))
+	for i, elem := range elems {
+		f, err := Filter(elem)
+		if err != nil {
+			return nil, err
+		}
+		filters[i] = f
+	}
+	return map[string]any{op: filters}, nil
+}
+
+func extract(op, key string, value int) map[string]any {
+	return map[string]any{
+		"$expr": map[string]any{
+			"$eq": []any{map[string]any{op: "$" + key}, value},
+		},
+	}
+}
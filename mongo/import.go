@@ -0,0 +1,327 @@
+package mongo
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp/syntax"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alexkappa/exp"
+)
+
+// Parse returns an expression equivalent to the filter document f. Fields
+// compared against strings produce string expressions, fields compared against
+// numbers produce numeric expressions and fields compared against dates produce
+// date expressions. Regular expressions are only supported if they match a
+// literal string, optionally anchored at both ends.
+func Parse(f map[string]any) (exp.Exp, error) {
+	var elems []exp.Exp
+	for _, key := range keys(f) {
+		e, err := parseKey(key, f[key])
+		if err != nil {
+			return nil, err
+		}
+		elems = append(elems, e)
+	}
+	switch len(elems) {
+	case 0:
+		return exp.True, nil
+	case 1:
+		return elems[0], nil
+	}
+	return exp.And(elems...), nil
+}
+
+// Unmarshal parses the JSON encoded filter document data.
+func Unmarshal(data []byte) (exp.Exp, error) {
+	var f map[string]any
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	return Parse(f)
+}
+
+// Marshal returns the JSON encoding of the filter document equivalent to e.
+// Dates are encoded as extended JSON {"$date": ...} objects so that they can be
+// distinguished from strings when read back with Unmarshal.
+func Marshal(e exp.Exp) ([]byte, error) {
+	f, err := Filter(e)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(extended(f))
+}
+
+func extended(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for key, value := range v {
+			m[key] = extended(value)
+		}
+		return m
+	case []any:
+		s := make([]any, len(v))
+		for i, value := range v {
+			s[i] = extended(value)
+		}
+		return s
+	case time.Time:
+		return map[string]any{"$date": v.Format(time.RFC3339Nano)}
+	}
+	return v
+}
+
+func parseKey(key string, value any) (exp.Exp, error) {
+	switch key {
+	case "$and", "$or", "$nor":
+		elems, err := parseList(key, value)
+		if err != nil {
+			return nil, err
+		}
+		switch key {
+		case "$and":
+			return exp.And(elems...), nil
+		case "$or":
+			return exp.Or(elems...), nil
+		}
+		if len(elems) == 1 {
+			return exp.Not(elems[0]), nil
+		}
+		return exp.Not(exp.Or(elems...)), nil
+	case "$expr":
+		return parseExpr(value)
+	}
+	if strings.HasPrefix(key, "$") {
+		return nil, fmt.Errorf("%w operator %s", ErrUnsupported, key)
+	}
+	ops, ok := value.(map[string]any)
+	if !ok || isDate(ops) {
+		return parseOp(key, "$eq", value)
+	}
+	if _, ok := ops["$options"]; ok {
+		if _, ok := ops["$regex"]; !ok {
+			return nil, fmt.Errorf("mongo: $options without $regex for field %q", key)
+		}
+	}
+	var elems []exp.Exp
+	for _, op := range keys(ops) {
+		if op == "$options" {
+			continue
+		}
+		if op == "$regex" {
+			if options, _ := ops["$options"].(string); options != "" {
+				return nil, fmt.Errorf("%w $options %q for field %q", ErrUnsupported, options, key)
+			}
+		}
+		e, err := parseOp(key, op, ops[op])
+		if err != nil {
+			return nil, err
+		}
+		elems = append(elems, e)
+	}
+	switch len(elems) {
+	case 0:
+		return nil, fmt.Errorf("mongo: empty operator document for field %q", key)
+	case 1:
+		return elems[0], nil
+	}
+	return exp.And(elems...), nil
+}
+
+func parseList(op string, value any) ([]exp.Exp, error) {
+	list, ok := value.([]any)
+	if !ok || len(list) == 0 {
+		return nil, fmt.Errorf("mongo: %s expects a non-empty array", op)
+	}
+	elems := make([]exp.Exp, len(list))
+	for i, item := range list {
+		f, ok := item.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("mongo: %s expects an array of documents", op)
+		}
+		e, err := Parse(f)
+		if err != nil {
+			return nil, err
+		}
+		elems[i] = e
+	}
+	return elems, nil
+}
+
+func parseOp(key, op string, value any) (exp.Exp, error) {
+	switch op {
+	case "$eq":
+		if s, ok := value.(string); ok {
+			return exp.Match(key, s), nil
+		}
+		if f, ok := number(value); ok {
+			return exp.Equal(key, f), nil
+		}
+		if t, ok := date(value); ok {
+			return exp.On(key, t), nil
+		}
+	case "$ne":
+		e, err := parseOp(key, "$eq", value)
+		if err != nil {
+			return nil, err
+		}
+		return exp.Not(e), nil
+	case "$gt", "$gte", "$lt", "$lte":
+		if f, ok := number(value); ok {
+			switch op {
+			case "$gt":
+				return exp.GreaterThan(key, f), nil
+			case "$gte":
+				return exp.GreaterOrEqual(key, f), nil
+			case "$lt":
+				return exp.LessThan(key, f), nil
+			default:
+				return exp.LessOrEqual(key, f), nil
+			}
+		}
+		if t, ok := date(value); ok {
+			switch op {
+			case "$gt":
+				return exp.After(key, t), nil
+			case "$gte":
+				return exp.Or(exp.After(key, t), exp.On(key, t)), nil
+			case "$lt":
+				return exp.Before(key, t), nil
+			default:
+				return exp.Or(exp.Before(key, t), exp.On(key, t)), nil
+			}
+		}
+	case "$in", "$nin":
+		list, ok := value.([]any)
+		if !ok {
+			return nil, fmt.Errorf("mongo: %s expects an array for field %q", op, key)
+		}
+		elems := make([]exp.Exp, len(list))
+		for i, item := range list {
+			e, err := parseOp(key, "$eq", item)
+			if err != nil {
+				return nil, err
+			}
+			elems[i] = e
+		}
+		if op == "$nin" {
+			return exp.Not(exp.Or(elems...)), nil
+		}
+		return exp.Or(elems...), nil
+	case "$regex":
+		pattern, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("mongo: $regex expects a string for field %q", key)
+		}
+		return parseRegex(key, pattern)
+	default:
+		return nil, fmt.Errorf("%w operator %s", ErrUnsupported, op)
+	}
+	return nil, fmt.Errorf("mongo: unexpected operand %v to %s for field %q", value, op, key)
+}
+
+// parseRegex converts pattern into Contains if it matches a literal, or Match if
+// it matches a literal anchored at both ends.
+func parseRegex(key, pattern string) (exp.Exp, error) {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return nil, fmt.Errorf("mongo: invalid $regex for field %q: %w", key, err)
+	}
+	re = re.Simplify()
+	switch {
+	case re.Op == syntax.OpEmptyMatch:
+		return exp.Contains(key, ""), nil
+	case isLiteral(re):
+		return exp.Contains(key, string(re.Rune)), nil
+	case re.Op == syntax.OpConcat && len(re.Sub) == 3 &&
+		re.Sub[0].Op == syntax.OpBeginText &&
+		isLiteral(re.Sub[1]) &&
+		re.Sub[2].Op == syntax.OpEndText:
+		return exp.Match(key, string(re.Sub[1].Rune)), nil
+	}
+	return nil, fmt.Errorf("%w $regex %q", ErrUnsupported, pattern)
+}
+
+func isLiteral(re *syntax.Regexp) bool {
+	return re.Op == syntax.OpLiteral && re.Flags&syntax.FoldCase == 0
+}
+
+// parseExpr supports boolean literals and the year and month extraction
+// produced by Filter.
+func parseExpr(value any) (exp.Exp, error) {
+	if b, ok := value.(bool); ok {
+		return exp.Bool(b), nil
+	}
+	if m, ok := value.(map[string]any); ok && len(m) == 1 {
+		if args, ok := m["$eq"].([]any); ok && len(args) == 2 {
+			x, _ := args[0].(map[string]any)
+			n, isNum := number(args[1])
+			if len(x) == 1 && isNum {
+				for op, ref := range x {
+					field, _ := ref.(string)
+					if !strings.HasPrefix(field, "$") {
+						break
+					}
+					switch op {
+					case "$year":
+						return exp.Year(field[1:], int(n)), nil
+					case "$month":
+						return exp.Month(field[1:], time.Month(n)), nil
+					}
+				}
+			}
+		}
+	}
+	return nil, fmt.Errorf("%w $expr %v", ErrUnsupported, value)
+}
+
+func number(v any) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func date(v any) (time.Time, bool) {
+	switch v := v.(type) {
+	case time.Time:
+		return v, true
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, v)
+		return t, err == nil
+	case map[string]any:
+		if isDate(v) {
+			return date(v["$date"])
+		}
+	}
+	return time.Time{}, false
+}
+
+func isDate(m map[string]any) bool {
+	_, ok := m["$date"]
+	return ok && len(m) == 1
+}
+
+func keys(m map[string]any) []string {
+	s := make([]string, 0, len(m))
+	for key := range m {
+		s = append(s, key)
+	}
+	sort.Strings(s)
+	return s
+}
@@ -0,0 +1,131 @@
+package mongo
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alexkappa/exp"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func TestGolden(t *testing.T) {
+	date := time.Date(2014, time.December, 15, 0, 0, 0, 0, time.UTC)
+
+	for _, test := range []struct {
+		name string
+		exp  exp.Exp
+	}{
+		{"true", exp.True},
+		{"false", exp.False},
+		{"match", exp.Match("country", "GR")},
+		{"not_match", exp.Not(exp.Match("country", "GR"))},
+		{"match_any", exp.MatchAny("country", "GR", "CY")},
+		{"not_match_any", exp.Not(exp.MatchAny("country", "GR", "CY"))},
+		{"contains", exp.Contains("referrer", "google.com")},
+		{"numbers", exp.And(exp.Gt("amount", 10), exp.Lte("amount", 99.9), exp.Neq("qty", 0))},
+		{"dates", exp.Or(exp.Before("date", date), exp.After("date", date), exp.On("date", date))},
+		{"year_month", exp.And(exp.Year("date", 2014), exp.Month("date", time.December))},
+		{"nor", exp.Not(exp.And(exp.Match("a", "x"), exp.Eq("b", 1)))},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			b, err := Marshal(test.exp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var have bytes.Buffer
+			if err := json.Indent(&have, b, "", "\t"); err != nil {
+				t.Fatal(err)
+			}
+			have.WriteByte('\n')
+
+			golden := filepath.Join("testdata", test.name+".json")
+			if *update {
+				if err := os.WriteFile(golden, have.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(have.Bytes(), want) {
+				t.Errorf("unexpected filter.\n\twant: %s\n\thave: %s", want, have.Bytes())
+			}
+
+			e, err := Unmarshal(want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(e, test.exp) {
+				t.Errorf("unexpected expression.\n\twant: %v\n\thave: %v", test.exp, e)
+			}
+		})
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	m := exp.Map{
+		"country": "GR",
+		"amount":  "42",
+		"ref":     "https://google.com/?q=1",
+		"date":    "2014-12-15",
+	}
+	for _, test := range []struct {
+		json string
+		out  bool
+	}{
+		{`{}`, true},
+		{`{"country": "GR"}`, true},
+		{`{"country": "GR", "amount": {"$gt": 40, "$lt": 50}}`, true},
+		{`{"amount": 42}`, true},
+		{`{"amount": {"$gte": 43}}`, false},
+		{`{"ref": {"$regex": "google\\.com"}}`, true},
+		{`{"ref": {"$regex": "^google\\.com$"}}`, false},
+		{`{"country": {"$regex": "^GR$", "$options": ""}}`, true},
+		{`{"$or": [{"country": "CY"}, {"amount": {"$in": [41, 42]}}]}`, true},
+		{`{"$nor": [{"country": "CY"}, {"amount": 41}]}`, true},
+		{`{"date": {"$lt": "2015-01-01T00:00:00Z"}}`, true},
+		{`{"date": {"$gte": {"$date": "2014-12-15T00:00:00Z"}}}`, true},
+	} {
+		e, err := Unmarshal([]byte(test.json))
+		if err != nil {
+			t.Errorf("%s: %s", test.json, err)
+			continue
+		}
+		if e.Eval(m) != test.out {
+			t.Errorf("%s (%v) should evaluate to %t", test.json, e, test.out)
+		}
+	}
+}
+
+func TestUnsupported(t *testing.T) {
+	_, cidr, _ := net.ParseCIDR("10.0.0.0/8")
+	for _, e := range []exp.Exp{
+		exp.ContainsIP("ip", cidr),
+		exp.Len("foo", 3),
+		exp.And(exp.True, exp.Weekday("date", time.Monday)),
+	} {
+		if _, err := Filter(e); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("%v: expected ErrUnsupported, have %v", e, err)
+		}
+	}
+	for _, s := range []string{
+		`{"$where": "this.a == 1"}`,
+		`{"a": {"$exists": true}}`,
+		`{"a": {"$regex": "a+b"}}`,
+		`{"a": {"$regex": "ab", "$options": "i"}}`,
+	} {
+		if _, err := Unmarshal([]byte(s)); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("%s: expected ErrUnsupported, have %v", s, err)
+		}
+	}
+}
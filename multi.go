@@ -0,0 +1,164 @@
+package exp
+
+import "net/textproto"
+
+// MultiParams is implemented by Params which may hold several values per key,
+// such as query strings and headers. Get returns the first value of a key and
+// GetAll returns all of them.
+type MultiParams interface {
+	Params
+	GetAll(key string) []string
+}
+
+// Values returns MultiParams reading from v, such as url.Values.
+//
+//	q, _ := url.ParseQuery("tag=a&tag=b")
+//	Any("tag", Match("tag", "b")).Eval(Values(q)) // true
+func Values(v map[string][]string) MultiParams {
+	return values(v)
+}
+
+type values map[string][]string
+
+// Get returns the first value of key.
+func (v values) Get(key string) string {
+	if vs := v[key]; len(vs) > 0 {
+		return vs[0]
+	}
+	return ""
+}
+
+// GetAll returns every value of key.
+func (v values) GetAll(key string) []string {
+	return v[key]
+}
+
+// Header returns MultiParams reading from h, such as http.Header. Keys are
+// case insensitive, as they are canonicalized like http.Header.Get does.
+func Header(h map[string][]string) MultiParams {
+	return header(h)
+}
+
+type header map[string][]string
+
+// Get returns the first value of key.
+func (h header) Get(key string) string {
+	return values(h).Get(textproto.CanonicalMIMEHeaderKey(key))
+}
+
+// GetAll returns every value of key.
+func (h header) GetAll(key string) []string {
+	return h[textproto.CanonicalMIMEHeaderKey(key)]
+}
+
+// getAll returns every value of key in p. Params which do not implement
+// MultiParams hold a single value per key, or none if it is empty.
+func getAll(p Params, key string) []string {
+	if mp, ok := p.(MultiParams); ok {
+		return mp.GetAll(key)
+	}
+	if v := p.Get(key); v != "" {
+		return []string{v}
+	}
+	return nil
+}
+
+// boundParams is a Params which reads value for key and delegates every other
+// key to Params.
+type boundParams struct {
+	Params
+	key, value string
+}
+
+func (b boundParams) Get(key string) string {
+	if key == b.key {
+		return b.value
+	}
+	return b.Params.Get(key)
+}
+
+func (b boundParams) GetAll(key string) []string {
+	if key == b.key {
+		return []string{b.value}
+	}
+	return getAll(b.Params, key)
+}
+
+// Any
+
+type expAny struct {
+	key  string
+	elem Exp
+}
+
+func (e expAny) Eval(p Params) bool {
+	for _, v := range getAll(p, e.key) {
+		if e.elem.Eval(boundParams{p, e.key, v}) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e expAny) evalContext(ev *evaluator, p Params) (bool, error) {
+	for _, v := range getAll(p, e.key) {
+		if ok, err := ev.eval(e.elem, boundParams{p, e.key, v}); err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+func (e expAny) String() string {
+	return sprintf("∃%s:%s", e.key, e.elem)
+}
+
+// Any evaluates to true if t evaluates to true for any of the values of key.
+// Each value is evaluated in turn, with t reading it as the value of key. If
+// the Params do not implement MultiParams, key has a single value unless it is
+// empty.
+//
+//	p := Values(url.Values{"tag": {"a", "b"}})
+//	Any("tag", Match("tag", "b")).Eval(p) // true
+func Any(key string, t Exp) Exp {
+	return expAny{key, t}
+}
+
+// All
+
+type expAll struct {
+	key  string
+	elem Exp
+}
+
+func (e expAll) Eval(p Params) bool {
+	for _, v := range getAll(p, e.key) {
+		if !e.elem.Eval(boundParams{p, e.key, v}) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e expAll) evalContext(ev *evaluator, p Params) (bool, error) {
+	for _, v := range getAll(p, e.key) {
+		if ok, err := ev.eval(e.elem, boundParams{p, e.key, v}); err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func (e expAll) String() string {
+	return sprintf("∀%s:%s", e.key, e.elem)
+}
+
+// All evaluates to true if t evaluates to true for all of the values of key,
+// which includes the case where key has no values. Values are evaluated as
+// with Any.
+//
+//	p := Values(url.Values{"size": {"38", "42"}})
+//	All("size", Gt("size", 36)).Eval(p) // true
+func All(key string, t Exp) Exp {
+	return expAll{key, t}
+}
@@ -0,0 +1,80 @@
+package exp
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestValues(t *testing.T) {
+	q, err := url.ParseQuery("tag=a&tag=b&size=38&size=42&empty=")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := Values(q)
+	if have := p.Get("tag"); have != "a" {
+		t.Errorf("Get(tag) = %q, want %q", have, "a")
+	}
+	if have := p.Get("missing"); have != "" {
+		t.Errorf("Get(missing) = %q, want empty", have)
+	}
+	if have := p.GetAll("size"); !reflect.DeepEqual(have, []string{"38", "42"}) {
+		t.Errorf("GetAll(size) = %q", have)
+	}
+}
+
+func TestHeader(t *testing.T) {
+	h := http.Header{}
+	h.Add("Accept-Language", "el")
+	h.Add("Accept-Language", "en")
+	p := Header(h)
+	if have := p.Get("accept-language"); have != "el" {
+		t.Errorf("Get(accept-language) = %q, want %q", have, "el")
+	}
+	if have := p.GetAll("ACCEPT-LANGUAGE"); !reflect.DeepEqual(have, []string{"el", "en"}) {
+		t.Errorf("GetAll(ACCEPT-LANGUAGE) = %q", have)
+	}
+}
+
+func TestQuantifiers(t *testing.T) {
+	p := Values(url.Values{
+		"tag":  {"a", "b"},
+		"size": {"38", "42"},
+		"role": {"admin"},
+	})
+	for _, test := range []struct {
+		exp  Exp
+		p    Params
+		want bool
+	}{
+		{Any("tag", Match("tag", "b")), p, true},
+		{Any("tag", Match("tag", "c")), p, false},
+		{All("tag", Match("tag", "b")), p, false},
+		{All("size", Gt("size", 36)), p, true},
+		{All("size", Gt("size", 40)), p, false},
+		{Any("size", Gt("size", 40)), p, true},
+		{Any("missing", True), p, false},
+		{All("missing", False), p, true},
+		{Any("tag", And(Match("tag", "a"), Match("role", "admin"))), p, true},
+		{Any("tag", All("size", Lt("size", 50))), p, true},
+		{Any("tag", Match("tag", "b")), Map{"tag": "b"}, true},
+		{All("tag", Match("tag", "b")), Map{"tag": "a"}, false},
+		{Any("tags", Match("tags", "sale")), Tree(map[string]any{"tags": []any{"new", "sale"}}), true},
+	} {
+		if have := test.exp.Eval(test.p); have != test.want {
+			t.Errorf("%s.Eval(%v) = %t, want %t", test.exp, test.p, have, test.want)
+		}
+	}
+}
+
+func TestQuantifierString(t *testing.T) {
+	for e, want := range map[Exp]string{
+		Any("tag", Match("tag", "x")): "∃tag:[tag==x]",
+		All("n", Gt("n", 1)):          "∀n:[n>1.00]",
+	} {
+		if have := sprintf("%s", e); have != want {
+			t.Errorf("String() = %s, want %s", have, want)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package exp
+
+import "strings"
+
+// Chain returns Params reading each key from the first of p in which it is
+// not missing. Since Get returns an empty string for missing keys, a key whose
+// value is empty is considered missing.
+//
+// The Params returned implement MultiParams, reading all values of a key from
+// the first of p in which it has any.
+//
+//	p := Chain(Map{"plan": "pro"}, Map{"plan": "free", "region": "eu"})
+//	p.Get("plan")   // "pro"
+//	p.Get("region") // "eu"
+func Chain(p ...Params) Params {
+	return chain(p)
+}
+
+type chain []Params
+
+// Get returns the first value of key which is not empty.
+func (c chain) Get(key string) string {
+	for _, p := range c {
+		if v := p.Get(key); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// GetAll returns the values of key in the first Params which has any.
+func (c chain) GetAll(key string) []string {
+	for _, p := range c {
+		if v := getAll(p, key); len(v) > 0 {
+			return v
+		}
+	}
+	return nil
+}
+
+// Defaults returns Params reading from p, and from defaults for keys missing
+// from p. It is short for Chain(p, defaults).
+//
+//	p := Defaults(r.URL.Query(), Map{"currency": "EUR"})
+func Defaults(p Params, defaults Map) Params {
+	return chain{p, defaults}
+}
+
+// Prefix returns Params in which every key of p is found with prefix prepended
+// to it. Keys without the prefix are missing. Together with Chain, Prefix
+// allows several Params to be combined without their keys colliding.
+//
+//	p := Chain(Prefix("req.", query), Prefix("tenant.", tenant))
+//	p.Get("req.plan") // query.Get("plan")
+func Prefix(prefix string, p Params) Params {
+	return prefixed{prefix, p}
+}
+
+type prefixed struct {
+	prefix string
+	p      Params
+}
+
+// Get returns the value of key in the underlying Params, with the prefix
+// removed.
+func (x prefixed) Get(key string) string {
+	if !strings.HasPrefix(key, x.prefix) {
+		return ""
+	}
+	return x.p.Get(key[len(x.prefix):])
+}
+
+// GetAll returns the values of key in the underlying Params, with the prefix
+// removed.
+func (x prefixed) GetAll(key string) []string {
+	if !strings.HasPrefix(key, x.prefix) {
+		return nil
+	}
+	return getAll(x.p, key[len(x.prefix):])
+}
+
+// Rename returns Params in which keys are aliased to other keys of p. Each key
+// of names is an alias read as the key of p it maps to. Keys which are not
+// aliased are read from p as is.
+//
+//	p := Rename(Map{"cc": "GR"}, map[string]string{"country": "cc"})
+//	p.Get("country") // "GR"
+func Rename(p Params, names map[string]string) Params {
+	return renamed{p, names}
+}
+
+type renamed struct {
+	p     Params
+	names map[string]string
+}
+
+// Get returns the value of the key which key is an alias of.
+func (r renamed) Get(key string) string {
+	if name, ok := r.names[key]; ok {
+		key = name
+	}
+	return r.p.Get(key)
+}
+
+// GetAll returns the values of the key which key is an alias of.
+func (r renamed) GetAll(key string) []string {
+	if name, ok := r.names[key]; ok {
+		key = name
+	}
+	return getAll(r.p, key)
+}
@@ -0,0 +1,89 @@
+package exp
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestChain(t *testing.T) {
+	global := Map{"plan": "free", "region": "eu", "limit": "10"}
+	tenant := Map{"plan": "pro", "limit": ""}
+	req := Values(url.Values{"tag": {"a", "b"}})
+	p := Chain(req, tenant, global)
+	for key, want := range map[string]string{
+		"plan":    "pro",
+		"region":  "eu",
+		"limit":   "10",
+		"tag":     "a",
+		"missing": "",
+	} {
+		if have := p.Get(key); have != want {
+			t.Errorf("Get(%q) = %q, want %q", key, have, want)
+		}
+	}
+	mp := p.(MultiParams)
+	for key, want := range map[string][]string{
+		"tag":     {"a", "b"},
+		"plan":    {"pro"},
+		"missing": nil,
+	} {
+		if have := mp.GetAll(key); !reflect.DeepEqual(have, want) {
+			t.Errorf("GetAll(%q) = %q, want %q", key, have, want)
+		}
+	}
+	if have := Chain().Get("plan"); have != "" {
+		t.Errorf("Chain().Get(plan) = %q, want empty", have)
+	}
+}
+
+func TestDefaults(t *testing.T) {
+	p := Defaults(Map{"currency": "USD", "amount": "10"}, Map{"currency": "EUR", "country": "GR"})
+	e := And(Match("currency", "USD"), Match("country", "GR"), Gt("amount", 5))
+	if !e.Eval(p) {
+		t.Errorf("%s should evaluate to true", e)
+	}
+}
+
+func TestPrefix(t *testing.T) {
+	p := Chain(
+		Prefix("req.", Values(url.Values{"tag": {"a", "b"}})),
+		Prefix("tenant.", Map{"plan": "pro"}),
+		Prefix("", Map{"plan": "free"}),
+	)
+	for key, want := range map[string]string{
+		"req.tag":     "a",
+		"tenant.plan": "pro",
+		"plan":        "free",
+		"tag":         "",
+		"req.plan":    "",
+		"tenant.tag":  "",
+	} {
+		if have := p.Get(key); have != want {
+			t.Errorf("Get(%q) = %q, want %q", key, have, want)
+		}
+	}
+	if e := Any("req.tag", Match("req.tag", "b")); !e.Eval(p) {
+		t.Errorf("%s should evaluate to true", e)
+	}
+}
+
+func TestRename(t *testing.T) {
+	p := Rename(Values(url.Values{"cc": {"GR", "CY"}, "plan": {"pro"}}), map[string]string{
+		"country": "cc",
+		"plan":    "tier",
+	})
+	for key, want := range map[string]string{
+		"country": "GR",
+		"cc":      "GR",
+		"plan":    "",
+		"tier":    "",
+	} {
+		if have := p.Get(key); have != want {
+			t.Errorf("Get(%q) = %q, want %q", key, have, want)
+		}
+	}
+	if have := p.(MultiParams).GetAll("country"); !reflect.DeepEqual(have, []string{"GR", "CY"}) {
+		t.Errorf("GetAll(country) = %q", have)
+	}
+}
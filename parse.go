@@ -1,18 +1,64 @@
 package exp
 
 import (
+	"errors"
 	"fmt"
+	"regexp"
+	"regexp/syntax"
 	"strconv"
 
 	"github.com/alexkappa/exp/parse"
 )
 
+// Parse parses an expression in text format.
+//
+//	x, err := exp.Parse(`foo >= 100 && bar == "baz"`)
 func Parse(s string) (Exp, error) {
-	t, err := parse.Parse(s)
+	return ParseOptions{}.Parse(s)
+}
+
+// ParseOptions limits the resources used to parse an expression, so that rule
+// text from untrusted sources can be parsed safely. A zero field means no
+// limit. Exceeding a limit fails with a *parse.LimitError locating the
+// offending input.
+//
+//	opts := exp.ParseOptions{MaxLength: 4096, MaxDepth: 32, MaxNodes: 256}
+//	x, err := opts.Parse(s)
+type ParseOptions struct {
+	// MaxLength is the maximum length of the input in bytes.
+	MaxLength int
+	// MaxDepth is the maximum nesting depth. The top level of the input is at
+	// depth 1, and every parenthesis, negation and let binding adds one
+	// level. If zero, nesting is limited to 10000 levels.
+	MaxDepth int
+	// MaxNodes is the maximum number of operators and operands.
+	MaxNodes int
+	// MaxStringLiteral is the maximum length in bytes of a quoted string or
+	// identifier.
+	MaxStringLiteral int
+	// MaxRegexComplexity is the maximum number of instructions a regular
+	// expression used with =~ may compile into. Repetitions are expanded, so
+	// a{100} counts as 100 instructions.
+	MaxRegexComplexity int
+}
+
+// Parse parses an expression in text format, enforcing the limits of o.
+func (o ParseOptions) Parse(s string) (Exp, error) {
+	t, err := parse.ParseLimits(s, o.limits())
 	if err != nil {
 		return nil, err
 	}
-	return compile(t)
+	return o.compile(t, nil)
+}
+
+// limits returns the limits of o enforced by the parse package.
+func (o ParseOptions) limits() parse.Limits {
+	return parse.Limits{
+		MaxLength:        o.MaxLength,
+		MaxDepth:         o.MaxDepth,
+		MaxNodes:         o.MaxNodes,
+		MaxStringLiteral: o.MaxStringLiteral,
+	}
 }
 
 func left(t parse.Tree) (string, error) {
@@ -39,13 +85,168 @@ func right(t parse.Tree) (any, error) {
 	}
 }
 
-func compile(t parse.Tree) (Exp, error) {
+// elements returns the elements of the list t, in order.
+func elements(t parse.Tree) ([]parse.Tree, error) {
+	if t.Value().Type != parse.T_LIST {
+		return nil, fmt.Errorf("expected list but have %s instead", t.Value().Type)
+	}
+	var elems []parse.Tree
+	for t = t.Right(); t != nil && t.Value().Type == parse.T_COMMA; t = t.Left() {
+		elems = append(elems, t.Right())
+	}
+	if t != nil {
+		elems = append(elems, t)
+	}
+	for i, j := 0, len(elems)-1; i < j; i, j = i+1, j-1 {
+		elems[i], elems[j] = elems[j], elems[i]
+	}
+	return elems, nil
+}
+
+// list returns the elements of the list t. Numbers are kept as written, as
+// they are compared to values as strings.
+func list(t parse.Tree) ([]string, error) {
+	elems, err := elements(t)
+	if err != nil {
+		return nil, err
+	}
+	set := make([]string, len(elems))
+	for i, elem := range elems {
+		set[i] = elem.Value().Value
+	}
+	return set, nil
+}
+
+// in compiles a membership test, such as plan in ("pro", 2), into an Or of the
+// comparisons key == elem for each element of the list.
+func in(t parse.Tree) (Exp, error) {
+	k, err := left(t.Left())
+	if err != nil {
+		return nil, err
+	}
+	elems, err := elements(t.Right())
+	if err != nil {
+		return nil, err
+	}
+	or := make([]Exp, len(elems))
+	for i, elem := range elems {
+		v, err := right(elem)
+		if err != nil {
+			return nil, err
+		}
+		switch v := v.(type) {
+		case float64:
+			or[i] = Equal(k, v)
+		case string:
+			or[i] = Match(k, v)
+		}
+	}
+	return Or(or...), nil
+}
+
+// size compiles a comparison of the number of values of a key, such as
+// size roles > 2, into SizeGt and SizeEq expressions.
+func size(t parse.Tree) (Exp, error) {
+	cmp := t.Right()
+	if cmp == nil || cmp.Left() == nil || cmp.Right() == nil {
+		return nil, errors.New("invalid expression. size must be followed by a comparison")
+	}
+	k, err := left(cmp.Left())
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression. %w", err)
+	}
+	operand := cmp.Right().Value()
+	n, err := strconv.Atoi(operand.Value)
+	if operand.Type != parse.T_NUMBER || err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid expression. expected size but have %s %q instead", operand.Type, operand.Value)
+	}
+	switch cmp.Value().Type {
+	case parse.T_IS_EQUAL:
+		return SizeEq(k, n), nil
+	case parse.T_IS_NOT_EQUAL:
+		return Not(SizeEq(k, n)), nil
+	case parse.T_IS_GREATER:
+		return SizeGt(k, n), nil
+	case parse.T_IS_GREATER_OR_EQUAL:
+		if n == 0 {
+			return True, nil
+		}
+		return SizeGt(k, n-1), nil
+	case parse.T_IS_SMALLER:
+		if n == 0 {
+			return False, nil
+		}
+		return Not(SizeGt(k, n-1)), nil
+	case parse.T_IS_SMALLER_OR_EQUAL:
+		return Not(SizeGt(k, n)), nil
+	}
+	return nil, fmt.Errorf("invalid expression. %s is not allowed in size expressions", cmp.Value().Type)
+}
+
+// scope resolves the names an expression refers to, which are the bindings of
+// the enclosing let expressions followed by any named rules.
+type scope struct {
+	name   string
+	exp    Exp
+	parent *scope
+	rules  func(name string) (Exp, bool, error)
+}
+
+func (s *scope) lookup(name string) (Exp, bool, error) {
+	for ; s != nil; s = s.parent {
+		if s.rules != nil {
+			return s.rules(name)
+		}
+		if s.name == name {
+			return s.exp, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// posError locates an error found while compiling a parse tree.
+type posError struct {
+	err       error
+	line, col int
+}
+
+func (e *posError) Error() string {
+	return fmt.Sprintf("%v at line %d col %d", e.err, e.line, e.col)
+}
+
+func (e *posError) Unwrap() error {
+	return e.err
+}
+
+// compile compiles the parse tree t, resolving names in env. Errors are
+// located at the innermost node of t which failed to compile.
+func (o ParseOptions) compile(t parse.Tree, env *scope) (Exp, error) {
+	e, err := o.compileNode(t, env)
+	if err == nil || t == nil {
+		return e, err
+	}
+	var (
+		pe *posError
+		le *parse.LimitError
+		re *RuleError
+	)
+	if errors.As(err, &pe) || errors.As(err, &le) || errors.As(err, &re) {
+		return nil, err
+	}
+	token := t.Value()
+	return nil, &posError{err, token.Line, token.Col}
+}
+
+func (o ParseOptions) compileNode(t parse.Tree, env *scope) (Exp, error) {
+	if t == nil {
+		return nil, errors.New("missing operand")
+	}
 	token := t.Value()
 	switch token.Type {
 	case parse.T_ERR:
-		return nil, fmt.Errorf("parse error %v at line %d col %d", token, token.Line, token.Col)
+		return nil, fmt.Errorf("parse error %v", token)
 	case parse.T_UNKNOWN:
-		return nil, fmt.Errorf("unknown token at line %d col %d", token.Line, token.Col)
+		return nil, errors.New("unknown token")
 	case parse.T_BOOLEAN:
 		switch token.Value {
 		case "true":
@@ -53,26 +254,116 @@ func compile(t parse.Tree) (Exp, error) {
 		case "false":
 			return False, nil
 		}
-	case parse.T_LOGICAL_AND:
-		l, err := compile(t.Left())
+	case parse.T_LOGICAL_AND, parse.T_LOGICAL_OR:
+		// Chains such as a && b && c are parsed into trees leaning left, which
+		// are flattened iteratively so that their length is not limited by
+		// the stack.
+		var operands []parse.Tree
+		for t != nil && t.Value().Type == token.Type {
+			operands = append(operands, t.Right())
+			t = t.Left()
+		}
+		operands = append(operands, t)
+		elems := make([]Exp, len(operands))
+		for i, operand := range operands {
+			e, err := o.compile(operand, env)
+			if err != nil {
+				return nil, err
+			}
+			elems[len(elems)-1-i] = e
+		}
+		if token.Type == parse.T_LOGICAL_AND {
+			return And(elems...), nil
+		}
+		return Or(elems...), nil
+	case parse.T_IDENTIFIER:
+		e, ok, err := env.lookup(token.Value)
 		if err != nil {
 			return nil, err
 		}
-		r, err := compile(t.Right())
+		if !ok {
+			return nil, fmt.Errorf("undefined name %q", token.Value)
+		}
+		return e, nil
+	case parse.T_LET:
+		// The value of a binding is compiled once and shared by every
+		// reference to it in the body.
+		assign := t.Left()
+		e, err := o.compile(assign.Right(), env)
 		if err != nil {
 			return nil, err
 		}
-		return And(l, r), nil
-	case parse.T_LOGICAL_OR:
-		l, err := compile(t.Left())
+		return o.compile(t.Right(), &scope{name: assign.Left().Value().Value, exp: e, parent: env})
+	case parse.T_LOGICAL_NOT:
+		e, err := o.compile(t.Right(), env)
 		if err != nil {
 			return nil, err
 		}
-		r, err := compile(t.Right())
+		return Not(e), nil
+	case parse.T_ANY, parse.T_ALL:
+		// A quantifier applies to a single comparison, whose key names the
+		// values being quantified.
+		operand := t.Right()
+		if operand == nil || operand.Left() == nil {
+			return nil, fmt.Errorf("invalid expression. %s must be followed by a comparison", token.Value)
+		}
+		k, err := left(operand.Left())
+		if err != nil {
+			return nil, fmt.Errorf("invalid expression. %w", err)
+		}
+		e, err := o.compile(operand, env)
+		if err != nil {
+			return nil, err
+		}
+		if token.Type == parse.T_ANY {
+			return Any(k, e), nil
+		}
+		return All(k, e), nil
+	case parse.T_SIZE:
+		return size(t)
+	case parse.T_HAS:
+		k, err := left(t.Left())
+		if err != nil {
+			return nil, fmt.Errorf("invalid expression. %w", err)
+		}
+		operand := t.Right().Value()
+		if operand.Type != parse.T_STRING {
+			return nil, fmt.Errorf("invalid expression. expected string but have %s instead", operand.Type)
+		}
+		return HasElement(k, operand.Value), nil
+	case parse.T_INTERSECTS, parse.T_SUBSET_OF:
+		k, err := left(t.Left())
+		if err != nil {
+			return nil, fmt.Errorf("invalid expression. %w", err)
+		}
+		set, err := list(t.Right())
+		if err != nil {
+			return nil, fmt.Errorf("invalid expression. %w", err)
+		}
+		if token.Type == parse.T_INTERSECTS {
+			return Intersects(k, set...), nil
+		}
+		return SubsetOf(k, set...), nil
+	case parse.T_IN:
+		e, err := in(t)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expression. %w", err)
+		}
+		return e, nil
+	case parse.T_MATCHES:
+		k, err := left(t.Left())
+		if err != nil {
+			return nil, fmt.Errorf("invalid expression. %w", err)
+		}
+		operand := t.Right().Value()
+		if operand.Type != parse.T_STRING {
+			return nil, fmt.Errorf("invalid expression. expected string but have %s instead", operand.Type)
+		}
+		re, err := o.regexp(operand.Value, operand.Line, operand.Col)
 		if err != nil {
 			return nil, err
 		}
-		return Or(l, r), nil
+		return expRegexp{k, re}, nil
 	case
 		parse.T_IS_EQUAL,
 		parse.T_IS_NOT_EQUAL,
@@ -125,5 +416,24 @@ func compile(t parse.Tree) (Exp, error) {
 		}
 	}
 
-	return nil, fmt.Errorf("unexpected %s:%s at line %d col %d", token.Type, token.Value, token.Line, token.Col)
+	return nil, fmt.Errorf("unexpected %s:%s", token.Type, token.Value)
+}
+
+// regexp compiles the regular expression s found at line and col, enforcing
+// the MaxRegexComplexity limit.
+func (o ParseOptions) regexp(s string, line, col int) (*regexp.Regexp, error) {
+	re, err := syntax.Parse(s, syntax.Perl)
+	if err != nil {
+		return nil, &posError{fmt.Errorf("invalid regular expression: %w", err), line, col}
+	}
+	if max := o.MaxRegexComplexity; max > 0 {
+		prog, err := syntax.Compile(re.Simplify())
+		if err != nil {
+			return nil, &posError{fmt.Errorf("invalid regular expression: %w", err), line, col}
+		}
+		if len(prog.Inst) > max {
+			return nil, &parse.LimitError{Limit: "regular expression complexity", Max: max, Line: line, Col: col}
+		}
+	}
+	return regexp.Compile(s)
 }
@@ -3,7 +3,6 @@ package parse
 import (
 	"errors"
 	"fmt"
-	"sync"
 )
 
 type Tree interface {
@@ -22,11 +21,20 @@ func (t *tree) Value() token {
 	return t.value
 }
 
+// Left returns the left operand of a binary operator, or nil.
 func (t *tree) Left() Tree {
+	if t.left == nil {
+		return nil
+	}
 	return t.left
 }
 
+// Right returns the right operand of a binary operator or the operand of a
+// negation, or nil.
 func (t *tree) Right() Tree {
+	if t.right == nil {
+		return nil
+	}
 	return t.right
 }
 
@@ -45,28 +53,22 @@ func newTree() *tree {
 	return &tree{}
 }
 
+// stack holds the pending operators and operands of the parser.
 type stack struct {
 	s []*tree
-	sync.Mutex
 }
 
 func newStack() *stack {
 	return &stack{
-		s: make([]*tree, 0),
+		s: make([]*tree, 0, 16),
 	}
 }
 
 func (s *stack) push(t *tree) {
-	s.Lock()
-	defer s.Unlock()
-
 	s.s = append(s.s, t)
 }
 
 func (s *stack) pop() (*tree, error) {
-	s.Lock()
-	defer s.Unlock()
-
 	l := len(s.s)
 	if l == 0 {
 		return nil, errors.New("empty stack")
@@ -77,3 +79,12 @@ func (s *stack) pop() (*tree, error) {
 
 	return res, nil
 }
+
+// peek returns the tree on top of the stack without removing it.
+func (s *stack) peek() (*tree, bool) {
+	l := len(s.s)
+	if l == 0 {
+		return nil, false
+	}
+	return s.s[l-1], true
+}
@@ -6,7 +6,6 @@ package parse
 import (
 	"bytes"
 	"fmt"
-	"strings"
 	"unicode"
 	"unicode/utf8"
 )
@@ -45,6 +44,9 @@ const (
 
 	T_LEFT_PAREN
 	T_RIGHT_PAREN
+	T_LEFT_BRACKET
+	T_RIGHT_BRACKET
+	T_COMMA
 
 	T_IS_EQUAL
 	T_IS_NOT_EQUAL
@@ -52,6 +54,20 @@ const (
 	T_IS_GREATER_OR_EQUAL
 	T_IS_SMALLER
 	T_IS_SMALLER_OR_EQUAL
+	T_MATCHES
+	T_ASSIGN
+
+	// Keywords are scanned as identifiers, and are told apart by the parser
+	// by their position. T_LIST holds the elements of a bracketed list.
+	T_ANY
+	T_ALL
+	T_SIZE
+	T_HAS
+	T_INTERSECTS
+	T_SUBSET_OF
+	T_LIST
+	T_LET
+	T_IN
 )
 
 var tokenName = map[tokenType]string{
@@ -67,12 +83,26 @@ var tokenName = map[tokenType]string{
 	T_LOGICAL_NOT:         "T_LOGICAL_NOT",
 	T_LEFT_PAREN:          "T_LEFT_PAREN",
 	T_RIGHT_PAREN:         "T_RIGHT_PAREN",
+	T_LEFT_BRACKET:        "T_LEFT_BRACKET",
+	T_RIGHT_BRACKET:       "T_RIGHT_BRACKET",
+	T_COMMA:               "T_COMMA",
 	T_IS_EQUAL:            "T_IS_EQUAL",
 	T_IS_NOT_EQUAL:        "T_IS_NOT_EQUAL",
 	T_IS_GREATER:          "T_IS_GREATER",
 	T_IS_GREATER_OR_EQUAL: "T_IS_GREATER_OR_EQUAL",
 	T_IS_SMALLER:          "T_IS_SMALLER",
 	T_IS_SMALLER_OR_EQUAL: "T_IS_SMALLER_OR_EQUAL",
+	T_MATCHES:             "T_MATCHES",
+	T_ASSIGN:              "T_ASSIGN",
+	T_ANY:                 "T_ANY",
+	T_ALL:                 "T_ALL",
+	T_SIZE:                "T_SIZE",
+	T_HAS:                 "T_HAS",
+	T_INTERSECTS:          "T_INTERSECTS",
+	T_SUBSET_OF:           "T_SUBSET_OF",
+	T_LIST:                "T_LIST",
+	T_LET:                 "T_LET",
+	T_IN:                  "T_IN",
 }
 
 // String satisfies the fmt.Stringer interface making it easier to print tokens.
@@ -92,12 +122,21 @@ type stateFn func(*lexer) stateFn
 
 // lexer holds the state of the scanner.
 type lexer struct {
-	input  string     // the string being scanned.
-	state  stateFn    // the next lexing function to enter.
-	pos    int        // current position in the input.
-	start  int        // start position of this token.
-	width  int        // width of last rune read from input.
-	tokens chan token // channel of scanned tokens.
+	input  string  // the string being scanned.
+	state  stateFn // the next lexing function to enter.
+	pos    int     // current position in the input.
+	start  int     // start position of this token.
+	width  int     // width of last rune read from input.
+	tok    token   // the token emitted by the last state function.
+	ready  bool    // whether tok is yet to be returned by token.
+	limits Limits  // limits enforced while scanning.
+	err    error   // error which terminated the scan, if any.
+
+	// line tracking, advanced up to scanned as tokens are emitted. The
+	// first line may start before the input, when parsed with ParseAt.
+	line      int
+	lineStart int
+	scanned   int
 }
 
 // next returns the next rune in the input.
@@ -106,6 +145,11 @@ func (l *lexer) next() (r rune) {
 		l.width = 0
 		return eof
 	}
+	if c := l.input[l.pos]; c < utf8.RuneSelf {
+		l.width = 1
+		l.pos++
+		return rune(c)
+	}
 	r, l.width = utf8.DecodeRuneInString(l.input[l.pos:])
 	l.pos += l.width
 	return r
@@ -135,12 +179,8 @@ func (l *lexer) buffer() string {
 
 // emit passes an token back to the client.
 func (l *lexer) emit(t tokenType) {
-	l.tokens <- token{
-		t,
-		l.buffer(),
-		l.lineNum(),
-		l.columnNum(),
-	}
+	line, col := l.position(l.start)
+	l.tok, l.ready = token{t, l.buffer(), line, col}, true
 	l.start = l.pos
 }
 
@@ -149,42 +189,42 @@ func (l *lexer) ignore() {
 	l.start = l.pos
 }
 
-// lineNum reports which line we're on. Doing it this way
-// means we don't have to worry about peek double counting.
-func (l *lexer) lineNum() int {
-	return 1 + strings.Count(l.input[:l.pos], "\n")
+// position reports the line and column, both starting at 1, of the byte at
+// offset pos. Columns are counted in bytes. Offsets must be requested in
+// ascending order, so that the input is only scanned once.
+func (l *lexer) position(pos int) (line, col int) {
+	for ; l.scanned < pos; l.scanned++ {
+		if l.input[l.scanned] == '\n' {
+			l.line++
+			l.lineStart = l.scanned + 1
+		}
+	}
+	return l.line, pos - l.lineStart + 1
 }
 
-// columnNum reports the character of the current line we're on.
-func (l *lexer) columnNum() int {
-	if lf := strings.LastIndex(l.input[:l.pos], "\n"); lf != -1 {
-		return len(l.input[lf+1 : l.pos])
-	}
-	return len(l.input[:l.pos])
+// errorf returns an error token positioned at offset pos and terminates the
+// scan.
+func (l *lexer) errorf(pos int, format string, args ...interface{}) stateFn {
+	line, col := l.position(pos)
+	l.tok, l.ready = token{T_ERR, fmt.Sprintf(format, args...), line, col}, true
+	return stateEnd
 }
 
-// error returns an error token and terminates the scan by passing
-// back a nil pointer that will be the next state, terminating l.token.
-func (l *lexer) errorf(format string, args ...interface{}) stateFn {
-	l.tokens <- token{
-		T_ERR,
-		fmt.Sprintf(format, args...),
-		l.lineNum(),
-		l.columnNum(),
-	}
-	return nil
+// limitf terminates the scan with a LimitError positioned at offset pos.
+func (l *lexer) limitf(pos int, limit string, max int) stateFn {
+	line, col := l.position(pos)
+	l.err = &LimitError{Limit: limit, Max: max, Line: line, Col: col}
+	return l.errorf(pos, "%s", l.err)
 }
 
-// token returns the next token from the input.
+// token returns the next token from the input. Once the input is exhausted, or
+// an error is encountered, every call returns T_EOF.
 func (l *lexer) token() token {
-	for {
-		select {
-		case t := <-l.tokens:
-			return t
-		default:
-			l.state = l.state(l)
-		}
+	for !l.ready {
+		l.state = l.state(l)
 	}
+	l.ready = false
+	return l.tok
 }
 
 func (l *lexer) String() string {
@@ -198,15 +238,31 @@ func (l *lexer) String() string {
 
 // newLexer creates a new scanner for the input string.
 func newLexer(input string) *lexer {
+	return newLexerLimits(input, Limits{})
+}
+
+// newLexerLimits creates a new scanner for the input string which enforces the
+// MaxLength and MaxStringLiteral limits.
+func newLexerLimits(input string, limits Limits) *lexer {
 	l := &lexer{
 		input:  input,
-		tokens: make(chan token, 2),
+		limits: limits,
+		line:   1,
 	}
-	l.state = stateInit
+	l.state = stateStart
 	return l
 }
 
-// state functions.
+// state functions. Each emits at most one token, which is returned by token
+// before the next state function is entered.
+
+// stateStart checks the length of the input before scanning it.
+func stateStart(l *lexer) stateFn {
+	if max := l.limits.MaxLength; max > 0 && len(l.input) > max {
+		return l.limitf(max, "input length", max)
+	}
+	return stateInit
+}
 
 // stateInit is the initial state of the lexer.
 func stateInit(l *lexer) stateFn {
@@ -227,22 +283,32 @@ start:
 		return stateDoubleQuote
 	case r == '(':
 		l.emit(T_LEFT_PAREN)
-		goto start
+		return stateInit
 	case r == ')':
 		l.emit(T_RIGHT_PAREN)
-		goto start
+		return stateInit
+	case r == '[':
+		l.emit(T_LEFT_BRACKET)
+		return stateInit
+	case r == ']':
+		l.emit(T_RIGHT_BRACKET)
+		return stateInit
+	case r == ',':
+		l.emit(T_COMMA)
+		return stateInit
+	case r == eof:
+		return stateEnd
 	}
-	return stateEnd
+	return l.errorf(l.start, "unexpected character %q", l.buffer())
 }
 
-// stateEnd is the final state of the lexer. After this state is entered no more
-// tokens can be requested as it will result in a nil pointer dereference.
+// stateEnd is the final state of the lexer. It emits T_EOF every time it is
+// entered.
 func stateEnd(l *lexer) stateFn {
-	// Always end with EOF token. The parser will keep asking for tokens until
-	// an T_EOF or T_ERR token are encountered.
+	l.start = l.pos
 	l.emit(T_EOF)
 
-	return nil
+	return stateEnd
 }
 
 // stateIdentifier scans an indentifier from the input stream. An identifier is
@@ -270,79 +336,71 @@ loop:
 	return stateInit
 }
 
-// stateOperator scans an operator from the input stream.
+// operators maps the operators of the language to their token types.
+var operators = map[string]tokenType{
+	"!":  T_LOGICAL_NOT,
+	"&&": T_LOGICAL_AND,
+	"||": T_LOGICAL_OR,
+	"==": T_IS_EQUAL,
+	"!=": T_IS_NOT_EQUAL,
+	">":  T_IS_GREATER,
+	">=": T_IS_GREATER_OR_EQUAL,
+	"<":  T_IS_SMALLER,
+	"<=": T_IS_SMALLER_OR_EQUAL,
+	"=~": T_MATCHES,
+	"=":  T_ASSIGN,
+}
+
+// stateOperator scans an operator from the input stream. The longest operator
+// matching the input is chosen, so that "!!" is scanned as two negations.
 func stateOperator(l *lexer) stateFn {
-	r := l.next()
-	for isOperator(r) {
-		r = l.next()
+	if isOperator(l.peek()) {
+		l.next()
+		if t, ok := operators[l.buffer()]; ok {
+			l.emit(t)
+			return stateInit
+		}
+		l.backup()
 	}
-
-	l.backup()
-
-	switch l.buffer() {
-	case "!":
-		l.emit(T_LOGICAL_NOT)
-	case "&&":
-		l.emit(T_LOGICAL_AND)
-	case "||":
-		l.emit(T_LOGICAL_OR)
-	case "==":
-		l.emit(T_IS_EQUAL)
-	case "!=":
-		l.emit(T_IS_NOT_EQUAL)
-	case ">":
-		l.emit(T_IS_GREATER)
-	case ">=":
-		l.emit(T_IS_GREATER_OR_EQUAL)
-	case "<":
-		l.emit(T_IS_SMALLER)
-	case "<=":
-		l.emit(T_IS_SMALLER_OR_EQUAL)
+	if t, ok := operators[l.buffer()]; ok {
+		l.emit(t)
+		return stateInit
 	}
-
-	return stateInit
+	return l.errorf(l.start, "unknown operator %q", l.buffer())
 }
 
 // stateSingleQuote scans an identifier enclosed in single quotes from the input
 // stream.
 func stateSingleQuote(l *lexer) stateFn {
-	l.ignore()
-loop:
-	for {
-		switch l.next() {
-		case '\'':
-			l.backup()
-			l.emit(T_IDENTIFIER)
-			l.next()
-			l.ignore()
-			break loop
-		case eof:
-			return l.errorf("unexpected EOF")
-		}
-	}
-
-	return stateInit
+	return l.quoted('\'', T_IDENTIFIER)
 }
 
 // stateDoubleQuote scans a string enclosed in double quotes from the input
 // stream.
 func stateDoubleQuote(l *lexer) stateFn {
+	return l.quoted('"', T_STRING)
+}
+
+// quoted scans the remainder of a literal opened by quote and emits its
+// contents as a token of type t.
+func (l *lexer) quoted(quote rune, t tokenType) stateFn {
+	open := l.start
 	l.ignore()
-loop:
 	for {
 		switch l.next() {
-		case '"':
+		case quote:
 			l.backup()
-			l.emit(T_STRING)
+			if max := l.limits.MaxStringLiteral; max > 0 && len(l.buffer()) > max {
+				return l.limitf(open, "string literal length", max)
+			}
+			l.emit(t)
 			l.next()
 			l.ignore()
-			break loop
+			return stateInit
 		case eof:
-			return l.errorf("unexpected EOF")
+			return l.errorf(open, "unterminated literal")
 		}
 	}
-
-	return stateInit
 }
 
 // stateNumber scans a numeric value from the input stream.
@@ -370,15 +428,21 @@ func isWhitespace(r rune) bool {
 
 // isNumeric reports whether r is a digit.
 func isNumeric(r rune) bool {
+	if r < utf8.RuneSelf {
+		return '0' <= r && r <= '9'
+	}
 	return unicode.IsDigit(r)
 }
 
 // isAlphanum reports whether r is an alphabetic, digit, or underscore.
 func isAlphanum(r rune) bool {
-	return r == '_' || r == '.' || unicode.IsLetter(r) || unicode.IsDigit(r)
+	if r < utf8.RuneSelf {
+		return r == '_' || r == '.' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9'
+	}
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
 }
 
 // isOperator reports whether r is one of the predefined operators.
 func isOperator(r rune) bool {
-	return r == '=' || r == '!' || r == '>' || r == '<' || r == '&' || r == '|'
+	return r == '=' || r == '!' || r == '>' || r == '<' || r == '&' || r == '|' || r == '~'
 }
@@ -50,6 +50,40 @@ func TestLexer(t *testing.T) {
 				{Type: T_EOF},
 			},
 		},
+		{
+			`!!(((a=~"x"`,
+			[]token{
+				{Type: T_LOGICAL_NOT, Value: "!"},
+				{Type: T_LOGICAL_NOT, Value: "!"},
+				{Type: T_LEFT_PAREN, Value: "("},
+				{Type: T_LEFT_PAREN, Value: "("},
+				{Type: T_LEFT_PAREN, Value: "("},
+				{Type: T_IDENTIFIER, Value: "a"},
+				{Type: T_MATCHES, Value: "=~"},
+				{Type: T_STRING, Value: "x"},
+				{Type: T_EOF},
+			},
+		},
+		{
+			`a intersects ["x",1]`,
+			[]token{
+				{Type: T_IDENTIFIER, Value: "a"},
+				{Type: T_IDENTIFIER, Value: "intersects"},
+				{Type: T_LEFT_BRACKET, Value: "["},
+				{Type: T_STRING, Value: "x"},
+				{Type: T_COMMA, Value: ","},
+				{Type: T_NUMBER, Value: "1"},
+				{Type: T_RIGHT_BRACKET, Value: "]"},
+				{Type: T_EOF},
+			},
+		},
+		{
+			`a ?`,
+			[]token{
+				{Type: T_IDENTIFIER, Value: "a"},
+				{Type: T_ERR, Value: `unexpected character "?"`},
+			},
+		},
 	} {
 		var tokens []token
 		lexer := newLexer(test.exp)
@@ -80,3 +114,72 @@ func TestLexer(t *testing.T) {
 		}
 	}
 }
+
+func TestLexerPosition(t *testing.T) {
+	l := newLexer("(a == 1) &&\n  b != 'x'\n\"y")
+	for _, want := range []token{
+		{Type: T_LEFT_PAREN, Line: 1, Col: 1},
+		{Type: T_IDENTIFIER, Line: 1, Col: 2},
+		{Type: T_IS_EQUAL, Line: 1, Col: 4},
+		{Type: T_NUMBER, Line: 1, Col: 7},
+		{Type: T_RIGHT_PAREN, Line: 1, Col: 8},
+		{Type: T_LOGICAL_AND, Line: 1, Col: 10},
+		{Type: T_IDENTIFIER, Line: 2, Col: 3},
+		{Type: T_IS_NOT_EQUAL, Line: 2, Col: 5},
+		{Type: T_IDENTIFIER, Line: 2, Col: 9},
+		{Type: T_ERR, Line: 3, Col: 1},
+		{Type: T_EOF},
+		{Type: T_EOF},
+	} {
+		have := l.token()
+		if have.Type != want.Type || (want.Line > 0 && (have.Line != want.Line || have.Col != want.Col)) {
+			t.Errorf("unexpected token %s at %d:%d, want %s at %d:%d", have, have.Line, have.Col, want.Type, want.Line, want.Col)
+		}
+	}
+}
+
+func TestLexerLimits(t *testing.T) {
+	for _, test := range []struct {
+		input  string
+		limits Limits
+		err    string
+	}{
+		{`a == "xy"`, Limits{MaxLength: 9, MaxStringLiteral: 2}, ""},
+		{`a == "xy"`, Limits{MaxLength: 8}, "1:9 input length exceeds limit of 8"},
+		{`a == "xy"`, Limits{MaxStringLiteral: 1}, "1:6 string literal length exceeds limit of 1"},
+		{"a == 1 ||\n'xy' == 2", Limits{MaxStringLiteral: 1}, "2:1 string literal length exceeds limit of 1"},
+	} {
+		l := newLexerLimits(test.input, test.limits)
+		for tok := l.token(); tok.Type != T_EOF; tok = l.token() {
+		}
+		if (l.err == nil && test.err != "") || (l.err != nil && l.err.Error() != test.err) {
+			t.Errorf("lexing %q with %+v: error %v, want %q", test.input, test.limits, l.err, test.err)
+		}
+	}
+}
+
+// FuzzLexer checks that the lexer makes progress on any input, so that it
+// always terminates, and that it reports positions in order. The seed corpus
+// lives in testdata/fuzz/FuzzLexer.
+func FuzzLexer(f *testing.F) {
+	f.Fuzz(func(t *testing.T, s string) {
+		l := newLexer(s)
+		line, col := 1, 0
+		for n := 0; ; n++ {
+			if n > len(s)+1 {
+				t.Fatalf("lexing %q produced more than %d tokens", s, n)
+			}
+			tok := l.token()
+			if tok.Type == T_EOF {
+				break
+			}
+			if tok.Line < line || (tok.Line == line && tok.Col <= col) {
+				t.Fatalf("lexing %q: token %s at %d:%d follows %d:%d", s, tok, tok.Line, tok.Col, line, col)
+			}
+			line, col = tok.Line, tok.Col
+		}
+		if tok := l.token(); tok.Type != T_EOF {
+			t.Fatalf("lexing %q: unexpected %s after T_EOF", s, tok)
+		}
+	})
+}
@@ -4,9 +4,59 @@ package parse
 
 import "fmt"
 
+// maxDepth limits the nesting depth when Limits.MaxDepth is zero, so that
+// walking a tree recursively cannot exhaust the stack.
+const maxDepth = 10000
+
+// Limits restricts the resources used to parse untrusted input. A zero field
+// means no limit, except for MaxDepth which defaults to 10000.
+type Limits struct {
+	// MaxLength is the maximum length of the input in bytes.
+	MaxLength int
+	// MaxDepth is the maximum nesting depth. The top level of the input is at
+	// depth 1, and every parenthesis, negation and let binding adds one level.
+	MaxDepth int
+	// MaxNodes is the maximum number of nodes of the parse tree, counting
+	// operators and operands.
+	MaxNodes int
+	// MaxStringLiteral is the maximum length in bytes of a quoted string or
+	// identifier.
+	MaxStringLiteral int
+}
+
+// LimitError is returned when the input exceeds one of the Limits.
+type LimitError struct {
+	// Limit describes the limit which was exceeded, such as "input length".
+	Limit string
+	// Max is the value of the limit.
+	Max int
+	// Line and Col locate the offending input, both starting at 1.
+	Line, Col int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%d:%d %s exceeds limit of %d", e.Line, e.Col, e.Limit, e.Max)
+}
+
 type parser struct {
 	lexer *lexer
 	buf   []token
+	nodes int
+	trees []tree // preallocated trees, handed out by alloc.
+}
+
+// peek returns the next token from the lexer without advancing the cursor.
+func (p *parser) peek() token {
+	return p.peekAt(0)
+}
+
+// peekAt returns the token i positions after the next one without advancing
+// the cursor.
+func (p *parser) peekAt(i int) token {
+	for len(p.buf) <= i {
+		p.buf = append(p.buf, p.lexer.token())
+	}
+	return p.buf[i]
 }
 
 // read returns the next token from the lexer and advances the cursor. This
@@ -20,57 +70,422 @@ func (p *parser) read() token {
 	return p.lexer.token()
 }
 
+// SyntaxError is returned for input which is not a valid expression.
+type SyntaxError struct {
+	// Msg describes the error, such as "unexpected end of input".
+	Msg string
+	// Line and Col locate the offending input, both starting at 1.
+	Line, Col int
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%d:%d syntax error: %s", e.Line, e.Col, e.Msg)
+}
+
 // errorf creates a parsing error which describes the token currently being
 // processed as well as line and column numbers from the input stream.
 func (p *parser) errorf(t token, format string, v ...interface{}) error {
-	return fmt.Errorf("%d:%d syntax error: %s", t.Line, t.Col, fmt.Sprintf(format, v...))
+	return &SyntaxError{Msg: fmt.Sprintf(format, v...), Line: t.Line, Col: t.Col}
 }
 
-// parse requests tokens from the lexer and generates
-func (p *parser) parse() (*tree, error) {
+// node creates a tree node for t, enforcing the MaxNodes limit.
+func (p *parser) node(t token) (*tree, error) {
+	p.nodes++
+	if max := p.lexer.limits.MaxNodes; max > 0 && p.nodes > max {
+		return nil, &LimitError{Limit: "node count", Max: max, Line: t.Line, Col: t.Col}
+	}
+	return p.alloc(t), nil
+}
+
+// treeBlock is the number of trees allocated at once by the parser.
+const treeBlock = 64
+
+// alloc returns a new tree for t. Trees are allocated in blocks to reduce the
+// number of allocations.
+func (p *parser) alloc(t token) *tree {
+	if len(p.trees) == 0 {
+		p.trees = make([]tree, treeBlock)
+	}
+	node := &p.trees[0]
+	p.trees = p.trees[1:]
+	node.value = t
+	return node
+}
 
-	tree := newTree()
-	node := tree
+// precedence returns the binding strength of an operator. Negation and
+// quantifiers bind more loosely than comparisons, so that !a == 1 negates the
+// comparison and any a == 1 quantifies it. A let binding binds most loosely of
+// all, so that its body extends as far as possible.
+func precedence(t tokenType) int {
+	switch t {
+	case T_LET:
+		return 0
+	case T_LOGICAL_OR:
+		return 1
+	case T_LOGICAL_AND:
+		return 2
+	case T_LOGICAL_NOT:
+		return 3
+	case T_ANY, T_ALL, T_SIZE:
+		return 4
+	case T_IS_EQUAL, T_IS_NOT_EQUAL, T_IS_GREATER, T_IS_GREATER_OR_EQUAL, T_IS_SMALLER, T_IS_SMALLER_OR_EQUAL, T_MATCHES, T_HAS, T_INTERSECTS, T_SUBSET_OF, T_IN:
+		return 5
+	}
+	return -1
+}
 
-	stack := newStack()
-	stack.push(tree)
+// unary reports whether t is an operator taking a single operand.
+func unary(t tokenType) bool {
+	return t == T_LOGICAL_NOT || t == T_ANY || t == T_ALL || t == T_SIZE || t == T_LET
+}
 
-	var err error
+// nests reports whether t is an operator adding a level of nesting.
+func nests(t tokenType) bool {
+	return t == T_LOGICAL_NOT || t == T_LET
+}
 
-loop:
+// binding reports whether t is a let binding whose value has not been parsed
+// up to the keyword in.
+func binding(t *tree) bool {
+	return t.value.Type == T_LET && t.left.right == nil
+}
+
+// membership reports whether the keyword in just read is followed by a
+// parenthesized list of literals, as in plan in ("pro", "team"), rather than
+// by the body of a let binding. A body cannot start with a literal, so one
+// token past the parenthesis tells them apart.
+func (p *parser) membership() bool {
+	if p.peek().Type != T_LEFT_PAREN {
+		return false
+	}
+	t := p.peekAt(1).Type
+	return t == T_STRING || t == T_NUMBER
+}
+
+// prefixes maps the identifiers which apply to a comparison when followed by
+// another identifier, as in any tag == "x", size roles > 2 or let x = ... in.
+var prefixes = map[string]tokenType{
+	"any":  T_ANY,
+	"all":  T_ALL,
+	"size": T_SIZE,
+	"let":  T_LET,
+}
+
+// infixes maps the identifiers which compare two operands when they follow an
+// operand, as in roles has "admin" or plan in ("pro", "team"). The keyword in
+// also ends the value of a let binding, unless it is followed by a
+// parenthesized list.
+var infixes = map[string]tokenType{
+	"has":        T_HAS,
+	"intersects": T_INTERSECTS,
+	"subsetof":   T_SUBSET_OF,
+	"in":         T_IN,
+}
+
+// keyword returns the type of the identifier t, which is a keyword depending
+// on its position, or T_IDENTIFIER otherwise. A prefix keyword followed by an
+// infix keyword is an identifier, as in size has "x".
+func (p *parser) keyword(t token, expectOperand bool) tokenType {
+	if expectOperand {
+		if k, ok := prefixes[t.Value]; ok {
+			if next := p.peek(); next.Type == T_IDENTIFIER && infixes[next.Value] == 0 {
+				return k
+			}
+		}
+	} else if k, ok := infixes[t.Value]; ok {
+		return k
+	}
+	return T_IDENTIFIER
+}
+
+// parse requests tokens from the lexer and generates a parse tree. Operators
+// are arranged by precedence using a stack, so that the input can be nested
+// arbitrarily deep without recursion.
+func (p *parser) parse() (*tree, error) {
+	operands := newStack()
+	operators := newStack()
+
+	limit := p.lexer.limits.MaxDepth
+	if limit <= 0 {
+		limit = maxDepth
+	}
+	depth := 1
+
+	expectOperand := true
 	for {
 		token := p.read()
+		if token.Type == T_IDENTIFIER {
+			token.Type = p.keyword(token, expectOperand)
+		}
 		switch token.Type {
-		case T_LEFT_PAREN:
-			node.left = newTree()
-			stack.push(node)
-			node = node.left
-		case T_RIGHT_PAREN:
-			node, err = stack.pop()
+		case T_IDENTIFIER, T_NUMBER, T_STRING, T_BOOLEAN:
+			if !expectOperand {
+				return nil, p.errorf(token, "unexpected %s %q", token.Type, token.Value)
+			}
+			node, err := p.node(token)
 			if err != nil {
-				break loop
+				return nil, err
 			}
-		case T_LOGICAL_AND, T_LOGICAL_OR, T_LOGICAL_NOT, T_IS_EQUAL, T_IS_NOT_EQUAL, T_IS_GREATER, T_IS_GREATER_OR_EQUAL, T_IS_SMALLER, T_IS_SMALLER_OR_EQUAL:
-			node.value = token
-			node.right = newTree()
-			stack.push(node)
-			node = node.right
-		case T_IDENTIFIER, T_NUMBER, T_STRING, T_BOOLEAN:
-			node.value = token
-			node, err = stack.pop()
+			operands.push(node)
+			expectOperand = false
+		case T_LEFT_BRACKET:
+			if !expectOperand {
+				return nil, p.errorf(token, "unexpected %s", token.Type)
+			}
+			node, err := p.list(token, T_RIGHT_BRACKET)
+			if err != nil {
+				return nil, err
+			}
+			operands.push(node)
+			expectOperand = false
+		case T_ANY, T_ALL, T_SIZE:
+			node, err := p.node(token)
 			if err != nil {
-				break loop
+				return nil, err
+			}
+			operators.push(node)
+		case T_LET:
+			if depth++; depth > limit {
+				return nil, &LimitError{Limit: "nesting depth", Max: limit, Line: token.Line, Col: token.Col}
 			}
+			node, err := p.let(token)
+			if err != nil {
+				return nil, err
+			}
+			operators.push(node)
+		case T_IN:
+			if p.membership() {
+				if err := p.operator(token, operands, operators, &depth); err != nil {
+					return nil, err
+				}
+				node, err := p.list(p.read(), T_RIGHT_PAREN)
+				if err != nil {
+					return nil, err
+				}
+				operands.push(node)
+				continue
+			}
+			for {
+				top, ok := operators.peek()
+				if !ok || top.value.Type == T_LEFT_PAREN {
+					return nil, p.errorf(token, "unexpected %s", token.Type)
+				}
+				if binding(top) {
+					value, err := operands.pop()
+					if err != nil {
+						return nil, err
+					}
+					top.left.right = value
+					break
+				}
+				if err := p.reduce(operands, operators); err != nil {
+					return nil, err
+				}
+				if nests(top.value.Type) {
+					depth--
+				}
+			}
+			expectOperand = true
+		case T_LEFT_PAREN, T_LOGICAL_NOT:
+			if !expectOperand {
+				return nil, p.errorf(token, "unexpected %s", token.Type)
+			}
+			if depth++; depth > limit {
+				return nil, &LimitError{Limit: "nesting depth", Max: limit, Line: token.Line, Col: token.Col}
+			}
+			node := p.alloc(token)
+			if token.Type == T_LOGICAL_NOT {
+				var err error
+				if node, err = p.node(token); err != nil {
+					return nil, err
+				}
+			}
+			operators.push(node)
+		case T_RIGHT_PAREN:
+			if expectOperand {
+				return nil, p.errorf(token, "unexpected %s", token.Type)
+			}
+			for {
+				top, ok := operators.peek()
+				if !ok {
+					return nil, p.errorf(token, "unbalanced %s", token.Type)
+				}
+				if top.value.Type == T_LEFT_PAREN {
+					operators.pop()
+					depth--
+					break
+				}
+				if binding(top) {
+					return nil, p.errorf(token, "unexpected %s", token.Type)
+				}
+				if err := p.reduce(operands, operators); err != nil {
+					return nil, err
+				}
+				if nests(top.value.Type) {
+					depth--
+				}
+			}
+		case T_LOGICAL_AND, T_LOGICAL_OR, T_IS_EQUAL, T_IS_NOT_EQUAL, T_IS_GREATER, T_IS_GREATER_OR_EQUAL, T_IS_SMALLER, T_IS_SMALLER_OR_EQUAL, T_MATCHES, T_HAS, T_INTERSECTS, T_SUBSET_OF:
+			if expectOperand {
+				return nil, p.errorf(token, "unexpected %s", token.Type)
+			}
+			if err := p.operator(token, operands, operators, &depth); err != nil {
+				return nil, err
+			}
+			expectOperand = true
 		case T_EOF:
-			break loop
-		case T_ERR:
-			return nil, p.errorf(token, "error %s", token.Value)
+			if expectOperand {
+				return nil, p.errorf(token, "unexpected end of input")
+			}
+			for {
+				top, ok := operators.peek()
+				if !ok {
+					break
+				}
+				if top.value.Type == T_LEFT_PAREN {
+					return nil, p.errorf(top.value, "unbalanced %s", top.value.Type)
+				}
+				if binding(top) {
+					return nil, p.errorf(token, "unexpected end of input, expected T_IN")
+				}
+				if err := p.reduce(operands, operators); err != nil {
+					return nil, err
+				}
+			}
+			return operands.pop()
+		case T_ERR, T_RIGHT_BRACKET, T_COMMA, T_ASSIGN:
+			return nil, p.unexpected(token)
 		default:
 			return nil, p.errorf(token, "unknown token %s", token.Type)
 		}
 	}
+}
+
+// operator pushes the binary operator t, after reducing the operators on top
+// of the stack which bind at least as tightly and decrementing depth for each
+// of them which nests.
+func (p *parser) operator(t token, operands, operators *stack, depth *int) error {
+	for {
+		top, ok := operators.peek()
+		if !ok || top.value.Type == T_LEFT_PAREN || precedence(top.value.Type) < precedence(t.Type) {
+			break
+		}
+		if err := p.reduce(operands, operators); err != nil {
+			return err
+		}
+		if nests(top.value.Type) {
+			*depth--
+		}
+	}
+	node, err := p.node(t)
+	if err != nil {
+		return err
+	}
+	operators.push(node)
+	return nil
+}
+
+// let parses the name of a let binding following the keyword start. The
+// binding is returned as a T_LET node whose left operand is a T_ASSIGN node
+// holding the name, to which the value is attached once it has been parsed.
+// Its right operand is the body of the binding.
+func (p *parser) let(start token) (*tree, error) {
+	let, err := p.node(start)
+	if err != nil {
+		return nil, err
+	}
+	name, err := p.node(p.read())
+	if err != nil {
+		return nil, err
+	}
+	t := p.read()
+	if t.Type != T_ASSIGN {
+		return nil, p.unexpected(t)
+	}
+	assign, err := p.node(t)
+	if err != nil {
+		return nil, err
+	}
+	assign.left = name
+	let.left = assign
+	return let, nil
+}
+
+// list parses the elements of a list following the opening bracket or
+// parenthesis start, up to the closing token end. The list is returned as a
+// T_LIST node whose right operand is the chain of its elements joined by
+// T_COMMA nodes leaning left, or nil if it is empty.
+func (p *parser) list(start token, end tokenType) (*tree, error) {
+	start.Type = T_LIST
+	list, err := p.node(start)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.read()
+		if t.Type == end && list.right == nil {
+			return list, nil
+		}
+		if t.Type != T_STRING && t.Type != T_NUMBER {
+			return nil, p.unexpected(t)
+		}
+		elem, err := p.node(t)
+		if err != nil {
+			return nil, err
+		}
+		if list.right == nil {
+			list.right = elem
+		} else {
+			comma, err := p.node(token{Type: T_COMMA, Value: ",", Line: t.Line, Col: t.Col})
+			if err != nil {
+				return nil, err
+			}
+			comma.left, comma.right = list.right, elem
+			list.right = comma
+		}
+		switch t = p.read(); t.Type {
+		case T_COMMA:
+		case end:
+			return list, nil
+		default:
+			return nil, p.unexpected(t)
+		}
+	}
+}
 
-	return tree, err
+// unexpected returns an error describing the unexpected token t.
+func (p *parser) unexpected(t token) error {
+	switch t.Type {
+	case T_EOF:
+		return p.errorf(t, "unexpected end of input")
+	case T_ERR:
+		if p.lexer.err != nil {
+			return p.lexer.err
+		}
+		return p.errorf(t, "%s", t.Value)
+	case T_IDENTIFIER, T_NUMBER, T_STRING, T_BOOLEAN:
+		return p.errorf(t, "unexpected %s %q", t.Type, t.Value)
+	}
+	return p.errorf(t, "unexpected %s", t.Type)
+}
+
+// reduce pops the operator on top of the operators stack, attaches its
+// operands and pushes the result to the operands stack.
+func (p *parser) reduce(operands, operators *stack) error {
+	op, err := operators.pop()
+	if err != nil {
+		return err
+	}
+	if op.right, err = operands.pop(); err != nil {
+		return err
+	}
+	if !unary(op.value.Type) {
+		if op.left, err = operands.pop(); err != nil {
+			return err
+		}
+	}
+	operands.push(op)
+	return nil
 }
 
 // newParser creates a new parser using the supplied lexer.
@@ -80,7 +495,24 @@ func newParser(l *lexer) *parser {
 
 // Parse parses an expression in text format and returns the parse tree.
 func Parse(s string) (Tree, error) {
-	l := newLexer(s)
-	p := newParser(l)
-	return p.parse()
+	return ParseLimits(s, Limits{})
+}
+
+// ParseLimits is like Parse but fails with a *LimitError if s exceeds any of
+// the limits.
+func ParseLimits(s string, limits Limits) (Tree, error) {
+	return ParseAt(s, 1, 1, limits)
+}
+
+// ParseAt is like ParseLimits but positions are counted as if s started at
+// the given line and column of a larger input, such as a file holding several
+// expressions.
+func ParseAt(s string, line, col int, limits Limits) (Tree, error) {
+	l := newLexerLimits(s, limits)
+	l.line, l.lineStart = line, 1-col
+	t, err := newParser(l).parse()
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
 }
@@ -3,6 +3,9 @@
 package parse
 
 import (
+	"errors"
+	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -43,6 +46,190 @@ func TestParser(t *testing.T) {
 				right: &tree{value: token{Type: T_IDENTIFIER, Value: "bar"}},
 			},
 		},
+		{
+			"!foo == 1 || bar",
+			&tree{
+				value: token{Type: T_LOGICAL_OR, Value: "||"},
+				left: &tree{
+					value: token{Type: T_LOGICAL_NOT, Value: "!"},
+					right: &tree{
+						value: token{Type: T_IS_EQUAL, Value: "=="},
+						left:  &tree{value: token{Type: T_IDENTIFIER, Value: "foo"}},
+						right: &tree{value: token{Type: T_NUMBER, Value: "1"}},
+					},
+				},
+				right: &tree{value: token{Type: T_IDENTIFIER, Value: "bar"}},
+			},
+		},
+		{
+			"a && b && c",
+			&tree{
+				value: token{Type: T_LOGICAL_AND, Value: "&&"},
+				left: &tree{
+					value: token{Type: T_LOGICAL_AND, Value: "&&"},
+					left:  &tree{value: token{Type: T_IDENTIFIER, Value: "a"}},
+					right: &tree{value: token{Type: T_IDENTIFIER, Value: "b"}},
+				},
+				right: &tree{value: token{Type: T_IDENTIFIER, Value: "c"}},
+			},
+		},
+		{
+			`any tag == "x" && any == 1`,
+			&tree{
+				value: token{Type: T_LOGICAL_AND, Value: "&&"},
+				left: &tree{
+					value: token{Type: T_ANY, Value: "any"},
+					right: &tree{
+						value: token{Type: T_IS_EQUAL, Value: "=="},
+						left:  &tree{value: token{Type: T_IDENTIFIER, Value: "tag"}},
+						right: &tree{value: token{Type: T_STRING, Value: "x"}},
+					},
+				},
+				right: &tree{
+					value: token{Type: T_IS_EQUAL, Value: "=="},
+					left:  &tree{value: token{Type: T_IDENTIFIER, Value: "any"}},
+					right: &tree{value: token{Type: T_NUMBER, Value: "1"}},
+				},
+			},
+		},
+		{
+			`roles has "admin" && size roles > 1`,
+			&tree{
+				value: token{Type: T_LOGICAL_AND, Value: "&&"},
+				left: &tree{
+					value: token{Type: T_HAS, Value: "has"},
+					left:  &tree{value: token{Type: T_IDENTIFIER, Value: "roles"}},
+					right: &tree{value: token{Type: T_STRING, Value: "admin"}},
+				},
+				right: &tree{
+					value: token{Type: T_SIZE, Value: "size"},
+					right: &tree{
+						value: token{Type: T_IS_GREATER, Value: ">"},
+						left:  &tree{value: token{Type: T_IDENTIFIER, Value: "roles"}},
+						right: &tree{value: token{Type: T_NUMBER, Value: "1"}},
+					},
+				},
+			},
+		},
+		{
+			`groups intersects ["a", "b", 3] || size subsetof []`,
+			&tree{
+				value: token{Type: T_LOGICAL_OR, Value: "||"},
+				left: &tree{
+					value: token{Type: T_INTERSECTS, Value: "intersects"},
+					left:  &tree{value: token{Type: T_IDENTIFIER, Value: "groups"}},
+					right: &tree{
+						value: token{Type: T_LIST, Value: "["},
+						right: &tree{
+							value: token{Type: T_COMMA, Value: ","},
+							left: &tree{
+								value: token{Type: T_COMMA, Value: ","},
+								left:  &tree{value: token{Type: T_STRING, Value: "a"}},
+								right: &tree{value: token{Type: T_STRING, Value: "b"}},
+							},
+							right: &tree{value: token{Type: T_NUMBER, Value: "3"}},
+						},
+					},
+				},
+				right: &tree{
+					value: token{Type: T_SUBSET_OF, Value: "subsetof"},
+					left:  &tree{value: token{Type: T_IDENTIFIER, Value: "size"}},
+					right: &tree{value: token{Type: T_LIST, Value: "["}},
+				},
+			},
+		},
+		{
+			`let a = x > 1 || y in a && z`,
+			&tree{
+				value: token{Type: T_LET, Value: "let"},
+				left: &tree{
+					value: token{Type: T_ASSIGN, Value: "="},
+					left:  &tree{value: token{Type: T_IDENTIFIER, Value: "a"}},
+					right: &tree{
+						value: token{Type: T_LOGICAL_OR, Value: "||"},
+						left: &tree{
+							value: token{Type: T_IS_GREATER, Value: ">"},
+							left:  &tree{value: token{Type: T_IDENTIFIER, Value: "x"}},
+							right: &tree{value: token{Type: T_NUMBER, Value: "1"}},
+						},
+						right: &tree{value: token{Type: T_IDENTIFIER, Value: "y"}},
+					},
+				},
+				right: &tree{
+					value: token{Type: T_LOGICAL_AND, Value: "&&"},
+					left:  &tree{value: token{Type: T_IDENTIFIER, Value: "a"}},
+					right: &tree{value: token{Type: T_IDENTIFIER, Value: "z"}},
+				},
+			},
+		},
+		{
+			`x || (let a = !y in a) && let b = 1 in b`,
+			&tree{
+				value: token{Type: T_LOGICAL_OR, Value: "||"},
+				left:  &tree{value: token{Type: T_IDENTIFIER, Value: "x"}},
+				right: &tree{
+					value: token{Type: T_LOGICAL_AND, Value: "&&"},
+					left: &tree{
+						value: token{Type: T_LET, Value: "let"},
+						left: &tree{
+							value: token{Type: T_ASSIGN, Value: "="},
+							left:  &tree{value: token{Type: T_IDENTIFIER, Value: "a"}},
+							right: &tree{
+								value: token{Type: T_LOGICAL_NOT, Value: "!"},
+								right: &tree{value: token{Type: T_IDENTIFIER, Value: "y"}},
+							},
+						},
+						right: &tree{value: token{Type: T_IDENTIFIER, Value: "a"}},
+					},
+					right: &tree{
+						value: token{Type: T_LET, Value: "let"},
+						left: &tree{
+							value: token{Type: T_ASSIGN, Value: "="},
+							left:  &tree{value: token{Type: T_IDENTIFIER, Value: "b"}},
+							right: &tree{value: token{Type: T_NUMBER, Value: "1"}},
+						},
+						right: &tree{value: token{Type: T_IDENTIFIER, Value: "b"}},
+					},
+				},
+			},
+		},
+		{
+			`let a = x in ("a", 1) in a`,
+			&tree{
+				value: token{Type: T_LET, Value: "let"},
+				left: &tree{
+					value: token{Type: T_ASSIGN, Value: "="},
+					left:  &tree{value: token{Type: T_IDENTIFIER, Value: "a"}},
+					right: &tree{
+						value: token{Type: T_IN, Value: "in"},
+						left:  &tree{value: token{Type: T_IDENTIFIER, Value: "x"}},
+						right: &tree{
+							value: token{Type: T_LIST, Value: "("},
+							right: &tree{
+								value: token{Type: T_COMMA, Value: ","},
+								left:  &tree{value: token{Type: T_STRING, Value: "a"}},
+								right: &tree{value: token{Type: T_NUMBER, Value: "1"}},
+							},
+						},
+					},
+				},
+				right: &tree{value: token{Type: T_IDENTIFIER, Value: "a"}},
+			},
+		},
+		{
+			"!all size > 36",
+			&tree{
+				value: token{Type: T_LOGICAL_NOT, Value: "!"},
+				right: &tree{
+					value: token{Type: T_ALL, Value: "all"},
+					right: &tree{
+						value: token{Type: T_IS_GREATER, Value: ">"},
+						left:  &tree{value: token{Type: T_IDENTIFIER, Value: "size"}},
+						right: &tree{value: token{Type: T_NUMBER, Value: "36"}},
+					},
+				},
+			},
+		},
 	} {
 		ast, err := newParser(newLexer(test.exp)).parse()
 		if err != nil {
@@ -55,6 +242,54 @@ func TestParser(t *testing.T) {
 	}
 }
 
+func TestParseAt(t *testing.T) {
+	for _, test := range []struct {
+		input string
+		err   string
+		line  int
+		col   int
+	}{
+		{"a == 1 b", `3:17 syntax error: unexpected T_IDENTIFIER "b"`, 3, 17},
+		{"a == 1 &&\n  b ? 1", `4:5 syntax error: unexpected character "?"`, 4, 5},
+	} {
+		_, err := ParseAt(test.input, 3, 10, Limits{})
+		var se *SyntaxError
+		if !errors.As(err, &se) || err.Error() != test.err || se.Line != test.line || se.Col != test.col {
+			t.Errorf("ParseAt(%q) error = %v, want %s", test.input, err, test.err)
+		}
+	}
+	_, err := ParseAt("abcdef", 2, 4, Limits{MaxLength: 3})
+	var le *LimitError
+	if !errors.As(err, &le) || le.Line != 2 || le.Col != 7 {
+		t.Errorf("ParseAt error = %v, want a limit error at 2:7", err)
+	}
+}
+
+func TestParserLimits(t *testing.T) {
+	for _, test := range []struct {
+		input  string
+		limits Limits
+		err    string
+	}{
+		{"(!(a))", Limits{MaxDepth: 4, MaxNodes: 2}, ""},
+		{"(!(a))", Limits{MaxDepth: 3}, "1:3 nesting depth exceeds limit of 3"},
+		{"(!(a))", Limits{MaxNodes: 1}, "1:4 node count exceeds limit of 1"},
+		{"!a && !b && !c", Limits{MaxDepth: 2}, ""},
+		{"a == 'xyz'", Limits{MaxStringLiteral: 2}, "1:6 string literal length exceeds limit of 2"},
+		{"let a = b in a", Limits{MaxDepth: 1}, "1:1 nesting depth exceeds limit of 1"},
+	} {
+		_, err := ParseLimits(test.input, test.limits)
+		var limit *LimitError
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("ParseLimits(%q, %+v) = %v", test.input, test.limits, err)
+			}
+		} else if !errors.As(err, &limit) || err.Error() != test.err {
+			t.Errorf("ParseLimits(%q, %+v) = %v, want %s", test.input, test.limits, err, test.err)
+		}
+	}
+}
+
 func treeEquals(a, b *tree) bool {
 
 	if a == nil && b == nil {
@@ -79,3 +314,64 @@ func treeEquals(a, b *tree) bool {
 
 	return true
 }
+
+// FuzzParse checks that the parser never panics and that the trees it returns
+// are well formed. The seed corpus lives in testdata/fuzz/FuzzParse.
+func FuzzParse(f *testing.F) {
+	f.Fuzz(func(t *testing.T, s string) {
+		tree, err := Parse(s)
+		if err != nil {
+			return
+		}
+		var check func(Tree) bool
+		check = func(n Tree) bool {
+			switch n.Value().Type {
+			case T_IDENTIFIER, T_NUMBER, T_STRING, T_BOOLEAN:
+				return n.Left() == nil && n.Right() == nil
+			case T_LIST:
+				return n.Left() == nil && (n.Right() == nil || check(n.Right()))
+			case T_LOGICAL_NOT, T_ANY, T_ALL, T_SIZE:
+				return n.Left() == nil && n.Right() != nil && check(n.Right())
+			}
+			return n.Left() != nil && n.Right() != nil && check(n.Left()) && check(n.Right())
+		}
+		if !check(tree) {
+			t.Fatalf("Parse(%q) returned a malformed tree %s", s, tree)
+		}
+	})
+}
+
+// benchmarkInput returns a large rule file of n rules joined by ||, each rule
+// a parenthesized conjunction of comparisons.
+func benchmarkInput(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			b.WriteString(" ||\n")
+		}
+		fmt.Fprintf(&b, `(country == "GR" && amount >= %d.50 && !(status == "blocked") && 'tier-level' < %d)`, i, i%10)
+	}
+	return b.String()
+}
+
+func BenchmarkLexer(b *testing.B) {
+	input := benchmarkInput(1000)
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l := newLexer(input)
+		for tok := l.token(); tok.Type != T_EOF; tok = l.token() {
+		}
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	input := benchmarkInput(1000)
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := Parse(input); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
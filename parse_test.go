@@ -1,6 +1,13 @@
 package exp
 
-import "testing"
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexkappa/exp/parse"
+)
 
 func TestParse(t *testing.T) {
 	m := Map{
@@ -16,6 +23,14 @@ func TestParse(t *testing.T) {
 		`((foo > 200) || (bar == "x"))`,
 		`((foo > 100) && (bar == "x"))`,
 		`('b-z' == "z")`,
+		`foo == 124`,
+		`foo > 1 && foo < 200 && bar == "x"`,
+		`foo > 200 || bar == "x" && foo != 1`,
+		`!(foo > 200) && !false`,
+		`!foo == 1`,
+		`!!true`,
+		`(((foo == 124) && (bar == "x")) || ('b-z' == "y"))`,
+		`bar =~ "^[a-z]$"`,
 	} {
 		exp, err := Parse(s)
 		if err != nil {
@@ -27,3 +42,160 @@ func TestParse(t *testing.T) {
 		t.Logf("%s", exp)
 	}
 }
+
+func TestParseStructure(t *testing.T) {
+	for _, test := range []struct {
+		text string
+		str  string
+	}{
+		{`a == 1 && b == 2 && c == 3`, "([a==1.00]∧[b==2.00]∧[c==3.00])"},
+		{`a == 1 || b == 2 && c == 3`, "([a==1.00]∨([b==2.00]∧[c==3.00]))"},
+		{`(a == 1 || b == 2) && c == 3`, "(([a==1.00]∨[b==2.00])∧[c==3.00])"},
+		{`!a == "x" && b == "y"`, "(¬[a==x]∧[b==y])"},
+		{`!(a == "x" && b == "y")`, "¬([a==x]∧[b==y])"},
+		{`a =~ "x+"`, "[a=~x+]"},
+		{`any tag == "x" && all n >= 2`, "(∃tag:[tag==x]∧∀n:([n>2.00]∨[n==2.00]))"},
+		{`!any tag != "x"`, "¬∃tag:¬[tag==x]"},
+		{`any == 1`, "[any==1.00]"},
+		{`roles has "admin" && size roles >= 2`, "([roles∋{admin}]∧[|roles|>1])"},
+		{`size roles < 2 || size roles <= 2 || size roles != 0`, "(¬[|roles|>1]∨¬[|roles|>2]∨¬[|roles|==0])"},
+		{`groups intersects ["a", 1] && groups subsetof []`, "([groups∩{a,1}]∧[groups⊆{}])"},
+		{`size has "x"`, "[size∋{x}]"},
+		{`size roles >= 0`, "T"},
+		{`size roles < 0`, "F"},
+		{`let premium = plan intersects ["pro", "enterprise"] in premium && seats > 10`, "([plan∩{pro,enterprise}]∧[seats>10.00])"},
+		{`let premium = plan in ("pro", "enterprise") in premium && seats > 10`, "(([plan==pro]∨[plan==enterprise])∧[seats>10.00])"},
+		{`plan in ("pro", 2) && !region in ("eu")`, "(([plan==pro]∨[plan==2.00])∧¬([region==eu]))"},
+		{`let a = x == 1 in let b = a || y == 2 in b && !a`, "(([x==1.00]∨[y==2.00])∧¬[x==1.00])"},
+		{`let a = x == 1 in (let a = y == 2 in a) && a`, "([y==2.00]∧[x==1.00])"},
+	} {
+		e, err := Parse(test.text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if str := sprintf("%s", e); str != test.str {
+			t.Errorf("Parse(%q) = %s, want %s", test.text, str, test.str)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, test := range []struct {
+		text string
+		err  string
+	}{
+		{``, "1:1 syntax error: unexpected end of input"},
+		{`a ==`, "1:5 syntax error: unexpected end of input"},
+		{`(a == 1`, "1:1 syntax error: unbalanced T_LEFT_PAREN"},
+		{`a == 1)`, "1:7 syntax error: unbalanced T_RIGHT_PAREN"},
+		{`a == 1 b`, `1:8 syntax error: unexpected T_IDENTIFIER "b"`},
+		{`a = 1`, "1:3 syntax error: unexpected T_ASSIGN"},
+		{`let a = x == 1 in b`, `undefined name "b" at line 1 col 19`},
+		{`let a = a in a`, `undefined name "a" at line 1 col 9`},
+		{`let a = x == 1`, "1:15 syntax error: unexpected end of input, expected T_IN"},
+		{`let a x == 1 in a`, "1:7 syntax error: unexpected T_IDENTIFIER \"x\""},
+		{`let a = (x == 1 in a)`, "1:17 syntax error: unexpected T_IN"},
+		{`x == 1 in a`, "1:8 syntax error: unexpected T_IN"},
+		{`x in ("a" "b")`, `1:12 syntax error: unexpected T_STRING "b"`},
+		{`x in ["a"]`, "1:3 syntax error: unexpected T_IN"},
+		{`"x" in ("a")`, "invalid expression. expected identifier but have T_STRING instead at line 1 col 5"},
+		{`a ~ 1`, `1:3 syntax error: unknown operator "~"`},
+		{"a == 1 &&\n  b # 2", `2:5 syntax error: unexpected character "#"`},
+		{`a == "x`, "1:6 syntax error: unterminated literal"},
+		{`a =~ 1`, "invalid expression. expected string but have T_NUMBER instead at line 1 col 3"},
+		{`a =~ "("`, "invalid regular expression: error parsing regexp: missing closing ): `(` at line 1 col 7"},
+		{`a > "x"`, "x is not allowed in T_IS_GREATER expressions at line 1 col 3"},
+		{`a`, `undefined name "a" at line 1 col 1`},
+		{`any tag`, "invalid expression. any must be followed by a comparison at line 1 col 1"},
+		{`size roles`, "invalid expression. size must be followed by a comparison at line 1 col 1"},
+		{`size roles > 1.5`, `invalid expression. expected size but have T_NUMBER "1.5" instead at line 1 col 1`},
+		{`size roles =~ "x"`, `invalid expression. expected size but have T_STRING "x" instead at line 1 col 1`},
+		{`roles has 1`, "invalid expression. expected string but have T_NUMBER instead at line 1 col 7"},
+		{`roles intersects "a"`, "invalid expression. expected list but have T_STRING instead at line 1 col 7"},
+		{`roles intersects ["a" "b"]`, `1:24 syntax error: unexpected T_STRING "b"`},
+		{`roles subsetof [,]`, "1:17 syntax error: unexpected T_COMMA"},
+		{`roles subsetof [`, "1:17 syntax error: unexpected end of input"},
+		{`a == 1, b`, "1:7 syntax error: unexpected T_COMMA"},
+		{`a == ["x"]`, "invalid expression. expected string or number but have T_LIST instead at line 1 col 3"},
+		{`any all tag == 1`, "invalid expression. any must be followed by a comparison at line 1 col 1"},
+	} {
+		_, err := Parse(test.text)
+		if err == nil || err.Error() != test.err {
+			t.Errorf("Parse(%q) error = %v, want %s", test.text, err, test.err)
+		}
+	}
+}
+
+func TestParseOptions(t *testing.T) {
+	for _, test := range []struct {
+		opts  ParseOptions
+		text  string
+		limit string
+		line  int
+		col   int
+	}{
+		{ParseOptions{MaxLength: 10}, `a == "xyz"`, "", 0, 0},
+		{ParseOptions{MaxLength: 10}, `a == "wxyz"`, "input length", 1, 11},
+		{ParseOptions{MaxDepth: 3}, `((a == 1))`, "", 0, 0},
+		{ParseOptions{MaxDepth: 3}, `((!a == 1))`, "nesting depth", 1, 3},
+		{ParseOptions{MaxDepth: 2}, "a == 1 &&\n !(b == 2)", "nesting depth", 2, 3},
+		{ParseOptions{MaxNodes: 7}, `a == 1 && b == 2`, "", 0, 0},
+		{ParseOptions{MaxNodes: 6}, `a == 1 && b == 2`, "node count", 1, 16},
+		{ParseOptions{MaxStringLiteral: 3}, `a == "xyz" || 'abc' == "x"`, "", 0, 0},
+		{ParseOptions{MaxStringLiteral: 3}, `a == "xyz" || 'abcd' == "x"`, "string literal length", 1, 15},
+		{ParseOptions{MaxRegexComplexity: 20}, `a =~ "^x{3}$"`, "", 0, 0},
+		{ParseOptions{MaxRegexComplexity: 20}, `a =~ "^(x{5}){10}$"`, "regular expression complexity", 1, 7},
+	} {
+		_, err := test.opts.Parse(test.text)
+		var limit *parse.LimitError
+		if test.limit == "" {
+			if err != nil {
+				t.Errorf("%+v.Parse(%q) = %v", test.opts, test.text, err)
+			}
+			continue
+		}
+		if !errors.As(err, &limit) || limit.Limit != test.limit || limit.Line != test.line || limit.Col != test.col {
+			t.Errorf("%+v.Parse(%q) = %v, want %s at %d:%d", test.opts, test.text, err, test.limit, test.line, test.col)
+		}
+	}
+}
+
+func TestParseDeep(t *testing.T) {
+	n := 100000
+	text := strings.Repeat("(", n) + "a == 1" + strings.Repeat(")", n)
+	if _, err := (ParseOptions{MaxDepth: n + 1}).Parse(text); err != nil {
+		t.Error(err)
+	}
+	text = strings.Repeat("a == 1 && ", n) + "a == 1"
+	e, err := Parse(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(Inspect(e).Elems); n != 100001 {
+		t.Errorf("unexpected number of operands %d", n)
+	}
+	if _, err := Parse(strings.Repeat("!", n) + "true"); err == nil {
+		t.Error("expected the default depth limit to be exceeded")
+	}
+}
+
+// FuzzParseOptions checks that parsing with limits always returns in time and
+// respects MaxLength. The seed corpus lives in testdata/fuzz/FuzzParseOptions.
+func FuzzParseOptions(f *testing.F) {
+	opts := ParseOptions{MaxLength: 256, MaxDepth: 8, MaxNodes: 32, MaxStringLiteral: 16, MaxRegexComplexity: 64}
+	f.Fuzz(func(t *testing.T, s string) {
+		done := make(chan error, 1)
+		go func() {
+			_, err := opts.Parse(s)
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if err == nil && len(s) > opts.MaxLength {
+				t.Errorf("Parse(%q) exceeded MaxLength", s)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Parse(%q) did not return", s)
+		}
+	})
+}
@@ -0,0 +1,398 @@
+package exp
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/alexkappa/exp/parse"
+)
+
+// FileError is returned for rule files which fail to load, locating the error
+// within the file.
+type FileError struct {
+	// File is the name of the file.
+	File string
+	// Line and Col locate the error, both starting at 1.
+	Line, Col int
+	// Err is the error encountered.
+	Err error
+}
+
+func (e *FileError) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Col, describe(e.Err))
+}
+
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// describe returns the message of err without the position reported along
+// with it by FileError.
+func describe(err error) string {
+	var (
+		se *parse.SyntaxError
+		le *parse.LimitError
+		pe *posError
+	)
+	switch {
+	case errors.As(err, &se):
+		return "syntax error: " + se.Msg
+	case errors.As(err, &le):
+		return fmt.Sprintf("%s exceeds limit of %d", le.Limit, le.Max)
+	case errors.As(err, &pe):
+		return pe.err.Error()
+	}
+	return err.Error()
+}
+
+// ParseFile parses the rule file filename. See ParseOptions.ParseFile.
+func ParseFile(filename string) ([]Rule, error) {
+	return ParseOptions{}.ParseFile(filename)
+}
+
+// ParseFile parses the rule file filename, along with the files it includes,
+// enforcing the limits of o on each rule. Included files are found relative to
+// the directory of the file including them.
+//
+// A rule file holds named rules, each declared with the keyword rule followed
+// by its name, := and its expression. Expressions may continue on the
+// following lines as long as these are indented. Rules may refer to each other
+// by name, including to rules of other files, as with ParseRules.
+//
+// A rule may be preceded by annotations, each on a line of its own starting
+// with @, followed by a name and a value which may be enclosed in double
+// quotes. The annotations priority, which is an integer, and enabled, which is
+// either true or false, are special. Rules which are not enabled are left out
+// of the rules returned, but may still be referred to by other rules. Every
+// other annotation is stored in the Meta of the rule, and the values of tags
+// are separated by commas.
+//
+// Other files are included with the keyword include, followed by the name of
+// the file in double quotes. Each file is only loaded once, and its rules are
+// returned in place of the include. Comments start with # and extend to the
+// end of the line.
+//
+//	include "common.rules"
+//
+//	# Large orders from the EU are reviewed.
+//	@description "Large orders from the EU"
+//	@owner risk
+//	@tags orders, eu
+//	@priority 10
+//	rule large_eu_order := is_eu
+//		&& amount > 1000
+//
+// Errors are returned as a *FileError locating the error within the file.
+func (o ParseOptions) ParseFile(filename string) ([]Rule, error) {
+	l := &ruleLoader{
+		opts: o,
+		read: os.ReadFile,
+		join: func(from, name string) (string, error) {
+			if filepath.IsAbs(name) {
+				return name, nil
+			}
+			return filepath.Join(filepath.Dir(from), name), nil
+		},
+	}
+	return l.load(filename)
+}
+
+// LoadRules loads the rule files names from fsys. See ParseOptions.LoadRules.
+func LoadRules(fsys fs.FS, names ...string) ([]Rule, error) {
+	return ParseOptions{}.LoadRules(fsys, names...)
+}
+
+// LoadRules is like ParseFile, but reads the rule files names, as well as the
+// files they include, from fsys. Rules of all files may refer to each other
+// and are returned in the order the files are given.
+//
+//	rules, err := exp.LoadRules(os.DirFS("rules"), "orders.rules", "users.rules")
+func (o ParseOptions) LoadRules(fsys fs.FS, names ...string) ([]Rule, error) {
+	l := &ruleLoader{
+		opts: o,
+		read: func(name string) ([]byte, error) {
+			return fs.ReadFile(fsys, name)
+		},
+		join: func(from, name string) (string, error) {
+			name = path.Join(path.Dir(from), name)
+			if !fs.ValidPath(name) {
+				return "", fmt.Errorf("invalid include %q", name)
+			}
+			return name, nil
+		},
+	}
+	return l.load(names...)
+}
+
+// fileRule is a rule declared in a rule file.
+type fileRule struct {
+	Rule
+	enabled   bool
+	tree      parse.Tree
+	file      string
+	line, col int
+}
+
+// ruleLoader reads rule files and compiles their rules.
+type ruleLoader struct {
+	opts   ParseOptions
+	read   func(name string) ([]byte, error)
+	join   func(from, name string) (string, error)
+	loaded map[string]bool
+	rules  []*fileRule
+	byName map[string]*fileRule
+}
+
+func (l *ruleLoader) load(names ...string) ([]Rule, error) {
+	l.loaded = map[string]bool{}
+	l.byName = map[string]*fileRule{}
+	for _, name := range names {
+		if err := l.file(name, nil); err != nil {
+			return nil, err
+		}
+	}
+	c := &ruleCompiler{
+		opts:  l.opts,
+		trees: make(map[string]parse.Tree, len(l.rules)),
+		exps:  make(map[string]Exp, len(l.rules)),
+	}
+	for _, r := range l.rules {
+		c.trees[r.Name] = r.tree
+	}
+	var rules []Rule
+	for _, r := range l.rules {
+		e, _, err := c.resolve(r.Name)
+		if err != nil {
+			return nil, l.ruleError(err)
+		}
+		if r.enabled {
+			r.Exp = e
+			rules = append(rules, r.Rule)
+		}
+	}
+	return rules, nil
+}
+
+// ruleError locates an error returned by the compiler in the file of the rule
+// it was found in.
+func (l *ruleLoader) ruleError(err error) error {
+	var re *RuleError
+	if !errors.As(err, &re) {
+		return err
+	}
+	r := l.byName[re.Rule]
+	line, col := r.line, r.col
+	var (
+		pe *posError
+		le *parse.LimitError
+	)
+	if errors.As(re.Err, &pe) {
+		line, col = pe.line, pe.col
+	} else if errors.As(re.Err, &le) {
+		line, col = le.Line, le.Col
+	}
+	return &FileError{r.file, line, col, re.Err}
+}
+
+// file loads the rule file name, included at the position include of another
+// file if not nil.
+func (l *ruleLoader) file(name string, include *FileError) error {
+	if l.loaded[name] {
+		return nil
+	}
+	l.loaded[name] = true
+	src, err := l.read(name)
+	if err != nil {
+		if include != nil {
+			include.Err = err
+			return include
+		}
+		return err
+	}
+	return l.parse(name, string(src))
+}
+
+// parse parses the declarations of the rule file name, whose contents are src.
+func (l *ruleLoader) parse(name, src string) error {
+	errorf := func(line, col int, format string, args ...any) error {
+		return &FileError{name, line, col, fmt.Errorf(format, args...)}
+	}
+	var (
+		rule    *fileRule // the rule whose expression is being read.
+		text    []string  // the lines of its expression.
+		quote   rune      // the quote of a literal left open, if any.
+		pending *fileRule // the rule annotations are attached to.
+		annots  map[string]bool
+	)
+	finish := func() error {
+		if rule == nil {
+			return nil
+		}
+		for len(text) > 1 && strings.TrimSpace(text[len(text)-1]) == "" {
+			text = text[:len(text)-1]
+		}
+		t, err := parse.ParseAt(strings.Join(text, "\n"), rule.line, rule.col, l.opts.limits())
+		if err != nil {
+			var (
+				se *parse.SyntaxError
+				le *parse.LimitError
+			)
+			switch {
+			case errors.As(err, &se):
+				return &FileError{name, se.Line, se.Col, err}
+			case errors.As(err, &le):
+				return &FileError{name, le.Line, le.Col, err}
+			}
+			return errorf(rule.line, rule.col, "%v", err)
+		}
+		rule.tree = t
+		rule, text, quote = nil, nil, 0
+		return nil
+	}
+	lines := strings.Split(src, "\n")
+	for i, line := range lines {
+		n := i + 1
+		line = strings.TrimSuffix(line, "\r")
+		if rule != nil {
+			if quote != 0 || line == "" || line[0] == ' ' || line[0] == '\t' || line[0] == '#' {
+				var code string
+				code, quote = stripComment(line, quote, `"'`)
+				text = append(text, code)
+				continue
+			}
+			if err := finish(); err != nil {
+				return err
+			}
+		}
+		code, _ := stripComment(line, 0, `"`)
+		if strings.TrimSpace(code) == "" {
+			continue
+		}
+		if code[0] == ' ' || code[0] == '\t' {
+			return errorf(n, 1, "unexpected indented line")
+		}
+		keyword, rest, _ := strings.Cut(code, " ")
+		switch {
+		case strings.HasPrefix(keyword, "@"):
+			key := keyword[1:]
+			if pending == nil {
+				pending = &fileRule{enabled: true}
+				annots = map[string]bool{}
+			}
+			if annots[key] {
+				return errorf(n, 1, "duplicate annotation %s", keyword)
+			}
+			annots[key] = true
+			if err := pending.annotate(key, strings.TrimSpace(rest)); err != nil {
+				return errorf(n, len(keyword)+2, "invalid %s: %v", keyword, err)
+			}
+		case keyword == "include":
+			if pending != nil {
+				return errorf(n, 1, "annotations must precede a rule")
+			}
+			included, err := strconv.Unquote(strings.TrimSpace(rest))
+			if err != nil {
+				return errorf(n, len(keyword)+2, "expected file name in double quotes")
+			}
+			at := &FileError{name, n, len(keyword) + 2, nil}
+			if included, err = l.join(name, included); err != nil {
+				at.Err = err
+				return at
+			}
+			if err := l.file(included, at); err != nil {
+				return err
+			}
+		case keyword == "rule":
+			ruleName, expr, ok := strings.Cut(rest, ":=")
+			ruleName = strings.TrimSpace(ruleName)
+			if !ok || !isBareKey(ruleName) {
+				return errorf(n, len(keyword)+2, "expected rule name followed by :=")
+			}
+			if prev, ok := l.byName[ruleName]; ok {
+				return errorf(n, len(keyword)+2, "duplicate rule %q, declared at %s:%d:%d", ruleName, prev.file, prev.line, prev.col)
+			}
+			rule = pending
+			if rule == nil {
+				rule = &fileRule{enabled: true}
+			}
+			pending = nil
+			rule.Name = ruleName
+			offset := len(code) - len(expr)
+			rule.file, rule.line, rule.col = name, n, offset+1
+			l.rules = append(l.rules, rule)
+			l.byName[ruleName] = rule
+			code, quote = stripComment(line[offset:], 0, `"'`)
+			text = append(text, code)
+		default:
+			return errorf(n, 1, "expected rule, include or annotation but have %q", keyword)
+		}
+	}
+	if pending != nil {
+		return errorf(len(lines), 1, "annotations must precede a rule")
+	}
+	return finish()
+}
+
+// annotate sets the annotation key of r to value.
+func (r *fileRule) annotate(key, value string) error {
+	if strings.HasPrefix(value, `"`) {
+		v, err := strconv.Unquote(value)
+		if err != nil {
+			return err
+		}
+		value = v
+	}
+	switch key {
+	case "enabled":
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		r.enabled = enabled
+		return nil
+	case "priority":
+		priority, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		r.Priority = priority
+		return nil
+	case "tags":
+		tags := strings.Split(value, ",")
+		for i := range tags {
+			tags[i] = strings.TrimSpace(tags[i])
+		}
+		value = strings.Join(tags, ",")
+	}
+	if r.Meta == nil {
+		r.Meta = map[string]string{}
+	}
+	r.Meta[key] = value
+	return nil
+}
+
+// stripComment removes a comment from the end of line. Literals are enclosed
+// in the quotes of quotes, and quote is that of a literal left open by a
+// previous line, if any. The quote of a literal left open by line is returned
+// along with it.
+func stripComment(line string, quote rune, quotes string) (string, rune) {
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case strings.ContainsRune(quotes, r):
+			quote = r
+		case r == '#':
+			return line[:i], 0
+		}
+	}
+	return line, quote
+}
@@ -0,0 +1,165 @@
+package exp
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+var ruleFiles = fstest.MapFS{
+	"orders.rules": {Data: []byte(`# Order rules.
+include "common/geo.rules"
+
+@description "Large orders from the EU"
+@owner risk
+@tags orders , eu
+@priority 10
+rule large_eu_order := is_eu # shared with other files
+	&& amount > 1000
+
+	# Refunds are never large.
+	&& type != "refund"
+
+rule vip := name == "# not a comment" || name == "a
+#b"
+`)},
+	"common/geo.rules": {Data: []byte(`include "../orders.rules"
+
+@enabled false
+rule is_eu := country intersects ["DE", "FR", "GR"]
+`)},
+}
+
+func TestLoadRules(t *testing.T) {
+	rules, err := LoadRules(ruleFiles, "orders.rules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 2 {
+		t.Fatalf("LoadRules returned %d rules, want 2", len(rules))
+	}
+	r := rules[0]
+	if r.Name != "large_eu_order" || r.Priority != 10 {
+		t.Errorf("rule = %s with priority %d, want large_eu_order with priority 10", r.Name, r.Priority)
+	}
+	for k, v := range map[string]string{
+		"description": "Large orders from the EU",
+		"owner":       "risk",
+		"tags":        "orders,eu",
+	} {
+		if r.Meta[k] != v {
+			t.Errorf("Meta[%q] = %q, want %q", k, r.Meta[k], v)
+		}
+	}
+	for _, test := range []struct {
+		rule int
+		p    Map
+		want bool
+	}{
+		{0, Map{"country": "GR", "amount": "1200", "type": "order"}, true},
+		{0, Map{"country": "GR", "amount": "1200", "type": "refund"}, false},
+		{0, Map{"country": "US", "amount": "1200", "type": "order"}, false},
+		{1, Map{"name": "# not a comment"}, true},
+		{1, Map{"name": "a\n#b"}, true},
+		{1, Map{"name": "a"}, false},
+	} {
+		if have := rules[test.rule].Exp.Eval(test.p); have != test.want {
+			t.Errorf("%s.Eval(%v) = %t, want %t", rules[test.rule].Name, test.p, have, test.want)
+		}
+	}
+}
+
+func TestLoadRulesErrors(t *testing.T) {
+	for _, test := range []struct {
+		files fstest.MapFS
+		err   string
+	}{
+		{
+			fstest.MapFS{"a.rules": {Data: []byte("rule a := x ==\n\nrule b := x == 1")}},
+			"a.rules:1:15: syntax error: unexpected end of input",
+		},
+		{
+			fstest.MapFS{"a.rules": {Data: []byte("rule a := x == 1\n  && y =~ \"(\"")}},
+			"a.rules:2:12: invalid regular expression: error parsing regexp: missing closing ): `(`",
+		},
+		{
+			fstest.MapFS{"a.rules": {Data: []byte("rule a := b\nrule b := a")}},
+			"a.rules:1:10: exp: rule cycle a -> b -> a",
+		},
+		{
+			fstest.MapFS{"a.rules": {Data: []byte("rule a := b")}},
+			`a.rules:1:11: undefined name "b"`,
+		},
+		{
+			fstest.MapFS{
+				"a.rules": {Data: []byte("include \"b.rules\"\n\nrule a := x == 1")},
+				"b.rules": {Data: []byte("# b\nrule a := x == 2")},
+			},
+			`a.rules:3:6: duplicate rule "a", declared at b.rules:2:10`,
+		},
+		{
+			fstest.MapFS{"a.rules": {Data: []byte("include \"b.rules\"")}},
+			"a.rules:1:9: open b.rules: file does not exist",
+		},
+		{
+			fstest.MapFS{"a.rules": {Data: []byte("include \"../b.rules\"")}},
+			`a.rules:1:9: invalid include "../b.rules"`,
+		},
+		{
+			fstest.MapFS{"a.rules": {Data: []byte("@owner a\n@owner b\nrule a := x == 1")}},
+			"a.rules:2:1: duplicate annotation @owner",
+		},
+		{
+			fstest.MapFS{"a.rules": {Data: []byte("@priority high\nrule a := x == 1")}},
+			`a.rules:1:11: invalid @priority: strconv.Atoi: parsing "high": invalid syntax`,
+		},
+		{
+			fstest.MapFS{"a.rules": {Data: []byte("rule a := x == 1\n@owner a")}},
+			"a.rules:2:1: annotations must precede a rule",
+		},
+		{
+			fstest.MapFS{"a.rules": {Data: []byte("rule a-b := x == 1")}},
+			"a.rules:1:6: expected rule name followed by :=",
+		},
+		{
+			fstest.MapFS{"a.rules": {Data: []byte("let a := x == 1")}},
+			`a.rules:1:1: expected rule, include or annotation but have "let"`,
+		},
+	} {
+		_, err := LoadRules(test.files, "a.rules")
+		var fe *FileError
+		if !errors.As(err, &fe) || err.Error() != test.err {
+			t.Errorf("LoadRules(%v) error = %v, want %s", test.files, err, test.err)
+		}
+	}
+}
+
+func TestLoadRulesLimits(t *testing.T) {
+	files := fstest.MapFS{"a.rules": {Data: []byte("rule a := x == 1\nrule b := !!!x == 1")}}
+	_, err := ParseOptions{MaxDepth: 2}.LoadRules(files, "a.rules")
+	if err == nil || err.Error() != "a.rules:2:12: nesting depth exceeds limit of 2" {
+		t.Errorf("LoadRules error = %v", err)
+	}
+}
+
+func TestParseFile(t *testing.T) {
+	dir := t.TempDir()
+	for name, f := range ruleFiles {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, f.Data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rules, err := ParseFile(filepath.Join(dir, "orders.rules"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 2 || rules[0].Name != "large_eu_order" || rules[1].Name != "vip" {
+		t.Errorf("ParseFile returned %v", rules)
+	}
+}
@@ -0,0 +1,114 @@
+package exp
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/alexkappa/exp/parse"
+)
+
+// ErrCycle is returned by ParseRules for rules which refer to themselves,
+// directly or through other rules.
+var ErrCycle = errors.New("exp: rule cycle")
+
+// RuleError is returned by ParseRules for a rule which fails to parse.
+type RuleError struct {
+	// Rule is the name of the rule.
+	Rule string
+	// Err is the error encountered while parsing the rule.
+	Err error
+}
+
+func (e *RuleError) Error() string {
+	return fmt.Sprintf("rule %s: %v", e.Rule, e.Err)
+}
+
+func (e *RuleError) Unwrap() error {
+	return e.Err
+}
+
+// ParseRules parses a set of named rules in text format. See
+// ParseOptions.ParseRules.
+func ParseRules(rules map[string]string) (map[string]Exp, error) {
+	return ParseOptions{}.ParseRules(rules)
+}
+
+// ParseRules parses a set of named rules in text format, enforcing the limits
+// of o on each of them.
+//
+// Rules may refer to each other by name, in the same way as to the bindings of
+// a let expression, which take precedence over rule names. Each rule is
+// compiled once and shared by the rules referring to it. Rules referring to
+// themselves fail with an error wrapping ErrCycle, and errors are returned as
+// a *RuleError naming the offending rule.
+//
+//	rules, err := exp.ParseRules(map[string]string{
+//		"is_eu":   `country intersects ["DE", "FR", "GR"]`,
+//		"premium": `plan intersects ["pro", "enterprise"]`,
+//		"allow":   `is_eu && premium && seats > 10`,
+//	})
+func (o ParseOptions) ParseRules(rules map[string]string) (map[string]Exp, error) {
+	c := &ruleCompiler{
+		opts:  o,
+		trees: make(map[string]parse.Tree, len(rules)),
+		exps:  make(map[string]Exp, len(rules)),
+	}
+	names := make([]string, 0, len(rules))
+	for name := range rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		t, err := parse.ParseLimits(rules[name], o.limits())
+		if err != nil {
+			return nil, &RuleError{name, err}
+		}
+		c.trees[name] = t
+	}
+	for _, name := range names {
+		if _, _, err := c.resolve(name); err != nil {
+			return nil, err
+		}
+	}
+	return c.exps, nil
+}
+
+// ruleCompiler compiles named rules on demand, as they are referred to.
+type ruleCompiler struct {
+	opts  ParseOptions
+	trees map[string]parse.Tree
+	exps  map[string]Exp
+	path  []string // the rules being compiled, each referring to the next.
+}
+
+// resolve returns the compiled rule name, compiling it if necessary. If there
+// is no such rule, ok is false.
+func (c *ruleCompiler) resolve(name string) (e Exp, ok bool, err error) {
+	if e, ok := c.exps[name]; ok {
+		return e, true, nil
+	}
+	t, ok := c.trees[name]
+	if !ok {
+		return nil, false, nil
+	}
+	for i, n := range c.path {
+		if n == name {
+			cycle := append(append([]string(nil), c.path[i:]...), name)
+			return nil, true, &RuleError{name, fmt.Errorf("%w %s", ErrCycle, strings.Join(cycle, " -> "))}
+		}
+	}
+	c.path = append(c.path, name)
+	e, err = c.opts.compile(t, &scope{rules: c.resolve})
+	c.path = c.path[:len(c.path)-1]
+	if err != nil {
+		var re *RuleError
+		if errors.As(err, &re) {
+			return nil, true, err
+		}
+		return nil, true, &RuleError{name, err}
+	}
+	c.exps[name] = e
+	return e, true, nil
+}
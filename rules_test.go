@@ -0,0 +1,69 @@
+package exp
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules(map[string]string{
+		"is_eu":   `country intersects ["DE", "FR", "GR"]`,
+		"premium": `plan intersects ["pro", "enterprise"]`,
+		"allow":   `is_eu && premium && seats > 10`,
+		"deny":    `!allow || let is_eu = country == "FR" in is_eu`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		rule string
+		p    Map
+		want bool
+	}{
+		{"allow", Map{"country": "GR", "plan": "pro", "seats": "11"}, true},
+		{"allow", Map{"country": "US", "plan": "pro", "seats": "11"}, false},
+		{"deny", Map{"country": "GR", "plan": "pro", "seats": "11"}, false},
+		{"deny", Map{"country": "FR", "plan": "pro", "seats": "11"}, true},
+		{"deny", Map{"country": "DE", "plan": "free", "seats": "11"}, true},
+	} {
+		if have := rules[test.rule].Eval(test.p); have != test.want {
+			t.Errorf("%s.Eval(%v) = %t, want %t", test.rule, test.p, have, test.want)
+		}
+	}
+	// Rules are shared by the rules referring to them.
+	if have := Inspect(rules["allow"]).Elems[0]; sprintf("%s", have) != sprintf("%s", rules["is_eu"]) {
+		t.Errorf("allow refers to %s, want %s", have, rules["is_eu"])
+	}
+}
+
+func TestParseRulesErrors(t *testing.T) {
+	for _, test := range []struct {
+		rules map[string]string
+		err   string
+		cycle bool
+	}{
+		{map[string]string{"a": `a`}, "rule a: exp: rule cycle a -> a", true},
+		{map[string]string{"a": `b && x == 1`, "b": `c || y == 1`, "c": `!a`}, "rule a: exp: rule cycle a -> b -> c -> a", true},
+		{map[string]string{"a": `b`, "b": `c`}, `rule b: undefined name "c" at line 1 col 1`, false},
+		{map[string]string{"a": `x ==`}, "rule a: 1:5 syntax error: unexpected end of input", false},
+		{map[string]string{"a": `let b = b in b`, "b": `x == 1`}, "", false},
+	} {
+		_, err := ParseRules(test.rules)
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("ParseRules(%v) = %v", test.rules, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != test.err {
+			t.Errorf("ParseRules(%v) error = %v, want %s", test.rules, err, test.err)
+		}
+		var re *RuleError
+		if !errors.As(err, &re) {
+			t.Errorf("ParseRules(%v) error = %v, want *RuleError", test.rules, err)
+		}
+		if errors.Is(err, ErrCycle) != test.cycle {
+			t.Errorf("errors.Is(%v, ErrCycle) = %t", err, !test.cycle)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package exp
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Rule is a named expression held by a RuleSet.
+type Rule struct {
+	// Name uniquely identifies the rule within a RuleSet.
+	Name string
+	// Exp is the expression the rule evaluates.
+	Exp Exp
+	// Priority orders rules for RuleSet.Best. Higher priorities come first.
+	Priority int
+	// Meta holds arbitrary data attached to the rule, such as an owner or a
+	// description.
+	Meta map[string]string
+}
+
+// RuleSet evaluates many rules against the same Params. All rules are compiled
+// together, so each key is fetched and parsed at most once per evaluation even
+// if it is read by many rules. A RuleSet is immutable and safe for concurrent
+// use.
+type RuleSet struct {
+	rules  []Rule
+	roots  []func(*frame) bool
+	byName map[string]int
+	// byPriority holds rule indexes sorted by descending priority, ties broken
+	// by the order the rules were added.
+	byPriority []int
+	keys       []string
+	slots      map[string]int
+	frames     *framePool
+}
+
+// NewRuleSet compiles rules into a RuleSet. An error is returned if two rules
+// share a name or a rule has no expression.
+func NewRuleSet(rules ...Rule) (*RuleSet, error) {
+	rs := &RuleSet{
+		rules:      append([]Rule(nil), rules...),
+		roots:      make([]func(*frame) bool, len(rules)),
+		byName:     make(map[string]int, len(rules)),
+		byPriority: make([]int, len(rules)),
+	}
+	c := newCompiler()
+	for i, r := range rs.rules {
+		if r.Exp == nil {
+			return nil, fmt.Errorf("rule %q has no expression", r.Name)
+		}
+		if _, ok := rs.byName[r.Name]; ok {
+			return nil, fmt.Errorf("duplicate rule %q", r.Name)
+		}
+		rs.byName[r.Name] = i
+		rs.roots[i] = c.compile(r.Exp)
+		rs.byPriority[i] = i
+	}
+	sort.SliceStable(rs.byPriority, func(i, j int) bool {
+		return rs.rules[rs.byPriority[i]].Priority > rs.rules[rs.byPriority[j]].Priority
+	})
+	rs.keys = c.keys
+	rs.slots = c.index
+	rs.frames = newFramePool(c.keys)
+	return rs, nil
+}
+
+// Len returns the number of rules in the set.
+func (rs *RuleSet) Len() int {
+	return len(rs.rules)
+}
+
+// Rules returns the rules of the set in the order they were added.
+func (rs *RuleSet) Rules() []Rule {
+	return append([]Rule(nil), rs.rules...)
+}
+
+// Rule returns the rule with the given name.
+func (rs *RuleSet) Rule(name string) (Rule, bool) {
+	i, ok := rs.byName[name]
+	if !ok {
+		return Rule{}, false
+	}
+	return rs.rules[i], true
+}
+
+// Keys returns the distinct keys read by the rules of the set.
+func (rs *RuleSet) Keys() []string {
+	return append([]string(nil), rs.keys...)
+}
+
+// First returns the first rule, in the order they were added, which evaluates
+// to true against p.
+func (rs *RuleSet) First(p Params) (Rule, bool) {
+	f := rs.frames.get(p)
+	defer rs.frames.put(f)
+	for i, root := range rs.roots {
+		if root(f) {
+			return rs.rules[i], true
+		}
+	}
+	return Rule{}, false
+}
+
+// Best returns the rule with the highest priority which evaluates to true
+// against p. If several such rules share the highest priority, the one added
+// first is returned.
+func (rs *RuleSet) Best(p Params) (Rule, bool) {
+	f := rs.frames.get(p)
+	defer rs.frames.put(f)
+	for _, i := range rs.byPriority {
+		if rs.roots[i](f) {
+			return rs.rules[i], true
+		}
+	}
+	return Rule{}, false
+}
+
+// All returns every rule which evaluates to true against p, in the order they
+// were added.
+func (rs *RuleSet) All(p Params) []Rule {
+	f := rs.frames.get(p)
+	defer rs.frames.put(f)
+	var matches []Rule
+	for i, root := range rs.roots {
+		if root(f) {
+			matches = append(matches, rs.rules[i])
+		}
+	}
+	return matches
+}
@@ -0,0 +1,87 @@
+package exp
+
+import (
+	"fmt"
+	"testing"
+)
+
+func newTestRuleSet(t testing.TB) *RuleSet {
+	rs, err := NewRuleSet(
+		Rule{Name: "small", Exp: Lt("amount", 100), Priority: 1},
+		Rule{Name: "greek", Exp: Match("country", "GR"), Priority: 5, Meta: map[string]string{"owner": "ops"}},
+		Rule{Name: "large", Exp: Gte("amount", 100), Priority: 10},
+		Rule{Name: "greek-small", Exp: And(Match("country", "GR"), Lt("amount", 100)), Priority: 5},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rs
+}
+
+func names(rules []Rule) []string {
+	s := make([]string, len(rules))
+	for i, r := range rules {
+		s[i] = r.Name
+	}
+	return s
+}
+
+func TestRuleSet(t *testing.T) {
+	rs := newTestRuleSet(t)
+
+	for _, test := range []struct {
+		params Params
+		first  string
+		best   string
+		all    string
+	}{
+		{Map{"amount": "50", "country": "GR"}, "small", "greek", "[small greek greek-small]"},
+		{Map{"amount": "500", "country": "GR"}, "greek", "large", "[greek large]"},
+		{Map{"amount": "500", "country": "CY"}, "large", "large", "[large]"},
+		{Map{"amount": "x", "country": "CY"}, "", "", "[]"},
+	} {
+		first, _ := rs.First(test.params)
+		best, _ := rs.Best(test.params)
+		all := fmt.Sprint(names(rs.All(test.params)))
+		if first.Name != test.first || best.Name != test.best || all != test.all {
+			t.Errorf("%v: first=%q best=%q all=%s, want first=%q best=%q all=%s",
+				test.params, first.Name, best.Name, all, test.first, test.best, test.all)
+		}
+	}
+}
+
+func TestRuleSetLookup(t *testing.T) {
+	rs := newTestRuleSet(t)
+	if rs.Len() != 4 {
+		t.Errorf("unexpected length %d", rs.Len())
+	}
+	if r, ok := rs.Rule("greek"); !ok || r.Meta["owner"] != "ops" {
+		t.Errorf("unexpected rule %+v", r)
+	}
+	if _, ok := rs.Rule("missing"); ok {
+		t.Error("unexpected rule")
+	}
+	if keys := fmt.Sprint(rs.Keys()); keys != "[amount country]" {
+		t.Errorf("unexpected keys %s", keys)
+	}
+}
+
+func TestRuleSetSharedLookups(t *testing.T) {
+	rs := newTestRuleSet(t)
+	p := &countingParams{Map: Map{"amount": "50", "country": "GR"}, gets: map[string]int{}}
+	rs.All(p)
+	for key, n := range p.gets {
+		if n != 1 {
+			t.Errorf("%s was fetched %d times", key, n)
+		}
+	}
+}
+
+func TestRuleSetErrors(t *testing.T) {
+	if _, err := NewRuleSet(Rule{Name: "a", Exp: True}, Rule{Name: "a", Exp: False}); err == nil {
+		t.Error("expected error for duplicate rule")
+	}
+	if _, err := NewRuleSet(Rule{Name: "a"}); err == nil {
+		t.Error("expected error for missing expression")
+	}
+}
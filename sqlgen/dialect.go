@@ -0,0 +1,90 @@
+package sqlgen
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Dialect describes the parts of SQL which differ between database engines.
+type Dialect interface {
+	// Placeholder returns the bind parameter for the n'th argument, counting
+	// from 1.
+	Placeholder(n int) string
+
+	// Quote quotes an identifier so it can safely be used as a column name.
+	Quote(ident string) string
+
+	// Contains returns a predicate which is true if the text stored in col
+	// contains the string bound to placeholder. The comparison must be case
+	// sensitive, as exp.Contains is.
+	Contains(col, placeholder string) string
+
+	// Extract returns an integer expression extracting field, which is one
+	// of "year" or "month", from the date stored in col.
+	Extract(field, col string) (string, error)
+
+	// ContainsIP returns a predicate which is true if the address stored in
+	// col falls within the network bound to placeholder.
+	ContainsIP(col, placeholder string) (string, error)
+}
+
+type postgres struct{}
+
+func (postgres) Placeholder(n int) string {
+	return "$" + strconv.Itoa(n)
+}
+
+func (postgres) Quote(ident string) string {
+	return `"` + strings.ReplaceAll(ident, `"`, `""`) + `"`
+}
+
+func (postgres) Contains(col, placeholder string) string {
+	return fmt.Sprintf("strpos(%s, %s) > 0", col, placeholder)
+}
+
+func (postgres) Extract(field, col string) (string, error) {
+	return fmt.Sprintf("EXTRACT(%s FROM %s)", strings.ToUpper(field), col), nil
+}
+
+func (postgres) ContainsIP(col, placeholder string) (string, error) {
+	return fmt.Sprintf("%s::inet <<= %s::cidr", col, placeholder), nil
+}
+
+type sqlite struct{}
+
+func (sqlite) Placeholder(n int) string {
+	return "?"
+}
+
+func (sqlite) Quote(ident string) string {
+	return `"` + strings.ReplaceAll(ident, `"`, `""`) + `"`
+}
+
+// Contains uses instr rather than LIKE, which ignores the case of ASCII
+// letters in SQLite.
+func (sqlite) Contains(col, placeholder string) string {
+	return fmt.Sprintf("instr(%s, %s) > 0", col, placeholder)
+}
+
+func (sqlite) Extract(field, col string) (string, error) {
+	switch field {
+	case "year":
+		return fmt.Sprintf("CAST(strftime('%%Y', %s) AS INTEGER)", col), nil
+	case "month":
+		return fmt.Sprintf("CAST(strftime('%%m', %s) AS INTEGER)", col), nil
+	}
+	return "", fmt.Errorf("%w: extract %s", ErrUnsupported, field)
+}
+
+func (sqlite) ContainsIP(col, placeholder string) (string, error) {
+	return "", fmt.Errorf("%w: sqlite has no network type", ErrUnsupported)
+}
+
+var (
+	// Postgres is the dialect of PostgreSQL. It uses numbered placeholders and
+	// the inet and cidr types for network comparisons.
+	Postgres Dialect = postgres{}
+	// SQLite is the dialect of SQLite. It does not support ContainsIP.
+	SQLite Dialect = sqlite{}
+)
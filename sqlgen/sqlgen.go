@@ -0,0 +1,188 @@
+// Package sqlgen translates expressions into parameterized SQL WHERE clauses so
+// that the same rules evaluated in memory can also be used to query a table.
+//
+//	w, args, err := sqlgen.Where(exp.And(
+//		exp.Match("country", "GR"),
+//		exp.GreaterThan("amount", 100),
+//	), sqlgen.Postgres)
+//
+//	// w:    ("country" = $1 AND "amount" > $2)
+//	// args: ["GR", 100]
+//
+// Expressions which are evaluated on the string representation of a value in
+// Go are evaluated on the column type in SQL. Numeric expressions should
+// therefore target numeric columns and date expressions date columns. Note that
+// unlike their Go counterparts, negated SQL predicates evaluate to false when a
+// column is NULL.
+package sqlgen
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/alexkappa/exp"
+	"github.com/alexkappa/exp/internal/shape"
+)
+
+// ErrUnsupported is returned for expressions which have no SQL equivalent.
+var ErrUnsupported = errors.New("sqlgen: unsupported expression")
+
+// Generator generates WHERE clauses for a specific dialect.
+type Generator struct {
+	// Dialect used to generate SQL. If nil, Postgres is used.
+	Dialect Dialect
+
+	// Column maps an expression key to a column expression. If nil, keys are
+	// quoted using the dialect and used as column names. An error may be
+	// returned to reject unknown keys.
+	Column func(key string) (string, error)
+}
+
+// Where returns a WHERE clause equivalent to e, without the WHERE keyword,
+// along with the arguments bound to its placeholders.
+func (g *Generator) Where(e exp.Exp) (string, []any, error) {
+	b := &builder{Generator: g, dialect: g.Dialect}
+	if b.dialect == nil {
+		b.dialect = Postgres
+	}
+	if err := b.build(e); err != nil {
+		return "", nil, err
+	}
+	return b.String(), b.args, nil
+}
+
+// Where is a shorthand for a Generator using dialect d and default column
+// names.
+func Where(e exp.Exp, d Dialect) (string, []any, error) {
+	return (&Generator{Dialect: d}).Where(e)
+}
+
+type builder struct {
+	*Generator
+	strings.Builder
+	dialect Dialect
+	args    []any
+}
+
+// bind adds v to the argument list and returns its placeholder.
+func (b *builder) bind(v any) string {
+	b.args = append(b.args, v)
+	return b.dialect.Placeholder(len(b.args))
+}
+
+func (b *builder) column(key string) (string, error) {
+	if b.Column != nil {
+		return b.Column(key)
+	}
+	return b.dialect.Quote(key), nil
+}
+
+func (b *builder) build(e exp.Exp) error {
+	n := exp.Inspect(e)
+	switch n.Op {
+	case exp.OpBool:
+		if n.Value.(bool) {
+			b.WriteString("1=1")
+		} else {
+			b.WriteString("1=0")
+		}
+		return nil
+	case exp.OpAnd:
+		return b.join(n.Elems, " AND ", "1=1")
+	case exp.OpOr:
+		if key, values, ok := shape.MatchAny(n); ok {
+			return b.in(key, values)
+		}
+		return b.join(n.Elems, " OR ", "1=0")
+	case exp.OpNot:
+		b.WriteString("NOT (")
+		if err := b.build(n.Elems[0]); err != nil {
+			return err
+		}
+		b.WriteByte(')')
+		return nil
+	}
+
+	col, err := b.column(n.Key)
+	if err != nil {
+		return err
+	}
+
+	switch n.Op {
+	case exp.OpMatch:
+		fmt.Fprintf(b, "%s = %s", col, b.bind(n.Value))
+	case exp.OpContains:
+		b.WriteString(b.dialect.Contains(col, b.bind(n.Value.(string))))
+	case exp.OpContainsRune:
+		b.WriteString(b.dialect.Contains(col, b.bind(string(n.Value.(rune)))))
+	case exp.OpEq:
+		fmt.Fprintf(b, "%s = %s", col, b.bind(n.Value))
+	case exp.OpGt:
+		fmt.Fprintf(b, "%s > %s", col, b.bind(n.Value))
+	case exp.OpLt:
+		fmt.Fprintf(b, "%s < %s", col, b.bind(n.Value))
+	case exp.OpOn:
+		fmt.Fprintf(b, "%s = %s", col, b.bind(n.Value.(time.Time)))
+	case exp.OpBefore:
+		fmt.Fprintf(b, "%s < %s", col, b.bind(n.Value.(time.Time)))
+	case exp.OpAfter:
+		fmt.Fprintf(b, "%s > %s", col, b.bind(n.Value.(time.Time)))
+	case exp.OpYear:
+		x, err := b.dialect.Extract("year", col)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(b, "%s = %s", x, b.bind(n.N))
+	case exp.OpMonth:
+		x, err := b.dialect.Extract("month", col)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(b, "%s = %s", x, b.bind(int(n.Value.(time.Month))))
+	case exp.OpContainsIP:
+		x, err := b.dialect.ContainsIP(col, b.bind(n.Value.(*net.IPNet).String()))
+		if err != nil {
+			return err
+		}
+		b.WriteString(x)
+	default:
+		return fmt.Errorf("%w %s", ErrUnsupported, e)
+	}
+	return nil
+}
+
+// join writes elems separated by sep and enclosed in parentheses. If elems is
+// empty, empty is written instead.
+func (b *builder) join(elems []exp.Exp, sep, empty string) error {
+	if len(elems) == 0 {
+		b.WriteString(empty)
+		return nil
+	}
+	b.WriteByte('(')
+	for i, elem := range elems {
+		if i > 0 {
+			b.WriteString(sep)
+		}
+		if err := b.build(elem); err != nil {
+			return err
+		}
+	}
+	b.WriteByte(')')
+	return nil
+}
+
+func (b *builder) in(key string, values []string) error {
+	col, err := b.column(key)
+	if err != nil {
+		return err
+	}
+	placeholders := make([]string, len(values))
+	for i, v := range values {
+		placeholders[i] = b.bind(v)
+	}
+	fmt.Fprintf(b, "%s IN (%s)", col, strings.Join(placeholders, ", "))
+	return nil
+}
@@ -0,0 +1,121 @@
+package sqlgen
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alexkappa/exp"
+)
+
+func TestWhere(t *testing.T) {
+	_, cidr, _ := net.ParseCIDR("10.0.0.0/8")
+	date := time.Date(2014, time.December, 15, 0, 0, 0, 0, time.UTC)
+
+	for _, test := range []struct {
+		exp  exp.Exp
+		sql  string
+		args []any
+	}{
+		{exp.True, `1=1`, nil},
+		{exp.And(), `1=1`, nil},
+		{exp.Or(), `1=0`, nil},
+		{exp.Match("foo", "bar"), `"foo" = $1`, []any{"bar"}},
+		{exp.Not(exp.Match("foo", "bar")), `NOT ("foo" = $1)`, []any{"bar"}},
+		{exp.MatchAny("foo", "a", "b"), `"foo" IN ($1, $2)`, []any{"a", "b"}},
+		{exp.Contains("foo", "50%_"), `strpos("foo", $1) > 0`, []any{"50%_"}},
+		{exp.ContainsRune("foo", 'x'), `strpos("foo", $1) > 0`, []any{"x"}},
+		{exp.Gte("foo", 1), `("foo" > $1 OR "foo" = $2)`, []any{1.0, 1.0}},
+		{exp.Lt("foo", 1), `"foo" < $1`, []any{1.0}},
+		{exp.Before("foo", date), `"foo" < $1`, []any{date}},
+		{exp.After("foo", date), `"foo" > $1`, []any{date}},
+		{exp.Year("foo", 2014), `EXTRACT(YEAR FROM "foo") = $1`, []any{2014}},
+		{exp.Month("foo", time.May), `EXTRACT(MONTH FROM "foo") = $1`, []any{5}},
+		{exp.ContainsIP("ip", cidr), `"ip"::inet <<= $1::cidr`, []any{"10.0.0.0/8"}},
+		{
+			exp.Or(exp.And(exp.Match("a", "x"), exp.Gt("b", 2)), exp.Not(exp.Eq("c", 3))),
+			`(("a" = $1 AND "b" > $2) OR NOT ("c" = $3))`,
+			[]any{"x", 2.0, 3.0},
+		},
+	} {
+		sql, args, err := Where(test.exp, Postgres)
+		if err != nil {
+			t.Errorf("%s: %s", test.exp, err)
+			continue
+		}
+		if sql != test.sql {
+			t.Errorf("unexpected sql.\n\twant: %s\n\thave: %s", test.sql, sql)
+		}
+		if !reflect.DeepEqual(args, test.args) {
+			t.Errorf("unexpected args.\n\twant: %v\n\thave: %v", test.args, args)
+		}
+	}
+}
+
+func TestWhereSQLite(t *testing.T) {
+	sql, args, err := Where(exp.And(exp.Year("d", 2020), exp.Match("e", "x")), SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `(CAST(strftime('%Y', "d") AS INTEGER) = ? AND "e" = ?)`; sql != want {
+		t.Errorf("unexpected sql.\n\twant: %s\n\thave: %s", want, sql)
+	}
+	if len(args) != 2 {
+		t.Errorf("unexpected args %v", args)
+	}
+
+	// LIKE ignores case in SQLite, unlike exp.Contains.
+	sql, args, err = Where(exp.Contains("name", "Ab"), SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `instr("name", ?) > 0`; sql != want {
+		t.Errorf("unexpected sql.\n\twant: %s\n\thave: %s", want, sql)
+	}
+	if !reflect.DeepEqual(args, []any{"Ab"}) {
+		t.Errorf("unexpected args %v", args)
+	}
+}
+
+func TestWhereColumn(t *testing.T) {
+	g := &Generator{
+		Column: func(key string) (string, error) {
+			switch key {
+			case "country":
+				return "u.country_code", nil
+			}
+			return "", fmt.Errorf("unknown key %q", key)
+		},
+	}
+	sql, _, err := g.Where(exp.Match("country", "GR"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `u.country_code = $1`; sql != want {
+		t.Errorf("unexpected sql.\n\twant: %s\n\thave: %s", want, sql)
+	}
+	if _, _, err := g.Where(exp.Match("secret", "x")); err == nil {
+		t.Error("expected error for unknown key")
+	}
+}
+
+func TestWhereUnsupported(t *testing.T) {
+	_, cidr, _ := net.ParseCIDR("10.0.0.0/8")
+
+	for _, test := range []struct {
+		exp     exp.Exp
+		dialect Dialect
+	}{
+		{exp.Count("foo", "a", 1), Postgres},
+		{exp.Weekday("foo", time.Monday), Postgres},
+		{exp.And(exp.True, exp.Len("foo", 1)), Postgres},
+		{exp.ContainsIP("ip", cidr), SQLite},
+	} {
+		if _, _, err := Where(test.exp, test.dialect); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("%s: expected ErrUnsupported, have %v", test.exp, err)
+		}
+	}
+}
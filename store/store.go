@@ -0,0 +1,229 @@
+// Package store keeps rules loaded from rule files up to date, so that rule
+// changes are picked up without restarting the service evaluating them.
+//
+//	d, err := store.Open("/etc/rules")
+//	if err != nil {
+//		// handle error
+//	}
+//	defer d.Close()
+//
+//	if rule, ok := d.RuleSet().First(p); ok {
+//		// act on rule
+//	}
+//
+// Rule files are written in the format read by exp.ParseFile.
+package store
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alexkappa/exp"
+)
+
+// Option configures a Dir.
+type Option func(*Dir)
+
+// Interval configures how often the directory is checked for changes. The
+// default is every second. If d is zero or negative, the directory is only
+// checked by calling Reload.
+func Interval(d time.Duration) Option {
+	return func(dir *Dir) {
+		dir.interval = d
+	}
+}
+
+// Pattern configures the names of the rule files loaded from the directory, as
+// matched by path.Match. The default pattern is "*.rules".
+func Pattern(pattern string) Option {
+	return func(dir *Dir) {
+		dir.pattern = pattern
+	}
+}
+
+// ParseOptions configures the limits enforced on each rule.
+func ParseOptions(opts exp.ParseOptions) Option {
+	return func(dir *Dir) {
+		dir.opts = opts
+	}
+}
+
+// OnReload configures a function called after every reload following a
+// change, with the error encountered, if any. It is called from the
+// goroutine polling the directory or calling Reload.
+func OnReload(f func(error)) Option {
+	return func(dir *Dir) {
+		dir.onReload = f
+	}
+}
+
+// Dir holds the rules of the rule files in a directory, which it polls for
+// changes. A Dir is safe for concurrent use.
+//
+// Rule files are the files in the directory whose names match the pattern,
+// loaded in lexical order. They may include files from subdirectories, which
+// are also watched. When any file changes, all rule files are loaded and
+// compiled again, and the rules are replaced only if all of them compile. The
+// rules in use are never left half updated.
+type Dir struct {
+	fsys     fs.FS
+	interval time.Duration
+	pattern  string
+	opts     exp.ParseOptions
+	onReload func(error)
+
+	set atomic.Value // *exp.RuleSet, the rules in use.
+
+	mu    sync.Mutex // guards reloads and the fields below.
+	files map[string]fileInfo
+	err   error
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// fileInfo is what is compared to tell whether a file changed.
+type fileInfo struct {
+	modTime time.Time
+	size    int64
+}
+
+// Open loads the rule files in dir and starts polling it for changes until
+// Close is called. An error is returned if the rules fail to load.
+func Open(dir string, opts ...Option) (*Dir, error) {
+	d := &Dir{
+		fsys:     os.DirFS(dir),
+		interval: time.Second,
+		pattern:  "*.rules",
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	if _, err := d.Reload(); err != nil {
+		return nil, err
+	}
+	if d.interval > 0 {
+		go d.poll()
+	} else {
+		close(d.done)
+	}
+	return d, nil
+}
+
+// RuleSet returns the rules in use. It does not block, even while rules are
+// being reloaded, so the returned RuleSet may be replaced at any time. Callers
+// should keep using the same RuleSet for the duration of a request.
+func (d *Dir) RuleSet() *exp.RuleSet {
+	return d.set.Load().(*exp.RuleSet)
+}
+
+// Err returns the error encountered by the last reload, or nil if it
+// succeeded. While the files fail to load, the rules loaded last are kept in
+// use.
+func (d *Dir) Err() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.err
+}
+
+// Reload checks the directory for changes and, if any file was added, removed
+// or modified since the last check, loads the rules again. It reports whether
+// the rules in use were replaced, along with the error encountered, if any.
+func (d *Dir) Reload() (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	files, names, err := d.scan()
+	if err == nil && d.files != nil && sameFiles(files, d.files) {
+		return false, nil
+	}
+	if err == nil {
+		d.files = files
+		err = d.load(names)
+	}
+	d.err = err
+	if d.onReload != nil {
+		d.onReload(err)
+	}
+	return err == nil, err
+}
+
+// Close stops polling the directory. The rules in use remain available.
+func (d *Dir) Close() error {
+	d.once.Do(func() {
+		close(d.stop)
+	})
+	<-d.done
+	return nil
+}
+
+func (d *Dir) poll() {
+	defer close(d.done)
+	t := time.NewTicker(d.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			d.Reload()
+		case <-d.stop:
+			return
+		}
+	}
+}
+
+// scan returns every file in the directory and its subdirectories, as well as
+// the names of the rule files in lexical order.
+func (d *Dir) scan() (map[string]fileInfo, []string, error) {
+	files := map[string]fileInfo{}
+	var names []string
+	err := fs.WalkDir(d.fsys, ".", func(name string, e fs.DirEntry, err error) error {
+		if err != nil || e.IsDir() {
+			return err
+		}
+		info, err := e.Info()
+		if err != nil {
+			return err
+		}
+		files[name] = fileInfo{info.ModTime(), info.Size()}
+		if ok, _ := path.Match(d.pattern, name); ok {
+			names = append(names, name)
+		}
+		return nil
+	})
+	sort.Strings(names)
+	return files, names, err
+}
+
+// load loads the rule files names and replaces the rules in use.
+func (d *Dir) load(names []string) error {
+	rules, err := d.opts.LoadRules(d.fsys, names...)
+	if err != nil {
+		return err
+	}
+	set, err := exp.NewRuleSet(rules...)
+	if err != nil {
+		return err
+	}
+	d.set.Store(set)
+	return nil
+}
+
+func sameFiles(a, b map[string]fileInfo) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, fa := range a {
+		fb, ok := b[name]
+		if !ok || !fa.modTime.Equal(fb.modTime) || fa.size != fb.size {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,160 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alexkappa/exp"
+)
+
+// write writes the file name in dir, making sure its modification time
+// differs from that of any previous version.
+func write(t *testing.T, dir, name, data string) {
+	t.Helper()
+	name = filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	var mtime time.Time
+	if info, err := os.Stat(name); err == nil {
+		mtime = info.ModTime()
+	}
+	if err := os.WriteFile(name, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if mtime.IsZero() {
+		return
+	}
+	mtime = mtime.Add(time.Second)
+	if err := os.Chtimes(name, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func names(rs *exp.RuleSet) string {
+	var s []string
+	for _, r := range rs.Rules() {
+		s = append(s, r.Name)
+	}
+	return strings.Join(s, ",")
+}
+
+func TestDir(t *testing.T) {
+	dir := t.TempDir()
+	write(t, dir, "a.rules", `include "common/geo.rules"
+rule a := is_eu && x == 1`)
+	write(t, dir, "b.rules", `rule b := x == 2`)
+	write(t, dir, "common/geo.rules", `rule is_eu := country == "GR"`)
+	write(t, dir, "README", `not a rule file`)
+
+	d, err := Open(dir, Interval(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if have := names(d.RuleSet()); have != "is_eu,a,b" {
+		t.Fatalf("rules = %s, want is_eu,a,b", have)
+	}
+
+	if ok, err := d.Reload(); ok || err != nil {
+		t.Errorf("Reload() = %t, %v without changes", ok, err)
+	}
+
+	// A broken file keeps the rules in use.
+	before := d.RuleSet()
+	write(t, dir, "b.rules", `rule b := x ==`)
+	if ok, err := d.Reload(); ok || err == nil || !strings.HasPrefix(err.Error(), "b.rules:1:15: ") {
+		t.Errorf("Reload() = %t, %v with a broken file", ok, err)
+	}
+	if d.RuleSet() != before {
+		t.Error("rules replaced with a broken file")
+	}
+	if d.Err() == nil {
+		t.Error("Err() = nil with a broken file")
+	}
+
+	// Changes to included files are picked up.
+	write(t, dir, "b.rules", `rule b := x == 2`)
+	write(t, dir, "common/geo.rules", `rule is_eu := country == "FR"`)
+	if ok, err := d.Reload(); !ok || err != nil {
+		t.Errorf("Reload() = %t, %v after fixing the file", ok, err)
+	}
+	if d.Err() != nil {
+		t.Errorf("Err() = %v after fixing the file", d.Err())
+	}
+	if rule, ok := d.RuleSet().First(exp.Map{"country": "FR", "x": "1"}); !ok || rule.Name != "is_eu" {
+		t.Errorf("First() = %s, %t", rule.Name, ok)
+	}
+
+	// Removed files are picked up.
+	if err := os.Remove(filepath.Join(dir, "b.rules")); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := d.Reload(); !ok || err != nil {
+		t.Errorf("Reload() = %t, %v after removing a file", ok, err)
+	}
+	if have := names(d.RuleSet()); have != "is_eu,a" {
+		t.Errorf("rules = %s, want is_eu,a", have)
+	}
+}
+
+func TestDirOpenError(t *testing.T) {
+	dir := t.TempDir()
+	write(t, dir, "a.rules", `rule a := b`)
+	if _, err := Open(dir); err == nil {
+		t.Error("Open() succeeded with a broken file")
+	}
+}
+
+func TestDirPoll(t *testing.T) {
+	dir := t.TempDir()
+	write(t, dir, "a.rules", `rule a := x == 1`)
+	reloads := make(chan error, 1)
+	d, err := Open(dir, Interval(time.Millisecond), OnReload(func(err error) {
+		select {
+		case reloads <- err:
+		default:
+		}
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	<-reloads
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					d.RuleSet().All(exp.Map{"x": "1"})
+				}
+			}
+		}()
+	}
+
+	write(t, dir, "b.rules", `rule b := x == 1`)
+	timeout := time.After(5 * time.Second)
+	for names(d.RuleSet()) != "a,b" {
+		select {
+		case <-reloads:
+		case <-timeout:
+			t.Fatal("change not picked up")
+		}
+	}
+	close(stop)
+	wg.Wait()
+	if err := d.Close(); err != nil {
+		t.Error(err)
+	}
+}
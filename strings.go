@@ -1,6 +1,9 @@
 package exp
 
-import "strings"
+import (
+	"regexp"
+	"strings"
+)
 
 // Match
 
@@ -178,3 +181,21 @@ func (e expEqualFold) String() string {
 func EqualFold(key, s string) Exp {
 	return expEqualFold{key, s}
 }
+
+// Regexp
+
+// expRegexp evaluates to true if the value pointed to by key matches re. It
+// is only built by Parse, from the =~ operator, which enforces
+// MaxRegexComplexity.
+type expRegexp struct {
+	key string
+	re  *regexp.Regexp
+}
+
+func (e expRegexp) Eval(p Params) bool {
+	return e.re.MatchString(p.Get(e.key))
+}
+
+func (e expRegexp) String() string {
+	return sprintf("[%s=~%s]", e.key, e.re)
+}
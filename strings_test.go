@@ -1,6 +1,9 @@
 package exp
 
-import "testing"
+import (
+	"regexp"
+	"testing"
+)
 
 var m = Map{
 	"foo": "bar",
@@ -109,3 +112,18 @@ func TestEqualFold(t *testing.T) {
 		}
 	}
 }
+
+func TestRegexp(t *testing.T) {
+	for key, pattern := range map[string]string{
+		"foo": "^b.r$",
+		"bar": "a",
+		"baz": "(oo|aa)yah",
+	} {
+		if !(expRegexp{key, regexp.MustCompile(pattern)}).Eval(m) {
+			t.Errorf("Regexp(%q, %q) should evaluate to true", key, pattern)
+		}
+	}
+	if (expRegexp{"foo", regexp.MustCompile("^a")}).Eval(m) {
+		t.Error("Regexp(\"foo\", \"^a\") should evaluate to false")
+	}
+}
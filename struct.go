@@ -0,0 +1,255 @@
+package exp
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Struct returns Params reading the exported fields of v, which must be a
+// struct or a pointer to one.
+//
+// A field is found by the name given in its exp tag, or failing that its json
+// tag, or failing that its name. Fields tagged "-" are ignored and the fields
+// of embedded structs are promoted, as with encoding/json. Fields of nested
+// structs and maps with string keys are found by joining the names with dots,
+// as in "customer.country".
+//
+// Numbers and booleans are formatted with the strconv package so that numeric
+// expressions can read them, and time.Time values using the format set by
+// DateFormat. Other values are formatted by their String or MarshalText
+// methods if they have one, or by fmt.Sprint otherwise. Missing fields and nil
+// pointers read as an empty string. The Params returned implement MultiParams,
+// reading each element of a slice or array field as a separate value.
+//
+//	type Order struct {
+//		Amount  float64 `json:"amount"`
+//		Country string  `exp:"country"`
+//	}
+//	Gt("amount", 100).Eval(Struct(Order{Amount: 150})) // true
+//
+// The fields of each type are looked up once and cached, so Struct is cheap to
+// call for every value being evaluated.
+func Struct(v any) Params {
+	return structParams{reflect.ValueOf(v)}
+}
+
+type structParams struct {
+	v reflect.Value
+}
+
+// Get returns the formatted value of the field pointed to by key.
+func (s structParams) Get(key string) string {
+	v, ok := lookupField(s.v, key)
+	if !ok {
+		return ""
+	}
+	return formatField(v)
+}
+
+// GetAll returns the formatted elements of the slice or array field pointed
+// to by key, or the formatted field if it is neither.
+func (s structParams) GetAll(key string) []string {
+	v, ok := lookupField(s.v, key)
+	if !ok {
+		return nil
+	}
+	v = indirect(v)
+	if !v.IsValid() {
+		return nil
+	}
+	if (v.Kind() != reflect.Slice && v.Kind() != reflect.Array) || v.Type().Elem().Kind() == reflect.Uint8 {
+		return []string{formatField(v)}
+	}
+	all := make([]string, v.Len())
+	for i := range all {
+		all[i] = formatField(v.Index(i))
+	}
+	return all
+}
+
+func lookupField(v reflect.Value, key string) (reflect.Value, bool) {
+	for {
+		v = indirect(v)
+		if !v.IsValid() {
+			return reflect.Value{}, false
+		}
+		switch v.Kind() {
+		case reflect.Struct:
+			fields := structFieldsOf(v.Type())
+			if index, ok := fields[key]; ok {
+				return fieldByIndex(v, index)
+			}
+			i := strings.IndexByte(key, '.')
+			if i < 0 {
+				return reflect.Value{}, false
+			}
+			index, ok := fields[key[:i]]
+			if !ok {
+				return reflect.Value{}, false
+			}
+			if v, ok = fieldByIndex(v, index); !ok {
+				return reflect.Value{}, false
+			}
+			key = key[i+1:]
+		case reflect.Map:
+			if v.Type().Key().Kind() != reflect.String {
+				return reflect.Value{}, false
+			}
+			k := reflect.ValueOf(key).Convert(v.Type().Key())
+			if e := v.MapIndex(k); e.IsValid() {
+				return e, true
+			}
+			i := strings.IndexByte(key, '.')
+			if i < 0 {
+				return reflect.Value{}, false
+			}
+			v = v.MapIndex(reflect.ValueOf(key[:i]).Convert(v.Type().Key()))
+			key = key[i+1:]
+		default:
+			return reflect.Value{}, false
+		}
+	}
+}
+
+// indirect dereferences pointers and interfaces, returning the zero Value if
+// any of them is nil.
+func indirect(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// fieldByIndex is like reflect.Value.FieldByIndex but reports false instead of
+// panicking when an embedded pointer is nil.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 {
+			if v = indirect(v); !v.IsValid() {
+				return reflect.Value{}, false
+			}
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func formatField(v reflect.Value) string {
+	v = indirect(v)
+	if !v.IsValid() {
+		return ""
+	}
+	if v.Type() == timeType {
+		return v.Interface().(time.Time).Format(dateFormat)
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 32)
+	case reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64)
+	}
+	if !v.CanInterface() {
+		return ""
+	}
+	switch x := v.Interface().(type) {
+	case fmt.Stringer:
+		return x.String()
+	case encoding.TextMarshaler:
+		b, err := x.MarshalText()
+		if err != nil {
+			return ""
+		}
+		return string(b)
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// structCache maps a struct type to the index of each of its fields by name.
+var structCache sync.Map // map[reflect.Type]map[string][]int
+
+func structFieldsOf(t reflect.Type) map[string][]int {
+	if fields, ok := structCache.Load(t); ok {
+		return fields.(map[string][]int)
+	}
+	fields, _ := structCache.LoadOrStore(t, structFields(t))
+	return fields.(map[string][]int)
+}
+
+// structFields returns the index of each field of t by name. Fields of
+// embedded structs are visited breadth first, so that shallower fields take
+// precedence.
+func structFields(t reflect.Type) map[string][]int {
+	type embedded struct {
+		typ   reflect.Type
+		index []int
+	}
+	fields := map[string][]int{}
+	visited := map[reflect.Type]bool{}
+	for level := []embedded{{t, nil}}; len(level) > 0; {
+		var next []embedded
+		for _, e := range level {
+			if visited[e.typ] {
+				continue
+			}
+			visited[e.typ] = true
+			for i := 0; i < e.typ.NumField(); i++ {
+				f := e.typ.Field(i)
+				index := append(append([]int(nil), e.index...), i)
+				name, tagged := fieldName(f)
+				if name == "-" {
+					continue
+				}
+				if f.Anonymous && !tagged {
+					ft := f.Type
+					if ft.Kind() == reflect.Pointer {
+						ft = ft.Elem()
+					}
+					if ft.Kind() == reflect.Struct {
+						next = append(next, embedded{ft, index})
+						continue
+					}
+				}
+				if !f.IsExported() {
+					continue
+				}
+				if _, ok := fields[name]; !ok {
+					fields[name] = index
+				}
+			}
+		}
+		level = next
+	}
+	return fields
+}
+
+// fieldName returns the name f is found by and whether it was set by a tag.
+func fieldName(f reflect.StructField) (string, bool) {
+	for _, key := range []string{"exp", "json"} {
+		tag, ok := f.Tag.Lookup(key)
+		if !ok {
+			continue
+		}
+		if name, _, _ := strings.Cut(tag, ","); name != "" {
+			return name, true
+		}
+	}
+	return f.Name, false
+}
@@ -0,0 +1,137 @@
+package exp
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testBase struct {
+	ID      int `json:"id"`
+	Country string
+}
+
+type testCustomer struct {
+	Name    string
+	Country string `json:"country"`
+}
+
+type testOrder struct {
+	testBase
+	*testMeta
+	Amount   float64           `json:"amount"`
+	Quantity uint8             `json:"qty,omitempty"`
+	Country  string            `exp:"country" json:"cc"`
+	Paid     bool              `json:"paid"`
+	Created  time.Time         `json:"created"`
+	Shipped  *time.Time        `json:"shipped"`
+	Timeout  time.Duration     `json:"timeout"`
+	IP       net.IP            `json:"ip"`
+	Customer *testCustomer     `json:"customer"`
+	Labels   map[string]string `json:"labels"`
+	Tags     []string          `json:"tags"`
+	Extra    any               `json:"extra"`
+	Secret   string            `json:"-"`
+	note     string
+}
+
+type testMeta struct {
+	Source string `json:"source"`
+}
+
+func TestStruct(t *testing.T) {
+	created := time.Date(2014, time.December, 15, 0, 0, 0, 0, time.UTC)
+	order := testOrder{
+		testBase: testBase{ID: 7, Country: "CY"},
+		Amount:   150.5,
+		Quantity: 3,
+		Country:  "GR",
+		Paid:     true,
+		Created:  created,
+		Timeout:  time.Second,
+		IP:       net.ParseIP("10.0.0.1"),
+		Customer: &testCustomer{Name: "Alex", Country: "DE"},
+		Labels:   map[string]string{"tier": "gold"},
+		Extra:    map[string]any{"channel": "web", "nested": map[string]any{"depth": 2}},
+		Secret:   "xyz",
+		note:     "x",
+	}
+	for _, p := range []Params{Struct(order), Struct(&order)} {
+		for key, want := range map[string]string{
+			"id":                 "7",
+			"amount":             "150.5",
+			"qty":                "3",
+			"country":            "GR",
+			"cc":                 "",
+			"Country":            "CY",
+			"paid":               "true",
+			"created":            "2014-12-15",
+			"shipped":            "",
+			"timeout":            "1000000000",
+			"ip":                 "10.0.0.1",
+			"customer.Name":      "Alex",
+			"customer.country":   "DE",
+			"customer.missing":   "",
+			"labels.tier":        "gold",
+			"labels.missing":     "",
+			"extra.channel":      "web",
+			"extra.nested.depth": "2",
+			"source":             "",
+			"Secret":             "",
+			"note":               "",
+			"amount.nested":      "",
+			"":                   "",
+			"missing":            "",
+		} {
+			if have := p.Get(key); have != want {
+				t.Errorf("Get(%q) = %q, want %q", key, have, want)
+			}
+		}
+	}
+
+	e := And(Gt("amount", 100), On("created", created), Match("customer.country", "DE"), Match("paid", "true"))
+	if !e.Eval(Struct(&order)) {
+		t.Errorf("%s should evaluate to true", e)
+	}
+}
+
+func TestStructGetAll(t *testing.T) {
+	p := Struct(testOrder{
+		Amount: 150.5,
+		IP:     net.ParseIP("10.0.0.1"),
+		Tags:   []string{"new", "sale"},
+	}).(MultiParams)
+	for key, want := range map[string][]string{
+		"tags":    {"new", "sale"},
+		"amount":  {"150.5"},
+		"ip":      {"10.0.0.1"},
+		"shipped": nil,
+		"missing": nil,
+	} {
+		if have := p.GetAll(key); !reflect.DeepEqual(have, want) {
+			t.Errorf("GetAll(%q) = %q, want %q", key, have, want)
+		}
+	}
+}
+
+func TestStructInvalid(t *testing.T) {
+	var order *testOrder
+	for _, v := range []any{nil, order, 42, "x", []int{1}} {
+		if have := Struct(v).Get("amount"); have != "" {
+			t.Errorf("Struct(%v).Get(\"amount\") = %q", v, have)
+		}
+	}
+	if have := Struct(map[string]int{"a": 1}).Get("a"); have != "1" {
+		t.Errorf("unexpected value %q", have)
+	}
+}
+
+func BenchmarkStruct(b *testing.B) {
+	order := &testOrder{Amount: 150.5, Customer: &testCustomer{Country: "DE"}}
+	e := And(Gt("amount", 100), Match("customer.country", "DE"))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		e.Eval(Struct(order))
+	}
+}
@@ -17,6 +17,10 @@ func (on expOn) Eval(p Params) bool {
 	return date.Equal(on.date)
 }
 
+func (on expOn) String() string {
+	return sprintf("[%s==%s]", on.key, on.date.Format(dateFormat))
+}
+
 // On evaluates to true if date is equal to the date pointed to by key. The
 // value is parsed to a time.Time before comparing. In case of a parse error
 // false is returned.
@@ -39,6 +43,10 @@ func (b expBefore) Eval(p Params) bool {
 	return date.Before(b.date)
 }
 
+func (b expBefore) String() string {
+	return sprintf("[%s<%s]", b.key, b.date.Format(dateFormat))
+}
+
 // Before evaluates to true if date is before the date pointed to by key. The
 // value is parsed to a time.Time before comparing. In case of a parse error
 // false is returned.
@@ -68,6 +76,10 @@ func (a expAfter) Eval(p Params) bool {
 	return date.After(a.date)
 }
 
+func (a expAfter) String() string {
+	return sprintf("[%s>%s]", a.key, a.date.Format(dateFormat))
+}
+
 // After is an expression that evaluates to true if date is a time after the
 // evaluated date. The value is parsed to a time.Time before comparing.
 func After(key string, date time.Time) Exp {
@@ -89,6 +101,10 @@ func (w expWeekday) Eval(p Params) bool {
 	return date.Weekday() == w.weekday
 }
 
+func (w expWeekday) String() string {
+	return sprintf("[weekday(%s)==%s]", w.key, w.weekday)
+}
+
 // Weekday is an expression that evaluates to true if the date pointed to by key
 // is on the specified weekday.
 func Weekday(key string, weekday time.Weekday) Exp {
@@ -110,6 +126,10 @@ func (d expDay) Eval(p Params) bool {
 	return date.Day() == d.day
 }
 
+func (d expDay) String() string {
+	return sprintf("[day(%s)==%d]", d.key, d.day)
+}
+
 // Day is an expression that evaluates to true if the date pointed to by key is
 // on the specified day.
 func Day(key string, day int) Exp {
@@ -131,6 +151,10 @@ func (m expMonth) Eval(p Params) bool {
 	return date.Month() == m.month
 }
 
+func (m expMonth) String() string {
+	return sprintf("[month(%s)==%s]", m.key, m.month)
+}
+
 // Month is an expression that evaluates to true if the date pointed to by key
 // is on the specified month.
 func Month(key string, month time.Month) Exp {
@@ -152,6 +176,10 @@ func (y expYear) Eval(p Params) bool {
 	return date.Year() == y.year
 }
 
+func (y expYear) String() string {
+	return sprintf("[year(%s)==%d]", y.key, y.year)
+}
+
 // Year is an expression that evaluates to true if the date pointed to by key
 // is on the specified year.
 func Year(key string, year int) Exp {
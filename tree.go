@@ -0,0 +1,182 @@
+package exp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// JSON returns Params reading values from the JSON document b, which may be
+// any JSON value. Values are found as described by Tree. Numbers are rendered
+// exactly as they appear in the document.
+//
+//	p, err := JSON([]byte(`{"user": {"country": "GR"}, "items": [{"sku": "x1"}]}`))
+//	p.Get("user.country")  // "GR"
+//	p.Get("items[0].sku")  // "x1"
+func JSON(b []byte) (Params, error) {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var v any
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+	if _, err := d.Token(); err != io.EOF {
+		return nil, errors.New("exp: unexpected data after JSON document")
+	}
+	return treeParams{v}, nil
+}
+
+// Tree returns Params reading values from m, such as a JSON document decoded
+// into a map[string]any.
+//
+// Keys are paths through nested maps and slices. Map keys are separated by
+// dots and slice indexes are enclosed in brackets, as in "items[0].sku". A map
+// key containing dots is found as long as it is spelled out in full. Paths
+// which cannot be resolved read as an empty string.
+//
+// Strings are read as is, numbers are formatted with the strconv package and
+// booleans as "true" or "false". Null reads as an empty string, while nested
+// maps and slices read as their JSON encoding. The Params returned implement
+// MultiParams, reading each element of a slice as a separate value, so that
+// Any and All can quantify over them.
+func Tree(m map[string]any) Params {
+	return treeParams{m}
+}
+
+type treeParams struct {
+	v any
+}
+
+// Get returns the value at the path key.
+func (t treeParams) Get(key string) string {
+	v, ok := lookupPath(t.v, key)
+	if !ok {
+		return ""
+	}
+	return formatTreeValue(v)
+}
+
+// GetAll returns the elements of the slice at the path key, or the value at
+// the path if it is not a slice.
+func (t treeParams) GetAll(key string) []string {
+	v, ok := lookupPath(t.v, key)
+	if !ok {
+		return nil
+	}
+	if s, ok := v.([]any); ok {
+		all := make([]string, len(s))
+		for i, e := range s {
+			all[i] = formatTreeValue(e)
+		}
+		return all
+	}
+	rv := indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return []string{formatTreeValue(v)}
+	}
+	all := make([]string, rv.Len())
+	for i := range all {
+		all[i] = formatTreeValue(rv.Index(i).Interface())
+	}
+	return all
+}
+
+func lookupPath(v any, path string) (any, bool) {
+	if path == "" {
+		return nil, false
+	}
+	for path != "" {
+		if path[0] == '[' {
+			end := strings.IndexByte(path, ']')
+			if end < 0 {
+				return nil, false
+			}
+			i, err := strconv.Atoi(path[1:end])
+			if err != nil || i < 0 {
+				return nil, false
+			}
+			var ok bool
+			if v, ok = treeIndex(v, i); !ok {
+				return nil, false
+			}
+			path = path[end+1:]
+		} else {
+			if e, ok := treeChild(v, path); ok {
+				return e, true
+			}
+			end := strings.IndexAny(path, ".[")
+			if end <= 0 {
+				return nil, false
+			}
+			var ok bool
+			if v, ok = treeChild(v, path[:end]); !ok {
+				return nil, false
+			}
+			path = path[end:]
+		}
+		if strings.HasPrefix(path, ".") {
+			if path = path[1:]; path == "" {
+				return nil, false
+			}
+		} else if path != "" && path[0] != '[' {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// treeChild returns the element of map v with the given key.
+func treeChild(v any, key string) (any, bool) {
+	switch m := v.(type) {
+	case map[string]any:
+		e, ok := m[key]
+		return e, ok
+	case map[string]string:
+		e, ok := m[key]
+		return e, ok
+	}
+	rv := indirect(reflect.ValueOf(v))
+	if !rv.IsValid() || rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+		return nil, false
+	}
+	e := rv.MapIndex(reflect.ValueOf(key).Convert(rv.Type().Key()))
+	if !e.IsValid() {
+		return nil, false
+	}
+	return e.Interface(), true
+}
+
+// treeIndex returns the element of slice v at index i.
+func treeIndex(v any, i int) (any, bool) {
+	if s, ok := v.([]any); ok {
+		if i >= len(s) {
+			return nil, false
+		}
+		return s[i], true
+	}
+	rv := indirect(reflect.ValueOf(v))
+	if !rv.IsValid() || (rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array) || i >= rv.Len() {
+		return nil, false
+	}
+	return rv.Index(i).Interface(), true
+}
+
+func formatTreeValue(v any) string {
+	switch v.(type) {
+	case map[string]any, []any:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+	rv := reflect.ValueOf(v)
+	switch indirect(rv).Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array:
+		if b, err := json.Marshal(v); err == nil {
+			return string(b)
+		}
+	}
+	return formatField(rv)
+}
@@ -0,0 +1,128 @@
+package exp
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+const testDocument = `{
+	"user": {"name": "Alex", "address": {"country": "GR", "zip": 10558}},
+	"items": [
+		{"sku": "x1", "price": 9.99, "tags": ["new", "sale"]},
+		{"sku": "x2", "price": 1e3, "qty": 12345678901234567890}
+	],
+	"active": true,
+	"deleted": false,
+	"note": null,
+	"dotted.key": "yes",
+	"matrix": [[1, 2], [3, 4]],
+	"created": "2014-12-15"
+}`
+
+func TestJSON(t *testing.T) {
+	p, err := JSON([]byte(testDocument))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]string{
+		"user.name":            "Alex",
+		"user.address.country": "GR",
+		"user.address.zip":     "10558",
+		"user.address":         `{"country":"GR","zip":10558}`,
+		"items[0].sku":         "x1",
+		"items[0].price":       "9.99",
+		"items[0].tags[1]":     "sale",
+		"items[0].tags":        `["new","sale"]`,
+		"items[1].price":       "1e3",
+		"items[1].qty":         "12345678901234567890",
+		"items[2].sku":         "",
+		"items[-1].sku":        "",
+		"items[x].sku":         "",
+		"items[0":              "",
+		"items.0.sku":          "",
+		"items[0]sku":          "",
+		"active":               "true",
+		"deleted":              "false",
+		"note":                 "",
+		"dotted.key":           "yes",
+		"matrix[1][0]":         "3",
+		"user.":                "",
+		".user":                "",
+		"":                     "",
+		"missing.path":         "",
+	} {
+		if have := p.Get(key); have != want {
+			t.Errorf("Get(%q) = %q, want %q", key, have, want)
+		}
+	}
+
+	e := And(Match("user.address.country", "GR"), Gt("items[1].price", 100), On("created", time.Date(2014, time.December, 15, 0, 0, 0, 0, time.UTC)))
+	if !e.Eval(p) {
+		t.Errorf("%s should evaluate to true", e)
+	}
+}
+
+func TestJSONErrors(t *testing.T) {
+	for _, s := range []string{``, `{`, `{"a": 1} {"b": 2}`, `{"a": 1}]`} {
+		if _, err := JSON([]byte(s)); err == nil {
+			t.Errorf("JSON(%q) should fail", s)
+		}
+	}
+	p, err := JSON([]byte(`[{"sku": "x1"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have := p.Get("[0].sku"); have != "x1" {
+		t.Errorf("unexpected value %q", have)
+	}
+}
+
+func TestTreeGetAll(t *testing.T) {
+	p, err := JSON([]byte(testDocument))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mp := p.(MultiParams)
+	for key, want := range map[string][]string{
+		"items[0].tags": {"new", "sale"},
+		"matrix":        {"[1,2]", "[3,4]"},
+		"user.name":     {"Alex"},
+		"missing":       nil,
+	} {
+		if have := mp.GetAll(key); !reflect.DeepEqual(have, want) {
+			t.Errorf("GetAll(%q) = %q, want %q", key, have, want)
+		}
+	}
+	if have := Tree(map[string]any{"sizes": []int{38, 42}}).(MultiParams).GetAll("sizes"); !reflect.DeepEqual(have, []string{"38", "42"}) {
+		t.Errorf("GetAll(sizes) = %q", have)
+	}
+}
+
+func TestTree(t *testing.T) {
+	p := Tree(map[string]any{
+		"amount": 150.5,
+		"count":  3,
+		"paid":   true,
+		"nil":    nil,
+		"labels": map[string]string{"tier": "gold"},
+		"sizes":  []int{38, 42},
+		"nested": map[string]any{"list": []any{map[string]any{"id": int64(7)}}},
+		"date":   time.Date(2014, time.December, 15, 0, 0, 0, 0, time.UTC),
+	})
+	for key, want := range map[string]string{
+		"amount":            "150.5",
+		"count":             "3",
+		"paid":              "true",
+		"nil":               "",
+		"labels.tier":       "gold",
+		"sizes[1]":          "42",
+		"sizes":             "[38,42]",
+		"nested.list[0].id": "7",
+		"date":              "2014-12-15",
+	} {
+		if have := p.Get(key); have != want {
+			t.Errorf("Get(%q) = %q, want %q", key, have, want)
+		}
+	}
+}